@@ -1,9 +1,14 @@
+//go:build windows
+
+// El instalador registra el servicio en el SCM de Windows. En Linux el servicio
+// se instala con la unidad de systemd de deploy/ecf-sequence.service.
 package main
 
 import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -11,6 +16,9 @@ import (
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
+
+	"ecf-sequence-server/internal/config"
+	"ecf-sequence-server/internal/dbf"
 )
 
 const (
@@ -63,10 +71,19 @@ func main() {
 		return
 	}
 
+	// La API Key va en el archivo de configuración, legible solo por SYSTEM y
+	// los administradores, y no en la línea de comandos del servicio
+	configPath, err := writeConfig(filepath.Dir(exePath), dbfPath, port, apiKey)
+	if err != nil {
+		fmt.Printf("Error escribiendo la configuración: %v\n", err)
+		pressEnterToContinue()
+		return
+	}
+
 	fmt.Println("\nInstalando servicio...")
 
 	// Instalar (o reinstalar) el servicio
-	if err := installService(exePath, dbfPath, port, apiKey); err != nil {
+	if err := installService(exePath, configPath); err != nil {
 		fmt.Printf("Error instalando el servicio: %v\n", err)
 		pressEnterToContinue()
 		return
@@ -86,9 +103,11 @@ func main() {
 	fmt.Printf("Archivo ejecutable: %s\n", exePath)
 	fmt.Printf("Puerto: %s\n", port)
 	fmt.Printf("DBF: %s\n", dbfPath)
+	fmt.Printf("Configuración: %s\n", configPath)
+	fmt.Printf("Para aplicar cambios de la configuración sin reinstalar: sc control %s paramchange\n", serviceName)
 
 	fmt.Println("\nPara probar el servicio, por ejemplo:")
-	fmt.Printf("curl -X GET http://localhost:%s/health -H \"Content-Type: application/json\" -H \"X-API-Key: %s\" -d \"{\\\"type\\\":\\\"E31\\\"}\"\n", port, apiKey)
+	fmt.Printf("curl -X GET http://localhost:%s/health\n", port)
 
 	pressEnterToContinue()
 }
@@ -110,6 +129,9 @@ func validateFiles(dbfPath string) error {
 	if _, err := os.Stat(cdxPath); os.IsNotExist(err) {
 		return fmt.Errorf("el archivo CDX no existe: %s", cdxPath)
 	}
+	if _, err := dbf.ReadCDX(cdxPath); err != nil {
+		return fmt.Errorf("el archivo CDX está dañado: %v", err)
+	}
 	return nil
 }
 
@@ -128,8 +150,36 @@ func getServiceExecutablePath() (string, error) {
 	return servicePath, nil
 }
 
-// installService crea/reemplaza el servicio con la ruta exe dada y argumentos extra
-func installService(exePath, dbfPath, port, apiKey string) error {
+// writeConfig escribe ecf-sequence.yaml en dir con los datos pedidos y deja
+// el archivo legible solo por SYSTEM y los administradores. Los logs quedan
+// en dir: el servicio corre con el directorio actual en System32.
+func writeConfig(dir, dbfPath, port, apiKey string) (string, error) {
+	path := filepath.Join(dir, "ecf-sequence.yaml")
+	values := [][2]string{
+		{"dbf", dbfPath},
+		{"port", port},
+		{"key", apiKey},
+		{"log", filepath.Join(dir, "ecf-sequence.log")},
+		{"log-secuencias", filepath.Join(dir, "sequence.log")},
+	}
+	header := "Configuración del servicio ECFSequence, generada por install.exe.\n" +
+		"Cada clave es un flag de ecf-sequence.exe; revísela con: ecf-sequence.exe config check"
+	if err := config.Write(path, header, values); err != nil {
+		return "", err
+	}
+	// S-1-5-18 es SYSTEM y S-1-5-32-544 el grupo Administradores, con
+	// cualquier idioma de Windows
+	out, err := exec.Command("icacls", path, "/inheritance:r",
+		"/grant:r", "*S-1-5-18:F", "/grant:r", "*S-1-5-32-544:F").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("no se pudieron restringir los permisos de %s: %v: %s", path, err, out)
+	}
+	return path, nil
+}
+
+// installService crea/reemplaza el servicio con la ruta exe dada y su
+// archivo de configuración
+func installService(exePath, configPath string) error {
 	m, err := mgr.Connect()
 	if err != nil {
 		return fmt.Errorf("error conectando al service manager: %v", err)
@@ -173,9 +223,7 @@ func installService(exePath, dbfPath, port, apiKey string) error {
 	// Importante: exePath SIN argumentos
 	// Luego pasamos los argumentos en la llamada createService(...args)
 	args := []string{
-		"-dbf", dbfPath,
-		"-port", port,
-		"-key", apiKey,
+		"-config", configPath,
 		// Quita -debug para forzar modo servicio
 	}
 
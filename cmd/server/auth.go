@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecf-sequence-server/internal/apikey"
+)
+
+const errCodeForbidden = "FORBIDDEN"
+
+// legacyClient es el nombre del cliente de la clave de -key (o -key-archivo),
+// que tiene todos los permisos
+const legacyClient = "principal"
+
+// authContextKey es la clave del contexto donde identify deja el resultado
+type authContextKey struct{}
+
+// authResult es la clave de la solicitud según el registro en uso. key puede
+// venir con err (una clave vencida) para poder nombrar al cliente.
+type authResult struct {
+	key *apikey.Key
+	err error
+}
+
+// identify busca la API Key de cada solicitud en el registro en uso y deja
+// el resultado en el contexto. No rechaza nada: lo decide authorized en cada
+// handler, con el permiso que necesita.
+func identify(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("X-API-Key"); header != "" {
+			key, err := currentSettings().keys.Authenticate(header, time.Now())
+			r = r.WithContext(context.WithValue(r.Context(), authContextKey{}, authResult{key, err}))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authorized verifica la API Key y responde 401 si no es válida o 403 si no
+// tiene el permiso scope. Con scope vacío alcanza con una clave válida.
+func (m *apiServerService) authorized(w http.ResponseWriter, r *http.Request, scope string) bool {
+	auth, _ := r.Context().Value(authContextKey{}).(authResult)
+	switch {
+	case errors.Is(auth.err, apikey.ErrExpired):
+		m.store.Log(fmt.Sprintf("Intento de acceso con la clave vencida de %s desde %s", auth.key.Cliente, r.RemoteAddr))
+		http.Error(w, "No autorizado", http.StatusUnauthorized)
+		return false
+	case auth.key == nil:
+		m.store.Log(fmt.Sprintf("Intento de acceso no autorizado desde %s", r.RemoteAddr))
+		http.Error(w, "No autorizado", http.StatusUnauthorized)
+		return false
+	case scope != "" && !auth.key.Allows(scope):
+		m.store.Log(fmt.Sprintf("Acceso denegado a %s desde %s: falta el permiso %s", auth.key.Cliente, r.RemoteAddr, scope))
+		writeJSONError(w, http.StatusForbidden, errCodeForbidden, fmt.Sprintf("la clave de %s no tiene el permiso %s", auth.key.Cliente, scope))
+		return false
+	}
+	return true
+}
+
+// clientName es el cliente de la API Key de una solicitud ya autorizada
+func clientName(r *http.Request) string {
+	if auth, ok := r.Context().Value(authContextKey{}).(authResult); ok && auth.key != nil {
+		return auth.key.Cliente
+	}
+	return ""
+}
+
+// newKeyRegistry arma el registro de claves con las de -claves más la de
+// -key, que queda como el cliente legacyClient con todos los permisos. Ese
+// nombre queda reservado aunque no haya -key, para que agregarla después no
+// choque con una entrada de -claves.
+func newKeyRegistry(key string, claves []apikey.Key) (*apikey.Registry, error) {
+	for i, k := range claves {
+		if k.Cliente == legacyClient {
+			return nil, fmt.Errorf("clave %d: el cliente %s está reservado para la clave de -key; use otro nombre", i+1, legacyClient)
+		}
+	}
+	keys := append([]apikey.Key(nil), claves...)
+	if key != "" {
+		keys = append(keys, apikey.Key{Cliente: legacyClient, Hash: apikey.Hash(key), Permisos: []string{apikey.ScopeAdmin}})
+	}
+	return apikey.New(keys)
+}
@@ -0,0 +1,719 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/dgii"
+	"ecf-sequence-server/internal/ledger"
+	"ecf-sequence-server/internal/store"
+)
+
+// Flags que solo usan los subcomandos
+var (
+	periodoF = flag.String("periodo", "", "Período AAAAMM del reporte")
+	salidaF  = flag.String("salida", "", "Archivo de salida del reporte (por defecto el nombre que pide la DGII o migracion-FECHA.json)")
+	anchoF   = flag.Int("ancho", 10, "Ancho en dígitos al que se amplían NUMERO_1 y NUMERO_2")
+	confirmF = flag.Bool("confirmar", false, "Aplicar los cambios de ampliar-contadores, adelantar-contadores, verify, migrar, exportar-dbf o restaurar (sin este flag solo se muestra qué cambiaría)")
+	nombreF  = flag.String("nombre", "", "Nombre del respaldo a restaurar (ver el subcomando respaldos)")
+	clienteF = flag.String("cliente", "", "Nombre del cliente de la clave nueva de crear-clave, p.ej. caja-03")
+	permisoF = flag.String("permisos", "", "Permisos de la clave nueva de crear-clave, separados por coma: leer, admin, asignar:TIPO o asignar:*")
+	expiraF  = flag.String("expira", "", "Último día AAAA-MM-DD en que vale la clave nueva de crear-clave (por defecto no vence)")
+)
+
+// runCommand ejecuta un subcomando de administración y devuelve el código de
+// salida del proceso. Los subcomandos usan los mismos flags que el servicio.
+func runCommand(name string, args []string) int {
+	if name == "config" {
+		if len(args) == 0 || args[0] != "check" {
+			fmt.Println("Uso: ecf-sequence.exe config check [-config=archivo.yaml] [opciones]")
+			return 2
+		}
+		args = args[1:]
+	}
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if name == "config" {
+		return runConfigCheck()
+	}
+	if _, errs := loadConfig(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		return 2
+	}
+
+	switch name {
+	case "check-cta":
+		return runCheckCTA()
+	case "reporte-608":
+		return runReporte608()
+	case "ampliar-contadores":
+		return runAmpliarContadores()
+	case "adelantar-contadores":
+		return runAdelantarContadores()
+	case "verify":
+		return runVerify()
+	case "migrar":
+		return runMigrar()
+	case "exportar-dbf":
+		return runExportarDBF()
+	case "respaldos":
+		return runRespaldos()
+	case "restaurar":
+		return runRestaurar()
+	case "claves":
+		return runClaves()
+	case "crear-clave":
+		return runCrearClave()
+	default:
+		fmt.Printf("Subcomando desconocido: %s\n", name)
+		fmt.Println("Subcomandos disponibles: check-cta, reporte-608, ampliar-contadores, adelantar-contadores, verify, migrar, exportar-dbf, respaldos, restaurar, claves, crear-clave, config check")
+		return 2
+	}
+}
+
+// newManager crea el Manager con las opciones tomadas de los flags más las
+// opciones adicionales que indique el llamador
+func newManager(extra ...dbf.Option) (*dbf.Manager, error) {
+	opts := append([]dbf.Option{dbf.WithLockTimeout(*lockWait, dbf.DefaultLockRetry), dbf.WithLogFile(*seqLog)}, extra...)
+	if *walPath != "" {
+		opts = append(opts, dbf.WithJournal(*walPath))
+	}
+	if *hwmPath != "" {
+		opts = append(opts, dbf.WithHighWaterFile(*hwmPath))
+	}
+	if *codePage != "" {
+		opts = append(opts, dbf.WithEncoding(*codePage))
+	}
+	if *ctaPath != "" {
+		parts, err := dbf.LoadPartitions(*ctaPath)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, dbf.WithPartitions(parts))
+	}
+	return dbf.NewManager(*dbfPath, opts...)
+}
+
+// snapshotOptions devuelve la opción de respaldos automáticos según los
+// flags, o ninguna si -respaldo-intervalo es 0
+func snapshotOptions() []dbf.Option {
+	if *snapInt <= 0 {
+		return nil
+	}
+	return []dbf.Option{dbf.WithSnapshots(snapshotDir(), snapshotPolicy(*snapInt))}
+}
+
+// snapshotPolicy arma la política de retención de los flags con el intervalo
+// dado
+func snapshotPolicy(intervalo time.Duration) dbf.SnapshotPolicy {
+	return dbf.SnapshotPolicy{
+		Intervalo: intervalo,
+		Horarias:  *snapHrs,
+		Diarias:   time.Duration(*snapDays) * 24 * time.Hour,
+	}
+}
+
+// snapshotDir devuelve el directorio de respaldos: el de -respaldos o
+// "respaldos" junto al DBF
+func snapshotDir() string {
+	if *snapDir != "" {
+		return *snapDir
+	}
+	return filepath.Join(filepath.Dir(*dbfPath), "respaldos")
+}
+
+// dataDir es donde quedan por defecto los archivos del servicio: junto al DBF
+// o, con -almacen=bolt, junto al archivo del almacén
+func dataDir() string {
+	if kind, _ := store.Kind(*storeF); kind == store.KindBolt {
+		return filepath.Dir(*boltPath)
+	}
+	return filepath.Dir(*dbfPath)
+}
+
+// ledgerDir devuelve el directorio del ledger: el de -ledger o "ledger" junto
+// al DBF
+func ledgerDir() string {
+	if *ledgerD != "" {
+		return *ledgerD
+	}
+	return filepath.Join(dataDir(), "ledger")
+}
+
+// runCheckCTA revisa los contadores actuales contra las particiones y reporta
+// los números que ya se emitieron duplicados entre CTA A y CTA B.
+//
+//	ecf-sequence.exe check-cta -dbf=C:\path\FAC_PF_M.DBF -cta=particiones.json
+func runCheckCTA() int {
+	if *dbfPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe check-cta -dbf=C:\\path\\FAC_PF_M.DBF [-cta=particiones.json]")
+		return 2
+	}
+
+	manager, err := newManager()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer manager.Close()
+
+	collisions, err := manager.CheckCollisions()
+	if err != nil {
+		fmt.Printf("Error revisando contadores: %v\n", err)
+		return 1
+	}
+	if len(collisions) == 0 {
+		fmt.Println("Sin colisiones entre CTA A y CTA B.")
+		return 0
+	}
+
+	fmt.Printf("Se encontraron %d colisiones:\n", len(collisions))
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(collisions)
+	return 1
+}
+
+// runReporte608 genera el 608 del período leyendo el ledger sin abrirlo para
+// escritura, así se puede correr con el servicio en marcha.
+//
+//	ecf-sequence.exe reporte-608 -dbf=C:\path\FAC_PF_M.DBF -rnc=101010101 -periodo=202501
+func runReporte608() int {
+	if (*dbfPath == "" && *ledgerD == "") || *rncF == "" || *periodoF == "" {
+		fmt.Println("Uso: ecf-sequence.exe reporte-608 -dbf=C:\\path\\FAC_PF_M.DBF -rnc=RNC -periodo=AAAAMM [-ledger=dir] [-salida=archivo]")
+		return 2
+	}
+	if !dgii.ValidRNC(*rncF) {
+		fmt.Printf("RNC inválido: %q\n", *rncF)
+		return 2
+	}
+	periodo, err := dgii.ParsePeriodo(*periodoF)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+
+	scan := func(fn func(ledger.Record) error) error { return ledger.ScanDir(ledgerDir(), fn) }
+	anulados, err := dgii.Anulados608(scan, periodo)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	out := *salidaF
+	if out == "" {
+		out = dgii.FileName608(*rncF, periodo)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		fmt.Printf("Error creando %s: %v\n", out, err)
+		return 1
+	}
+	err = dgii.Write608(f, *rncF, periodo, anulados)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Printf("Error escribiendo %s: %v\n", out, err)
+		return 1
+	}
+	fmt.Printf("608 de %s generado en %s con %d anulaciones.\n", *periodoF, out, len(anulados))
+	return 0
+}
+
+// runAmpliarContadores amplía NUMERO_1 y NUMERO_2 para que entren los 10
+// dígitos de un e-NCF. Sin -confirmar solo informa los anchos actuales. No
+// corre si el servicio está usando el DBF.
+//
+//	ecf-sequence.exe ampliar-contadores -dbf=C:\path\FAC_PF_M.DBF -ancho=10 -confirmar
+func runAmpliarContadores() int {
+	if *dbfPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe ampliar-contadores -dbf=C:\\path\\FAC_PF_M.DBF [-ancho=10] [-confirmar]")
+		return 2
+	}
+
+	// El Manager queda abierto hasta el final: con el journal tomado, el
+	// servicio no puede arrancar a mitad de la migración
+	manager, err := newManager()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer manager.Close()
+	if !manager.Exclusive() {
+		fmt.Println("El servicio está usando el DBF; deténgalo antes de ampliar los contadores.")
+		return 1
+	}
+	pending := false
+	for _, name := range []string{"NUMERO_1", "NUMERO_2"} {
+		width := manager.FieldWidth(name)
+		fmt.Printf("%s: N(%d)", name, width)
+		if width < *anchoF {
+			fmt.Printf(" -> N(%d)", *anchoF)
+			pending = true
+		}
+		fmt.Println()
+	}
+	if !pending {
+		fmt.Println("Los contadores ya tienen el ancho pedido.")
+		return 0
+	}
+	if !*confirmF {
+		fmt.Println("Detenga el servicio y vuelva a correr con -confirmar para aplicar la migración.")
+		return 0
+	}
+
+	backup, widened, err := dbf.WidenNumericFields(*dbfPath, *anchoF, "NUMERO_1", "NUMERO_2")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	manager.Log(fmt.Sprintf("Campos %v ampliados a N(%d); copia del original en %s", widened, *anchoF, backup))
+	fmt.Printf("Campos ampliados: %v. Copia del original en %s\n", widened, backup)
+	return 0
+}
+
+// runAdelantarContadores muestra los contadores del DBF que quedaron por debajo
+// del último número emitido (según las marcas y el ledger) y, con -confirmar,
+// los adelanta. Puede correrse con el servicio en marcha: el servicio vuelve a
+// asignar en cuanto ve el DBF corregido.
+//
+//	ecf-sequence.exe adelantar-contadores -dbf=C:\path\FAC_PF_M.DBF [-confirmar]
+func runAdelantarContadores() int {
+	if *dbfPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe adelantar-contadores -dbf=C:\\path\\FAC_PF_M.DBF [-ledger=DIR] [-confirmar]")
+		return 2
+	}
+
+	marks, err := ledgerHighWater(ledgerDir())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	manager, err := newManager(dbf.WithHighWater(marks))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer manager.Close()
+
+	rollbacks, err := manager.Rollbacks()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(rollbacks) == 0 {
+		fmt.Println("Ningún contador está por debajo de lo ya emitido.")
+		return 0
+	}
+	for _, rb := range rollbacks {
+		fmt.Printf("%s CTA %s: el DBF está en %d y ya se emitió hasta %d\n", rb.Tipo, rb.CTA, rb.Contador, rb.Emitido)
+	}
+	if !*confirmF {
+		fmt.Println("Vuelva a correr con -confirmar para adelantar los contadores.")
+		return 1
+	}
+
+	fixed, err := manager.FastForward()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, rb := range fixed {
+		manager.Log(fmt.Sprintf("%s CTA %s adelantado de %d a %d", rb.Tipo, rb.CTA, rb.Contador, rb.Emitido))
+	}
+	fmt.Printf("Contadores adelantados: %d\n", len(fixed))
+	return 0
+}
+
+// runVerify compara el índice estructural (CDX) con la tabla y reporta las
+// diferencias. Con -confirmar reconstruye el CDX a partir del DBF.
+//
+//	ecf-sequence.exe verify -dbf=C:\path\FAC_PF_M.DBF [-confirmar]
+func runVerify() int {
+	if *dbfPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe verify -dbf=C:\\path\\FAC_PF_M.DBF [-confirmar]")
+		return 2
+	}
+
+	report, err := dbf.VerifyIndex(*dbfPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, tag := range report.Tags {
+		fmt.Printf("Tag %s: %s", tag.Name, tag.Expr)
+		if tag.For != "" {
+			fmt.Printf(" FOR %s", tag.For)
+		}
+		if reason, ok := report.Omitidos[tag.Name]; ok {
+			fmt.Printf(" (no verificado: %s)", reason)
+		}
+		fmt.Println()
+	}
+	if len(report.Problemas) == 0 {
+		if len(report.Tags) == 0 {
+			fmt.Println("La tabla no tiene índice estructural.")
+		} else {
+			fmt.Println("El índice coincide con la tabla.")
+		}
+		return 0
+	}
+	for _, p := range report.Problemas {
+		switch {
+		case p.Tag == "":
+			fmt.Println(p.Detalle)
+		case p.Recno == 0:
+			fmt.Printf("%s: %s\n", p.Tag, p.Detalle)
+		default:
+			fmt.Printf("%s, registro %d: %s\n", p.Tag, p.Recno, p.Detalle)
+		}
+	}
+	if !*confirmF {
+		fmt.Println("Vuelva a correr con -confirmar para reconstruir el índice.")
+		return 1
+	}
+
+	if err := dbf.RebuildIndex(*dbfPath); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Índice %s reconstruido.\n", report.CDX)
+	return 0
+}
+
+// runMigrar copia todos los tipos del DBF a un almacén bolt nuevo y verifica
+// la copia campo por campo. Sin -confirmar solo muestra qué se copiaría. No
+// corre si el servicio está usando el DBF.
+//
+//	ecf-sequence.exe migrar -dbf=C:\path\FAC_PF_M.DBF -almacen-archivo=C:\path\secuencias.db [-salida=reporte.json] [-confirmar]
+func runMigrar() int {
+	if *dbfPath == "" || *boltPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe migrar -dbf=C:\\path\\FAC_PF_M.DBF -almacen-archivo=C:\\path\\secuencias.db [-salida=reporte.json] [-confirmar]")
+		return 2
+	}
+
+	// El Manager queda abierto hasta el final: con el journal tomado, el
+	// servicio no puede arrancar a mitad de la migración
+	marks, err := ledgerHighWater(ledgerDir())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	manager, err := newManager(dbf.WithHighWater(marks))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer manager.Close()
+	if !manager.Exclusive() {
+		fmt.Println("El servicio está usando el DBF; deténgalo antes de migrar.")
+		return 1
+	}
+
+	tipos, err := manager.GetRecordTypes()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, t := range tipos {
+		fmt.Printf("%s %-30s A=%d B=%d vence=%s cantidad=%d minimo=%d\n",
+			t.NCFTipo, t.Nombre, t.Numero1, t.Numero2, t.FechaDoc, t.CantSecuen, t.Minimo)
+	}
+	if !*confirmF {
+		fmt.Printf("Vuelva a correr con -confirmar para copiar %d tipos a %s.\n", len(tipos), *boltPath)
+		return 0
+	}
+
+	b, err := store.OpenBolt(*boltPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer b.Close()
+	report, err := store.ImportDBF(manager, *dbfPath, b)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return finishMigration(report)
+}
+
+// runExportarDBF vuelve a armar el DBF desde el almacén bolt, con el esquema
+// que tenía al migrarse y los contadores actuales, para volver al ERP. Si el
+// DBF existe se deja una copia. No corre si el servicio está usando el
+// almacén o el DBF.
+//
+//	ecf-sequence.exe exportar-dbf -almacen-archivo=C:\path\secuencias.db -dbf=C:\path\FAC_PF_M.DBF [-salida=reporte.json] [-confirmar]
+func runExportarDBF() int {
+	if *dbfPath == "" || *boltPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe exportar-dbf -almacen-archivo=C:\\path\\secuencias.db -dbf=C:\\path\\FAC_PF_M.DBF [-salida=reporte.json] [-confirmar]")
+		return 2
+	}
+
+	// OpenBolt falla si el servicio tiene abierto el almacén
+	b, err := store.OpenBolt(*boltPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer b.Close()
+	tipos, err := b.GetRecordTypes()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, t := range tipos {
+		fmt.Printf("%s %-30s A=%d B=%d vence=%s cantidad=%d minimo=%d\n",
+			t.NCFTipo, t.Nombre, t.Numero1, t.Numero2, t.FechaDoc, t.CantSecuen, t.Minimo)
+	}
+	if !*confirmF {
+		fmt.Printf("Vuelva a correr con -confirmar para escribir %d tipos en %s.\n", len(tipos), *dbfPath)
+		return 0
+	}
+
+	// Si ya hay un DBF, tomar su journal para que el servicio no lo use
+	// mientras se reemplaza
+	if _, err := os.Stat(*dbfPath); err == nil {
+		manager, err := newManager()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer manager.Close()
+		if !manager.Exclusive() {
+			fmt.Println("El servicio está usando el DBF; deténgalo antes de exportar.")
+			return 1
+		}
+	}
+
+	report, err := store.ExportDBF(b, *dbfPath, *codePage)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if report.Respaldo != "" {
+		fmt.Printf("Copia del DBF anterior en %s\n", report.Respaldo)
+	}
+	return finishMigration(report)
+}
+
+// finishMigration guarda el reporte de migración, muestra las diferencias y
+// devuelve el código de salida
+func finishMigration(report *store.MigrationReport) int {
+	out := *salidaF
+	if out == "" {
+		out = filepath.Join(filepath.Dir(*dbfPath), "migracion-"+report.Fecha.Format("20060102150405")+".json")
+	}
+	if err := report.Write(out); err != nil {
+		fmt.Printf("Error escribiendo el reporte %s: %v\n", out, err)
+		return 1
+	}
+	if !report.OK() {
+		for _, d := range report.Diferencias {
+			fmt.Printf("%s %s: origen %q, destino %q\n", d.Tipo, d.Campo, d.Origen, d.Destino)
+		}
+		fmt.Printf("La verificación encontró %d diferencias; no use %s. Reporte en %s\n", len(report.Diferencias), report.Destino, out)
+		return 1
+	}
+	fmt.Printf("%d tipos copiados de %s a %s y verificados. Reporte en %s\n", len(report.Tipos), report.Origen, report.Destino, out)
+	return 0
+}
+
+// runRespaldos lista los respaldos automáticos del DBF. Puede correrse con el
+// servicio en marcha.
+//
+//	ecf-sequence.exe respaldos -dbf=C:\path\FAC_PF_M.DBF [-respaldos=DIR]
+func runRespaldos() int {
+	if *dbfPath == "" {
+		fmt.Println("Uso: ecf-sequence.exe respaldos -dbf=C:\\path\\FAC_PF_M.DBF [-respaldos=DIR]")
+		return 2
+	}
+
+	snaps, err := dbf.ListSnapshots(snapshotDir(), *dbfPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(snaps) == 0 {
+		fmt.Printf("No hay respaldos en %s.\n", snapshotDir())
+		return 0
+	}
+	for _, s := range snaps {
+		estado := "ok"
+		if err := dbf.VerifySnapshot(s); err != nil {
+			estado = err.Error()
+		}
+		fmt.Printf("%s  %s  %d bytes  %s\n", s.Nombre, s.Fecha.Format("2006-01-02 15:04:05"), s.Bytes, estado)
+	}
+	return 0
+}
+
+// runRestaurar reemplaza el DBF por un respaldo. Los contadores que queden por
+// debajo de lo ya emitido (según las marcas y el ledger) se adelantan, así que
+// la restauración no hace repetir números. Sin -confirmar solo muestra qué
+// contadores se adelantarían. No corre si el servicio está usando el DBF; con
+// el servicio en marcha se usa POST /api/respaldos/restaurar.
+//
+//	ecf-sequence.exe restaurar -dbf=C:\path\FAC_PF_M.DBF -nombre=FAC_PF_M-20250101-080000 [-confirmar]
+func runRestaurar() int {
+	if *dbfPath == "" || *nombreF == "" {
+		fmt.Println("Uso: ecf-sequence.exe restaurar -dbf=C:\\path\\FAC_PF_M.DBF -nombre=RESPALDO [-respaldos=DIR] [-confirmar]")
+		return 2
+	}
+
+	var snap *dbf.Snapshot
+	snaps, err := dbf.ListSnapshots(snapshotDir(), *dbfPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for i := range snaps {
+		if snaps[i].Nombre == *nombreF {
+			snap = &snaps[i]
+		}
+	}
+	if snap == nil {
+		fmt.Printf("No existe el respaldo %s en %s.\n", *nombreF, snapshotDir())
+		return 1
+	}
+
+	marks, err := ledgerHighWater(ledgerDir())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if !*confirmF {
+		// Se compara el respaldo con lo emitido según el ledger, sin tocar el DBF
+		tipos, err := dbf.ReadRecordTypes(snap.DBF, *codePage)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		counters := make(map[[2]string]int64)
+		for _, t := range tipos {
+			counters[[2]string{t.NCFTipo, "A"}] = t.Numero1
+			counters[[2]string{t.NCFTipo, "B"}] = t.Numero2
+		}
+		for _, hw := range marks {
+			if c, ok := counters[[2]string{hw.Tipo, hw.CTA}]; ok && c < hw.Numero {
+				fmt.Printf("%s CTA %s: el respaldo está en %d y se adelantará a %d\n", hw.Tipo, hw.CTA, c, hw.Numero)
+			}
+		}
+		fmt.Printf("Vuelva a correr con -confirmar para restaurar %s (%s).\n", snap.Nombre, snap.Fecha.Format("2006-01-02 15:04:05"))
+		return 0
+	}
+
+	// Aunque -respaldo-intervalo sea 0, antes de restaurar se respalda el DBF actual
+	manager, err := newManager(dbf.WithSnapshots(snapshotDir(), snapshotPolicy(time.Hour)), dbf.WithHighWater(marks))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer manager.Close()
+	if !manager.Exclusive() {
+		fmt.Println("El servicio está usando el DBF; restaure con POST /api/respaldos/restaurar o detenga el servicio.")
+		return 1
+	}
+	advanced, err := manager.RestoreSnapshot(*nombreF)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, rb := range advanced {
+		fmt.Printf("%s CTA %s adelantado de %d a %d\n", rb.Tipo, rb.CTA, rb.Contador, rb.Emitido)
+	}
+	fmt.Printf("DBF restaurado desde %s.\n", *nombreF)
+	return 0
+}
+
+// runClaves lista las API Keys aceptadas: las de -claves y la de -key, que
+// aparece como el cliente principal. La identidad es la que queda en el
+// ledger (api_key) para cada NCF.
+//
+//	ecf-sequence.exe claves [-claves=C:\path\claves.json]
+func runClaves() int {
+	keys := currentSettings().keys.Keys()
+	if len(keys) == 0 {
+		fmt.Println("No hay claves configuradas; cree una con crear-clave.")
+		return 0
+	}
+	now := time.Now()
+	fmt.Printf("%-20s %-16s %-12s %s\n", "CLIENTE", "IDENTIDAD", "VENCE", "PERMISOS")
+	for _, k := range keys {
+		vence := "-"
+		if k.Expira != nil {
+			vence = k.Expira.Add(-time.Second).Format("2006-01-02")
+			if k.Expired(now) {
+				vence += " (vencida)"
+			}
+		}
+		fmt.Printf("%-20s %-16s %-12s %s\n", k.Cliente, k.Identity(), vence, strings.Join(k.Permisos, ", "))
+	}
+	return 0
+}
+
+// runCrearClave genera una API Key para un cliente y la agrega al archivo de
+// -claves, que se crea si no existe. El archivo solo guarda el hash: la clave
+// en claro se muestra esta única vez. El servicio la acepta después de
+// recargar la configuración.
+//
+//	ecf-sequence.exe crear-clave -claves=C:\path\claves.json -cliente=caja-03 -permisos=asignar:E32,asignar:E34 [-expira=2026-12-31]
+func runCrearClave() int {
+	if *clavesF == "" || *clienteF == "" || *permisoF == "" {
+		fmt.Println("Uso: ecf-sequence.exe crear-clave -claves=C:\\path\\claves.json -cliente=NOMBRE -permisos=leer,asignar:E32 [-expira=AAAA-MM-DD]")
+		return 2
+	}
+	if *clienteF == legacyClient {
+		fmt.Printf("El cliente %s está reservado para la clave de -key; use otro nombre.\n", legacyClient)
+		return 2
+	}
+	nueva := apikey.Key{Cliente: *clienteF}
+	for _, p := range strings.Split(*permisoF, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			nueva.Permisos = append(nueva.Permisos, p)
+		}
+	}
+	if *expiraF != "" {
+		dia, err := time.ParseInLocation("2006-01-02", *expiraF, time.Local)
+		if err != nil {
+			fmt.Printf("Fecha de -expira inválida %q, se esperaba AAAA-MM-DD\n", *expiraF)
+			return 2
+		}
+		// Vale hasta el final de ese día
+		expira := dia.AddDate(0, 0, 1)
+		nueva.Expira = &expira
+	}
+
+	key, err := apikey.Generate()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	nueva.Hash = apikey.Hash(key)
+	claves := append(currentSettings().claves, nueva)
+	if _, err := newKeyRegistry(currentSettings().apiKey, claves); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if err := apikey.Save(*clavesF, claves); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Clave de %s (guárdela ahora, no se puede volver a mostrar):\n\n  %s\n\n", nueva.Cliente, key)
+	fmt.Printf("Identidad en el ledger: %s\n", nueva.Identity())
+	fmt.Println("Para que el servicio la acepte recargue la configuración: systemctl reload ecf-sequence,")
+	fmt.Printf("sc control %s paramchange o POST /api/configuracion/recargar.\n", serviceName)
+	return 0
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"ecf-sequence-server/internal/config"
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/dgii"
+	"ecf-sequence-server/internal/store"
+)
+
+// defaultConfigName es el archivo de configuración que se busca junto al
+// ejecutable cuando no se indica -config
+const defaultConfigName = "ecf-sequence.yaml"
+
+// configSources guarda de dónde salió cada flag (ver config.Load); lo usan
+// los mensajes de validación
+var configSources map[string]string
+
+// configPath devuelve el archivo de configuración: el de -config, el de
+// ECF_CONFIG o ecf-sequence.yaml junto al ejecutable si existe
+func configPath() string {
+	if *configF != "" {
+		return *configF
+	}
+	if path := os.Getenv(config.EnvName("config")); path != "" {
+		return path
+	}
+	if exe, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(exe), defaultConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig completa los flags con el archivo de configuración y las
+// variables ECF_* y valida los valores que quedaron. Devuelve el origen de
+// cada flag y todos los errores, cada uno con el campo que lo causó. Si todo
+// valida deja en uso la parte recargable (ver currentSettings).
+func loadConfig() (map[string]string, []error) {
+	sources, errs := config.Load(flag.CommandLine, configPath(), os.Environ(), "config")
+	configSources = sources
+	if len(errs) > 0 {
+		return sources, errs
+	}
+	live, errs := newLiveSettings(flag.CommandLine, sources)
+	errs = append(errs, validateConfig()...)
+	if len(errs) > 0 {
+		return sources, errs
+	}
+	settings.Store(live)
+	loadedValues = flagValues(flag.CommandLine)
+	return sources, nil
+}
+
+// fieldError arma el error de validación del flag campo
+func fieldError(campo string, format string, args ...interface{}) error {
+	return &config.FieldError{Campo: campo, Origen: configSources[campo], Err: fmt.Errorf(format, args...)}
+}
+
+// validateConfig revisa los valores de los flags que no dependen del modo en
+// que se corre (servicio o subcomando) y que no se recargan; los recargables
+// los revisa newLiveSettings.
+func validateConfig() []error {
+	var errs []error
+	check := func(ok bool, campo, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fieldError(campo, format, args...))
+		}
+	}
+	exists := func(campo, path string) {
+		if path != "" {
+			_, err := os.Stat(path)
+			check(err == nil, campo, "no se puede leer %s: %v", path, err)
+		}
+	}
+	dirExists := func(campo, path string) {
+		if dir := filepath.Dir(path); path != "" {
+			info, err := os.Stat(dir)
+			check(err == nil && info.IsDir(), campo, "el directorio %s no existe", dir)
+		}
+	}
+
+	if _, err := store.Kind(*storeF); err != nil {
+		errs = append(errs, fieldError("almacen", "%v", err))
+	}
+	exists("dbf", *dbfPath)
+
+	n, err := strconv.Atoi(*port)
+	check(err == nil && n > 0 && n < 65536, "port", "puerto inválido %q", *port)
+	if *listenF != "" {
+		_, p, err := net.SplitHostPort(*listenF)
+		n, perr := strconv.Atoi(p)
+		check(err == nil && perr == nil && n >= 0 && n < 65536, "escuchar", "dirección inválida %q, se esperaba host:puerto", *listenF)
+	}
+	switch {
+	case (*tlsCert == "") != (*tlsKey == ""):
+		campo := "tls-clave"
+		if *tlsCert == "" {
+			campo = "tls-certificado"
+		}
+		errs = append(errs, fieldError(campo, "HTTPS necesita tls-certificado y tls-clave"))
+	case *tlsCert != "":
+		_, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		check(err == nil, "tls-certificado", "%v", err)
+	}
+
+	if *ctaPath != "" {
+		_, err := dbf.LoadPartitions(*ctaPath)
+		check(err == nil, "cta", "%v", err)
+	}
+	if *codePage != "" {
+		err := dbf.CheckEncoding(*codePage)
+		check(err == nil, "pagina-codigos", "%v", err)
+	}
+	if *rncF != "" {
+		check(dgii.ValidRNC(*rncF), "rnc", "RNC inválido %q", *rncF)
+	}
+
+	check(*resTTL > 0, "reserva-ttl", "tiene que ser mayor que cero")
+	check(*idemTTL > 0, "idempotencia-ttl", "tiene que ser mayor que cero")
+	check(*lockWait > 0, "bloqueo-timeout", "tiene que ser mayor que cero")
+	check(*ledgerMB > 0, "ledger-segmento", "tiene que ser mayor que cero")
+	check(*snapInt >= 0, "respaldo-intervalo", "no puede ser negativo (0 desactiva los respaldos)")
+	check(*snapHrs >= 0, "respaldo-horas", "no puede ser negativo")
+	if policy := snapshotPolicy(*snapInt); *snapInt > 0 {
+		check(policy.Diarias >= policy.Horarias, "respaldo-dias", "los %d días tienen que cubrir las %v de respaldo-horas", *snapDays, *snapHrs)
+	}
+
+	dirExists("log-secuencias", *seqLog)
+	return errs
+}
+
+// requireService revisa lo que el servicio necesita para arrancar y los
+// subcomandos no siempre: el almacén y la API Key
+func requireService() []error {
+	var errs []error
+	kind, _ := store.Kind(*storeF)
+	if kind == store.KindDBF && *dbfPath == "" {
+		errs = append(errs, fieldError("dbf", "requerido con almacen=dbf"))
+	}
+	if kind == store.KindBolt && *boltPath == "" {
+		errs = append(errs, fieldError("almacen-archivo", "requerido con almacen=bolt"))
+	}
+	if s := currentSettings(); s == nil || s.keys == nil || s.keys.Len() == 0 {
+		errs = append(errs, fieldError("key", "requerida (en el archivo de configuración, en %s, con key-archivo o las de claves)", config.EnvName("key")))
+	}
+	return errs
+}
+
+// listenAddr es la dirección donde escucha el servidor: -escuchar o todas las
+// interfaces en -port
+func listenAddr() string {
+	if *listenF != "" {
+		return *listenF
+	}
+	return ":" + *port
+}
+
+// secretFlags son los flags cuyo valor no se muestra
+var secretFlags = map[string]bool{"key": true}
+
+// runConfigCheck muestra la configuración efectiva, de dónde salió cada
+// valor y los errores, sin arrancar el servicio.
+//
+//	ecf-sequence.exe config check [-config=C:\path\ecf-sequence.yaml]
+func runConfigCheck() int {
+	sources, errs := loadConfig()
+	if len(errs) == 0 {
+		errs = requireService()
+	}
+	if path := configPath(); path != "" {
+		fmt.Printf("Archivo de configuración: %s\n\n", path)
+	} else {
+		fmt.Printf("Sin archivo de configuración (se busca %s junto al ejecutable)\n\n", defaultConfigName)
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "(oculta)"
+		}
+		fmt.Printf("%-20s %-40s %s\n", f.Name, value, sources[f.Name])
+	})
+	fmt.Println()
+	if len(errs) > 0 {
+		fmt.Printf("La configuración tiene %d error(es):\n", len(errs))
+		for _, err := range errs {
+			fmt.Printf("  %v\n", err)
+		}
+		return 1
+	}
+	fmt.Println("Configuración válida.")
+	return 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/ncf"
+)
+
+// counterStatus es la respuesta de /api/contador: lo que entregaría la
+// próxima asignación de tipo/cta
+type counterStatus struct {
+	Type               string `json:"type"`
+	CTA                string `json:"cta"`
+	NextSequence       string `json:"nextSequence"`
+	NextSequenceNumber string `json:"nextSequenceNumber"`
+}
+
+// handleCounter consulta o ajusta el contador de un tipo y cuenta:
+//
+//	GET  /api/contador?type=E32&cta=A          próximo NCF, sin asignarlo
+//	POST /api/contador {"type","cta","numero"}  deja el contador en numero
+//
+// El ajuste es para continuar la numeración de otro sistema. No puede bajar
+// de lo ya emitido (marcas de emisión del almacén) y espera, como una
+// asignación, a que el servicio no esté en pausa.
+func (m *apiServerService) handleCounter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !m.authorized(w, r, apikey.ScopeRead) {
+			return
+		}
+		tipo, cta := r.URL.Query().Get("type"), strings.ToUpper(r.URL.Query().Get("cta"))
+		if cta == "" {
+			cta = "A"
+		}
+		if _, err := ncf.Lookup(tipo); err != nil {
+			writeJSONError(w, http.StatusBadRequest, errCodeUnknownType, err.Error())
+			return
+		}
+		m.writeCounter(w, tipo, cta)
+
+	case http.MethodPost:
+		if !m.authorized(w, r, apikey.ScopeAdmin) {
+			return
+		}
+		var req struct {
+			Type   string `json:"type"`
+			CTA    string `json:"cta"`
+			Numero *int64 `json:"numero"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Numero == nil {
+			http.Error(w, "Se requieren type y numero", http.StatusBadRequest)
+			return
+		}
+		if _, err := ncf.Lookup(req.Type); err != nil {
+			writeJSONError(w, http.StatusBadRequest, errCodeUnknownType, err.Error())
+			return
+		}
+		if req.CTA = strings.ToUpper(req.CTA); req.CTA == "" {
+			req.CTA = "A"
+		}
+		done, ok := m.beginAllocation(w)
+		if !ok {
+			return
+		}
+		err := m.store.Adjust(req.Type, req.CTA, *req.Numero)
+		done()
+		if err != nil {
+			m.store.Log(fmt.Sprintf("Error ajustando %s CTA %s a %d (%s): %v", req.Type, req.CTA, *req.Numero, clientName(r), err))
+			if errors.Is(err, dbf.ErrCounterRollback) {
+				// Es el pedido el que bajaría el contador, no el DBF
+				writeJSONError(w, http.StatusConflict, errCodeCounterRollback, err.Error())
+				return
+			}
+			writeAllocationError(w, err)
+			return
+		}
+		m.store.Log(fmt.Sprintf("Contador de %s CTA %s ajustado a %d por %s", req.Type, req.CTA, *req.Numero, clientName(r)))
+		m.writeCounter(w, req.Type, req.CTA)
+
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeCounter responde el counterStatus de tipo/cta
+func (m *apiServerService) writeCounter(w http.ResponseWriter, tipo, cta string) {
+	sequence, num, err := m.store.Peek(tipo, cta)
+	if err != nil {
+		writeAllocationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counterStatus{Type: tipo, CTA: cta, NextSequence: sequence, NextSequenceNumber: fmt.Sprintf("%d", num)})
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/idempotency"
+	"ecf-sequence-server/internal/ncf"
+)
+
+// Códigos de error legibles por máquina que acompañan las respuestas de error
+// de asignación, para que el POS no tenga que interpretar el mensaje.
+const (
+	errCodeTypeNotFound         = "TYPE_NOT_FOUND"
+	errCodeUnknownType          = "UNKNOWN_TYPE"
+	errCodeInvalidCTA           = "INVALID_CTA"
+	errCodeRangeExhausted       = "RANGE_EXHAUSTED"
+	errCodeAuthorizationExpired = "AUTHORIZATION_EXPIRED"
+	errCodeCTANotPartitioned    = "CTA_NOT_PARTITIONED"
+	errCodeFieldOverflow        = "FIELD_OVERFLOW"
+	errCodeNCFNotFound          = "NCF_NOT_FOUND"
+	errCodeDBFLocked            = "DBF_LOCKED"
+	errCodeCounterRollback      = "COUNTER_ROLLBACK"
+	errCodeLedgerUnavailable    = "LEDGER_UNAVAILABLE"
+	errCodeInternal             = "INTERNAL_ERROR"
+)
+
+// maxBatchSize es el límite por defecto (-lote-max) de cuántos números se
+// pueden reservar en una sola llamada
+const maxBatchSize = 1000
+
+// maxIdempotencyKeyLen limita el tamaño del header Idempotency-Key
+const maxIdempotencyKeyLen = 255
+
+// routes arma el mux con todos los endpoints del servicio, detrás de la
+// identificación de la API Key (ver identify).
+func (m *apiServerService) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tipos", m.handleTipos)
+	mux.HandleFunc("/api/sequence", m.handleSequence)
+	mux.HandleFunc("/api/sequences/batch", m.handleSequenceBatch)
+	mux.HandleFunc("/api/sequence/reserve", m.handleReserve)
+	mux.HandleFunc("/api/sequence/confirm", m.handleConfirm)
+	mux.HandleFunc("/api/sequence/void", m.handleVoid)
+	mux.HandleFunc("/api/ledger", m.handleLedger)
+	mux.HandleFunc("/api/reportes/608", m.handleReport608)
+	mux.HandleFunc("/api/respaldos", m.handleSnapshots)
+	mux.HandleFunc("/api/respaldos/restaurar", m.handleRestoreSnapshot)
+	mux.HandleFunc("/api/contador", m.handleCounter)
+	mux.HandleFunc("/api/pausa", m.handlePause)
+	mux.HandleFunc("/api/configuracion/recargar", m.handleReload)
+	mux.HandleFunc("/health", m.handleHealth)
+	return identify(mux)
+}
+
+// sequenceRequest es el cuerpo común de las solicitudes de asignación
+type sequenceRequest struct {
+	Type string `json:"type"`
+	CTA  string `json:"cta"` // A: Default  - B: Cuenta Izquierda
+}
+
+// decodeSequenceRequest lee y valida un sequenceRequest; si falla ya respondió
+func decodeSequenceRequest(w http.ResponseWriter, r *http.Request) (sequenceRequest, bool) {
+	var req sequenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return req, false
+	}
+	if _, err := ncf.Lookup(req.Type); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeUnknownType, err.Error())
+		return req, false
+	}
+
+	//validar CTA y is es B o A y si no hay valor que sea A por default
+	if req.CTA == "" || (req.CTA != "A" && req.CTA != "B") {
+		req.CTA = "A"
+	}
+	return req, true
+}
+
+func (m *apiServerService) handleTipos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, apikey.ScopeRead) {
+		return
+	}
+	tipos, err := m.store.GetRecordTypes()
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error obteniendo tipos: %v", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if m.monitor != nil {
+		for i := range tipos {
+			tipos[i].BajoMinimo = m.monitor.Low(tipos[i].NCFTipo)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tipos)
+}
+
+func (m *apiServerService) handleSequence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, "") {
+		return
+	}
+	done, ok := m.beginAllocation(w)
+	if !ok {
+		return
+	}
+	defer done()
+	req, ok := decodeSequenceRequest(w, r)
+	if !ok || !m.authorized(w, r, apikey.Allocate(req.Type)) {
+		return
+	}
+
+	// El ledger se escribe dentro de allocate para que un reintento con la
+	// misma Idempotency-Key no duplique el registro. Si el ledger falla la
+	// clave no se guarda y el reintento recibe otro número.
+	allocate := func() (string, int64, error) {
+		sequence, num, err := m.store.GetSequence(req.Type, req.CTA)
+		if err != nil {
+			return "", 0, err
+		}
+		if err := m.recordIssued(r, req.Type, req.CTA, []string{sequence}, num, ""); err != nil {
+			return "", 0, err
+		}
+		return sequence, num, nil
+	}
+
+	// Con Idempotency-Key, un reintento del POS recibe el mismo NCF
+	var sequence string
+	var num int64
+	var err error
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		if len(key) > maxIdempotencyKeyLen {
+			http.Error(w, "Idempotency-Key demasiado larga", http.StatusBadRequest)
+			return
+		}
+		var entry idempotency.Entry
+		var replayed bool
+		entry, replayed, err = m.idempotency.Do(idempotencyScope(r, req.Type, req.CTA), key, allocate)
+		if err != nil && entry.Sequence != "" {
+			// El número ya se emitió; se entrega aunque no se haya podido recordar
+			m.store.Log(fmt.Sprintf("Error guardando Idempotency-Key de %s: %v", entry.Sequence, err))
+			err = nil
+		}
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+			m.store.Log(fmt.Sprintf("Replayed sequence: %s (Idempotency-Key %s, cliente %s)", entry.Sequence, key, clientName(r)))
+		}
+		sequence, num = entry.Sequence, entry.Number
+	} else {
+		sequence, num, err = allocate()
+	}
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error generando secuencia para %s: %v", clientName(r), err))
+		writeAllocationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"sequence": sequence, "sequenceNumber": fmt.Sprintf("%d", num)})
+}
+
+// idempotencyScope limita una Idempotency-Key a la API Key, el tipo y la
+// cuenta. La API Key se guarda como hash para no dejarla en claro en el
+// archivo.
+func idempotencyScope(r *http.Request, tipo, cta string) string {
+	return apiKeyIdentity(r.Header.Get("X-API-Key")) + "|" + tipo + "|" + cta
+}
+
+// handleSequenceBatch reserva "count" números contiguos con una sola escritura
+// del DBF, pensado para los procesos de facturación por lotes.
+func (m *apiServerService) handleSequenceBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, "") {
+		return
+	}
+	var req struct {
+		Type  string `json:"type"`
+		CTA   string `json:"cta"`
+		Count int    `json:"count"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return
+	}
+	if _, err := ncf.Lookup(req.Type); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errCodeUnknownType, err.Error())
+		return
+	}
+	if !m.authorized(w, r, apikey.Allocate(req.Type)) {
+		return
+	}
+	if batchMax := currentSettings().batchMax; req.Count < 1 || req.Count > batchMax {
+		http.Error(w, fmt.Sprintf("count debe estar entre 1 y %d", batchMax), http.StatusBadRequest)
+		return
+	}
+	if req.CTA == "" || (req.CTA != "A" && req.CTA != "B") {
+		req.CTA = "A"
+	}
+
+	done, ok := m.beginAllocation(w)
+	if !ok {
+		return
+	}
+	defer done()
+	sequences, first, err := m.store.GetSequences(req.Type, req.CTA, req.Count)
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error generando lote de secuencias para %s: %v", clientName(r), err))
+		writeAllocationError(w, err)
+		return
+	}
+	if err := m.recordIssued(r, req.Type, req.CTA, sequences, first, ""); err != nil {
+		writeAllocationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sequences":           sequences,
+		"count":               len(sequences),
+		"firstSequenceNumber": fmt.Sprintf("%d", first),
+		"lastSequenceNumber":  fmt.Sprintf("%d", first+int64(len(sequences))-1),
+	})
+}
+
+// handleHealth falla si algún contador del DBF retrocedió: el servicio está
+// arriba pero no puede asignar esos tipos sin riesgo de repetir NCF. En pausa
+// responde 503 con status "paused".
+func (m *apiServerService) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if status := m.pauseStatus(); status.Pausado {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "paused", "desde": status.Desde, "origen": status.Origen})
+		return
+	}
+	rollbacks, err := m.store.Rollbacks()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unhealthy", "error": err.Error()})
+		return
+	}
+	if len(rollbacks) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "unhealthy", "rollbacks": rollbacks})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+}
+
+// writeAllocationError traduce los errores tipados del Manager a un status HTTP
+// y un código de error estable. Lo que no se reconoce sigue siendo un 500.
+func writeAllocationError(w http.ResponseWriter, err error) {
+	status, code := http.StatusInternalServerError, errCodeInternal
+	switch {
+	case errors.Is(err, dbf.ErrRangeExhausted):
+		status, code = http.StatusConflict, errCodeRangeExhausted
+	case errors.Is(err, dbf.ErrAuthorizationExpired):
+		status, code = http.StatusGone, errCodeAuthorizationExpired
+	case errors.Is(err, dbf.ErrCTANotPartitioned):
+		status, code = http.StatusConflict, errCodeCTANotPartitioned
+	case errors.Is(err, dbf.ErrFieldOverflow):
+		// Es un problema de estructura del DBF, no del cliente
+		code = errCodeFieldOverflow
+	case errors.Is(err, dbf.ErrLockTimeout):
+		// El ERP tiene el registro tomado; el cliente puede reintentar
+		status, code = http.StatusServiceUnavailable, errCodeDBFLocked
+		w.Header().Set("Retry-After", "1")
+	case errors.Is(err, dbf.ErrCounterRollback):
+		// Hace falta que un administrador corrija el DBF
+		status, code = http.StatusServiceUnavailable, errCodeCounterRollback
+	case errors.Is(err, errLedgerUnavailable):
+		// El número se consumió pero no se entrega sin su registro
+		status, code = http.StatusServiceUnavailable, errCodeLedgerUnavailable
+	case errors.Is(err, dbf.ErrSuspended):
+		status, code = http.StatusServiceUnavailable, errCodeServicePaused
+		w.Header().Set("Retry-After", pauseRetryAfter)
+	case errors.Is(err, dbf.ErrInvalidCTA):
+		status, code = http.StatusBadRequest, errCodeInvalidCTA
+	case errors.Is(err, ncf.ErrUnknownType):
+		status, code = http.StatusBadRequest, errCodeUnknownType
+	case errors.Is(err, dbf.ErrTypeNotFound):
+		status, code = http.StatusNotFound, errCodeTypeNotFound
+	}
+	writeJSONError(w, status, code, err.Error())
+}
+
+// writeJSONError responde {"error": ..., "code": ...} con el status indicado.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": code})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/ledger"
+	"ecf-sequence-server/internal/reservation"
+)
+
+// apiKeyIdentity identifica la API Key por el principio de su hash (ver
+// apikey.Key.Identity), para no dejarla en claro en el ledger ni en las
+// claves de idempotencia.
+func apiKeyIdentity(key string) string {
+	return apikey.Hash(key)[:16]
+}
+
+// requestRecord arma un registro del ledger con los datos del cliente
+func requestRecord(r *http.Request, evento, tipo, cta string) ledger.Record {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	return ledger.Record{
+		Evento:    evento,
+		Tipo:      tipo,
+		CTA:       cta,
+		APIKey:    apiKeyIdentity(r.Header.Get("X-API-Key")),
+		Cliente:   clientName(r),
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// ledgerRetryDelays son las esperas entre los intentos de escribir en el
+// ledger antes de darlo por caído
+var ledgerRetryDelays = []time.Duration{50 * time.Millisecond, 200 * time.Millisecond}
+
+// errLedgerUnavailable envuelve los errores de escritura del ledger que
+// hacen fallar una solicitud (ver writeAllocationError)
+var errLedgerUnavailable = errors.New("ledger no disponible")
+
+// appendLedger es el único camino de escritura al ledger: reintenta con
+// ledgerRetryDelays (ledger.Ledger.Append no deja registros a medias, así que
+// reintentar no los duplica) y, si no lo logra, devuelve un error que envuelve
+// errLedgerUnavailable.
+func (m *apiServerService) appendLedger(records ...ledger.Record) error {
+	_, err := m.ledger.Append(records...)
+	for i := 0; err != nil && i < len(ledgerRetryDelays); i++ {
+		time.Sleep(ledgerRetryDelays[i])
+		_, err = m.ledger.Append(records...)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errLedgerUnavailable, err)
+	}
+	return nil
+}
+
+// recordIssued anota en el ledger los NCF recién asignados, antes de
+// responder. Si el ledger no los acepta el NCF no se entrega: el número ya
+// se consumió y queda como salto, cubierto por el journal y la marca de
+// emisión del almacén, pero un NCF fuera del ledger no llegaría al 608.
+func (m *apiServerService) recordIssued(r *http.Request, tipo, cta string, sequences []string, first int64, token string) error {
+	if m.ledger == nil {
+		return nil
+	}
+	records := make([]ledger.Record, len(sequences))
+	for i, ncf := range sequences {
+		rec := requestRecord(r, ledger.EventIssued, tipo, cta)
+		rec.NCF = ncf
+		rec.Numero = first + int64(i)
+		rec.Token = token
+		rec.Fecha = time.Now()
+		records[i] = rec
+	}
+	if err := m.appendLedger(records...); err != nil {
+		m.store.Log(fmt.Sprintf("Consumidos sin entregar %s a %s (%d) para %s: %v",
+			sequences[0], sequences[len(sequences)-1], len(sequences), records[0].Cliente, err))
+		return err
+	}
+	if len(sequences) == 1 {
+		m.store.Log(fmt.Sprintf("Entregado %s a %s", sequences[0], records[0].Cliente))
+	} else {
+		m.store.Log(fmt.Sprintf("Entregados %s a %s (%d) a %s", sequences[0], sequences[len(sequences)-1], len(sequences), records[0].Cliente))
+	}
+	return nil
+}
+
+// recordReservation anota en el ledger el cierre de una reserva. r es nil
+// cuando la anulación la hace el servicio por vencimiento.
+func (m *apiServerService) recordReservation(r *http.Request, evento string, res reservation.Reservation) error {
+	if m.ledger == nil {
+		return nil
+	}
+	var rec ledger.Record
+	if r != nil {
+		rec = requestRecord(r, evento, res.Tipo, res.CTA)
+	} else {
+		rec = ledger.Record{Evento: evento, Tipo: res.Tipo, CTA: res.CTA}
+	}
+	rec.NCF = res.NCF
+	rec.Numero = res.Numero
+	rec.Token = res.Token
+	rec.Factura = res.Factura
+	rec.Motivo = res.Motivo
+	if err := m.appendLedger(rec); err != nil {
+		m.store.Log(fmt.Sprintf("Error escribiendo ledger para %s: %v", res.NCF, err))
+		return err
+	}
+	return nil
+}
+
+// handleLedger devuelve el historial de un NCF: GET /api/ledger?ncf=E310000000001
+func (m *apiServerService) handleLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, apikey.ScopeRead) {
+		return
+	}
+	ncf := r.URL.Query().Get("ncf")
+	if ncf == "" {
+		http.Error(w, "Falta el parámetro ncf", http.StatusBadRequest)
+		return
+	}
+	if m.ledger == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeInternal, "ledger no configurado")
+		return
+	}
+	records, err := m.ledger.Lookup(ncf)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	if len(records) == 0 {
+		writeJSONError(w, http.StatusNotFound, errCodeNCFNotFound, fmt.Sprintf("%s no figura en el ledger", ncf))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// ledgerHighWater calcula, a partir del ledger, el mayor número emitido de cada
+// tipo y CTA. Es la segunda fuente de marcas del Manager: sigue ahí aunque se
+// pierdan el DBF y los archivos que viven a su lado.
+func ledgerHighWater(dir string) ([]dbf.HighWater, error) {
+	highest := make(map[[2]string]int64)
+	err := ledger.ScanDir(dir, func(rec ledger.Record) error {
+		key := [2]string{rec.Tipo, rec.CTA}
+		if rec.Evento == ledger.EventIssued && rec.Numero > highest[key] {
+			highest[key] = rec.Numero
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo marcas del ledger: %v", err)
+	}
+	marks := make([]dbf.HighWater, 0, len(highest))
+	for key, n := range highest {
+		marks = append(marks, dbf.HighWater{Tipo: key[0], CTA: key[1], Numero: n})
+	}
+	return marks, nil
+}
@@ -2,175 +2,120 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"golang.org/x/sys/windows/svc"
-	"golang.org/x/sys/windows/svc/debug"
-
+	"ecf-sequence-server/internal/alert"
 	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/idempotency"
+	"ecf-sequence-server/internal/ledger"
+	"ecf-sequence-server/internal/ncf"
+	"ecf-sequence-server/internal/reservation"
+	"ecf-sequence-server/internal/store"
 )
 
 const serviceName = "ECFSequence"
 const displayName = "ECF Sequence Service"
 const serviceDescription = "Servicio de generación de secuencias E-CF"
 
-// serviceFlags son los flags que parseamos desde la línea de comandos.
+// serviceFlags son los flags que parseamos desde la línea de comandos. Todos
+// se pueden dar también en el archivo de -config o como variables ECF_* (ver
+// config.go).
+// Los que se pueden recargar (key, key-archivo, claves, lote-max, cuerpo-max,
+// log, webhook, histeresis) no se leen directamente: ver currentSettings.
 var (
-	dbfPath = flag.String("dbf", "", "Ruta al archivo DBF")
-	port    = flag.String("port", "8080", "Puerto para el servidor")
-	apiKey  = flag.String("key", "", "API Key para autenticación")
-	debugF  = flag.Bool("debug", false, "Ejecutar en modo debug (no como servicio)")
+	configF  = flag.String("config", "", "Archivo de configuración YAML (por defecto ecf-sequence.yaml junto al ejecutable, si existe)")
+	dbfPath  = flag.String("dbf", "", "Ruta al archivo DBF")
+	port     = flag.String("port", "8080", "Puerto para el servidor")
+	apiKey   = flag.String("key", "", "API Key para autenticación (mejor en el archivo de configuración o en ECF_KEY: en la línea de comandos la ve cualquier usuario)")
+	keyFile  = flag.String("key-archivo", "", "Archivo que contiene la API Key")
+	clavesF  = flag.String("claves", "", "Archivo JSON con las API Keys de cada cliente y sus permisos, guardadas como hash (ver el subcomando crear-clave)")
+	listenF  = flag.String("escuchar", "", "Dirección donde escucha el servidor, p.ej. 127.0.0.1:8080 (por defecto todas las interfaces en -port)")
+	tlsCert  = flag.String("tls-certificado", "", "Certificado PEM para servir HTTPS (requiere -tls-clave)")
+	tlsKey   = flag.String("tls-clave", "", "Clave privada PEM del certificado de -tls-certificado")
+	logPath  = flag.String("log", "ecf-sequence.log", "Archivo de log del servicio")
+	seqLog   = flag.String("log-secuencias", "sequence.log", "Archivo de log de las asignaciones")
+	batchMax = flag.Int("lote-max", maxBatchSize, "Máximo de números por llamada a /api/sequences/batch")
+	bodyMax  = flag.Int64("cuerpo-max", 1<<20, "Tamaño máximo en bytes del cuerpo de una solicitud")
+	debugF   = flag.Bool("debug", false, "Ejecutar en modo debug (no como servicio)")
+	ctaPath  = flag.String("cta", "", "Ruta al archivo JSON con las particiones de CTA A/B")
+	webhook  = flag.String("webhook", "", "URL que recibe las alertas de stock bajo (POST JSON)")
+	histPct  = flag.Int64("histeresis", 10, "Porcentaje sobre MINIMO que debe recuperarse para rearmar la alerta")
+	resPath  = flag.String("reservas", "", "Archivo de reservas (por defecto reservas.jsonl junto al DBF)")
+	resTTL   = flag.Duration("reserva-ttl", 15*time.Minute, "Tiempo que una reserva espera confirmación antes de anularse")
+	idemPath = flag.String("idempotencia", "", "Archivo de claves Idempotency-Key (por defecto idempotencia.jsonl junto al DBF)")
+	idemTTL  = flag.Duration("idempotencia-ttl", 24*time.Hour, "Tiempo durante el que se recuerda cada Idempotency-Key")
+	ledgerD  = flag.String("ledger", "", "Directorio del ledger de asignaciones (por defecto ledger junto al DBF)")
+	ledgerMB = flag.Int64("ledger-segmento", 16, "Tamaño en MB a partir del cual se rota el segmento del ledger")
+	rncF     = flag.String("rnc", "", "RNC del emisor para los reportes a la DGII")
+	walPath  = flag.String("journal", "", "Journal de asignaciones (por defecto FAC_PF_M.WAL junto al DBF)")
+	hwmPath  = flag.String("marcas", "", "Archivo de marcas de emisión (por defecto FAC_PF_M.HWM junto al DBF)")
+	lockWait = flag.Duration("bloqueo-timeout", dbf.DefaultLockTimeout, "Tiempo máximo de espera por un registro del DBF bloqueado por el ERP")
+	codePage = flag.String("pagina-codigos", "", "Página de códigos del DBF (p.ej. cp850, windows-1252); por defecto la que declara su encabezado")
+	storeF   = flag.String("almacen", store.KindDBF, "Almacén de secuencias: dbf (el DBF del ERP) o bolt (archivo propio, sin FoxPro)")
+	boltPath = flag.String("almacen-archivo", "", "Archivo del almacén bolt (requerido con -almacen=bolt)")
+	snapDir  = flag.String("respaldos", "", "Directorio de respaldos automáticos del DBF (por defecto respaldos junto al DBF)")
+	snapInt  = flag.Duration("respaldo-intervalo", dbf.DefaultSnapshotPolicy.Intervalo, "Se respalda el DBF antes de la primera asignación de cada intervalo (0 desactiva los respaldos)")
+	snapHrs  = flag.Duration("respaldo-horas", dbf.DefaultSnapshotPolicy.Horarias, "Tiempo durante el que se guardan todos los respaldos")
+	snapDays = flag.Int("respaldo-dias", 60, "Días durante los que se guarda el primer respaldo de cada día")
 )
 
-// apiServerService es el "contexto de servicio" que implementa svc.Handler
+// apiServerService es el "contexto de servicio": en Windows implementa
+// svc.Handler (service_windows.go) y en Linux corre bajo systemd
+// (service_unix.go)
 type apiServerService struct {
-	manager *dbf.Manager
-	server  *http.Server
-	done    chan struct{}
-}
-
-// Execute es donde el SCM (Service Control Manager) interactúa con el servicio.
-// Acá escuchamos señales de Start, Stop, Pause, etc. y hacemos lo necesario.
-func (m *apiServerService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
-
-	// cmdsAccepted indica qué señales vamos a aceptar:
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
-
-	// Avisamos al SCM que estamos "iniciando".
-	s <- svc.Status{State: svc.StartPending}
-
-	// Iniciar la goroutine del servidor HTTP
-	go m.runHTTPServer()
-
-	// Avisamos que ya estamos "corriendo" y aceptamos las señales indicadas.
-	s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
-
-	// Bucle principal de escucha de señales
-loop:
-	for {
-		select {
-		// No tenemos un "tick" en este caso, así que solo escuchamos señales del SCM
-		case c := <-r:
-			switch c.Cmd {
-			case svc.Interrogate:
-				// El SCM pregunta "¿cómo estás?" => respondemos con estado actual
-				s <- c.CurrentStatus
-
-			case svc.Stop, svc.Shutdown:
-				// Nos ordenan detener => paramos el servidor y salimos
-				log.Print("Recibida señal de STOP/SHUTDOWN, cerrando el servidor.")
-				m.stopHTTPServer()
-				break loop
-
-			case svc.Pause:
-				// Opcionalmente, podrías pausar el HTTP server, etc.
-				s <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
-
-			case svc.Continue:
-				// Reactivar si se pausó
-				s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
-
-			default:
-				log.Printf("Recibida señal no esperada: %v", c.Cmd)
-			}
-		}
-	}
-
-	// Avisar al SCM que estamos en proceso de detener
-	s <- svc.Status{State: svc.StopPending}
-
-	// Retornamos (fin de Execute => fin de servicio)
-	return false, 0
+	store        store.SequenceStore
+	monitor      *alert.Monitor
+	reservations *reservation.Store
+	idempotency  *idempotency.Store
+	ledger       *ledger.Ledger
+	server       *http.Server
+	done         chan struct{}
+	pause        pauseState
 }
 
-// runHTTPServer arranca el servidor HTTP en una goroutine.
-func (m *apiServerService) runHTTPServer() {
-	mux := http.NewServeMux()
-
-	// Handlers
-	mux.HandleFunc("/api/tipos", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
-			return
-		}
-		// Verificar API Key
-		if r.Header.Get("X-API-Key") != *apiKey {
-			m.manager.Log(fmt.Sprintf("Intento de acceso no autorizado desde %s", r.RemoteAddr))
-			http.Error(w, "No autorizado", http.StatusUnauthorized)
-			return
-		}
-		tipos, err := m.manager.GetRecordTypes()
-		if err != nil {
-			m.manager.Log(fmt.Sprintf("Error obteniendo tipos: %v", err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tipos)
-	})
-
-	mux.HandleFunc("/api/sequence", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
-			return
-		}
-		if r.Header.Get("X-API-Key") != *apiKey {
-			m.manager.Log(fmt.Sprintf("Intento de acceso no autorizado desde %s", r.RemoteAddr))
-			http.Error(w, "No autorizado", http.StatusUnauthorized)
-			return
-		}
-		var req struct {
-			Type string `json:"type"`
-			CTA  string `json:"cta"` // A: Default  - B: Cuenta Izquierda
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Solicitud inválida", http.StatusBadRequest)
-			return
-		}
-		if len(req.Type) != 3 {
-			http.Error(w, "Tipo de secuencia inválido", http.StatusBadRequest)
-			return
-		}
-
-		//validar CTA y is es B o A y si no hay valor que sea A por default
-		if req.CTA == "" || (req.CTA != "A" && req.CTA != "B") {
-			req.CTA = "A"
-		}
-
-		sequence, num, err := m.manager.GetSequence(req.Type, req.CTA)
-		if err != nil {
-			m.manager.Log(fmt.Sprintf("Error generando secuencia: %v", err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"sequence": sequence, "sequenceNumber": fmt.Sprintf("%d", num)})
-	})
-
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-	})
-
+// startHTTPServer abre el puerto y atiende las peticiones en una goroutine.
+// Devuelve error si no se pudo abrir el puerto; m.done se cierra cuando el
+// servidor termina.
+func (m *apiServerService) startHTTPServer() error {
 	m.server = &http.Server{
-		Addr:    ":" + *port,
-		Handler: mux,
+		Addr:    listenAddr(),
+		Handler: limitBody(m.routes()),
+	}
+	ln, err := net.Listen("tcp", m.server.Addr)
+	if err != nil {
+		close(m.done)
+		return fmt.Errorf("error abriendo %s: %v", m.server.Addr, err)
 	}
 
-	log.Printf("Servidor iniciado en puerto %s", *port)
-	m.manager.Log(fmt.Sprintf("Servidor iniciado en puerto %s", *port))
-
-	// Bloqueante hasta que se cierre
-	if err := m.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("Error en servidor HTTP: %v", err)
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
 	}
-	close(m.done) // señal de que hemos salido
+	log.Printf("Servidor iniciado en %s (%s)", m.server.Addr, scheme)
+	m.store.Log(fmt.Sprintf("Servidor iniciado en %s (%s)", m.server.Addr, scheme))
+
+	go func() {
+		// Bloqueante hasta que se cierre
+		if *tlsCert != "" {
+			err = m.server.ServeTLS(ln, *tlsCert, *tlsKey)
+		} else {
+			err = m.server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("Error en servidor HTTP: %v", err)
+		}
+		close(m.done) // señal de que hemos salido
+	}()
+	return nil
 }
 
 // stopHTTPServer detiene el servidor HTTP de forma ordenada.
@@ -180,56 +125,179 @@ func (m *apiServerService) stopHTTPServer() {
 	if err := m.server.Shutdown(ctx); err != nil {
 		log.Printf("Error al cerrar el servidor: %v", err)
 	}
-	<-m.done // esperamos a que la goroutine de ListenAndServe termine
+	<-m.done // esperamos a que la goroutine de Serve termine
 }
 
-// runService permite ejecutar el servicio en modo real (SCM) o debug.
-func runService(name string, isDebug bool, manager *dbf.Manager) {
-	svcHandler := &apiServerService{
-		manager: manager,
-		done:    make(chan struct{}),
-	}
-	if isDebug {
-		// Modo consola normal (debug.Run => no necesita instalarse en Windows)
-		err := debug.Run(name, svcHandler)
-		if err != nil {
-			log.Fatalf("Error corriendo en modo debug: %v", err)
-		}
+// logFile es el archivo de -log al que va el log del servicio
+var logFile *os.File
+
+// reopenLog abre el log en path y dirige ahí el log (en modo debug, también
+// a la consola). Si ya estaba abierto cierra el anterior, así se puede llamar
+// después de que logrotate lo movió o de cambiar -log.
+func reopenLog(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("no se pudo abrir %s: %v", path, err)
+	}
+	if *debugF {
+		log.SetOutput(io.MultiWriter(os.Stderr, f))
 	} else {
-		// Modo servicio normal => Interactúa con el SCM
-		err := svc.Run(name, svcHandler)
-		if err != nil {
-			log.Fatalf("Error corriendo como servicio: %v", err)
-		}
+		log.SetOutput(f)
+	}
+	if logFile != nil {
+		logFile.Close()
 	}
+	logFile = f
+	return nil
 }
 
 func main() {
-	// Parsear flags: -dbf, -port, -key, -debug
-	flag.Parse()
+	// Subcomandos de administración (p.ej. "check-cta") antes que el servicio
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
 
-	// Validar que tengamos la dbf y la key
-	if *dbfPath == "" || *apiKey == "" {
-		// Nota: en modo debug podemos permitir no tenerlos, pero idealmente no.
-		// Si quieres forzar, hazlo:
-		fmt.Println("Uso: ecf-sequence.exe -dbf=C:\\path\\FAC_PF_M.DBF -key=XYZ [opciones]")
+	// Parsear flags y completarlos con el archivo de configuración y el entorno
+	flag.Parse()
+	_, errs := loadConfig()
+	errs = append(errs, requireService()...)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		fmt.Println("Uso: ecf-sequence.exe -config=C:\\path\\ecf-sequence.yaml")
+		fmt.Println("     ecf-sequence.exe -dbf=C:\\path\\FAC_PF_M.DBF [opciones], con la API Key en ECF_KEY")
+		fmt.Println("Revise la configuración con: ecf-sequence.exe config check")
 		os.Exit(1)
 	}
+	kind, _ := store.Kind(*storeF)
 
 	// Abrir archivo de log (opcional) o logs a stdout
-	f, err := os.OpenFile("ecf-sequence.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	live := currentSettings()
+	if err := reopenLog(live.logPath); err != nil {
+		log.Fatal(err)
+	}
+	defer logFile.Close()
+
+	// Abrir el almacén con el monitor de stock observando cada asignación
+	var seqStore store.SequenceStore
+	monitor := alert.NewMonitor(alert.Config{
+		WebhookURL:    live.webhook,
+		HysteresisPct: live.histeresis,
+		Logf:          func(msg string) { seqStore.Log(msg) },
+	})
+	// El ledger aporta sus propias marcas de emisión para detectar un almacén restaurado
+	marks, err := ledgerHighWater(ledgerDir())
+	if err != nil {
+		log.Fatalf("Error abriendo ledger: %v", err)
+	}
+	seqStore, err = openStore(kind, monitor, marks)
+	if err != nil {
+		log.Fatalf("Error inicializando almacén %s: %v", kind, err)
+	}
+	defer seqStore.Close()
+	monitor.Start()
+	defer monitor.Stop()
+
+	// Evaluar el stock al arrancar para no esperar a la próxima asignación
+	levels, err := seqStore.StockLevels()
+	if err != nil {
+		log.Printf("No se pudo calcular el stock inicial: %v", err)
+	}
+	for _, level := range levels {
+		monitor.Observe(level)
+	}
+
+	// Abrir el registro de reservas junto al DBF
+	if *resPath == "" {
+		*resPath = filepath.Join(dataDir(), "reservas.jsonl")
+	}
+	reservations, err := reservation.Open(*resPath, *resTTL)
+	if err != nil {
+		log.Fatalf("Error abriendo reservas: %v", err)
+	}
+	defer reservations.Close()
+
+	// Las claves de idempotencia también viven junto al DBF para sobrevivir reinicios
+	if *idemPath == "" {
+		*idemPath = filepath.Join(dataDir(), "idempotencia.jsonl")
+	}
+	idem, err := idempotency.Open(*idemPath, *idemTTL)
 	if err != nil {
-		log.Fatalf("No se pudo abrir ecf-sequence.log: %v", err)
+		log.Fatalf("Error abriendo claves de idempotencia: %v", err)
 	}
-	defer f.Close()
-	log.SetOutput(f)
+	defer idem.Close()
 
-	// Crear Manager DBF
-	manager, err := dbf.NewManager(*dbfPath)
+	// Ledger de asignaciones: cada NCF emitido queda registrado antes de responder
+	ledg, err := ledger.Open(ledgerDir(), *ledgerMB<<20)
 	if err != nil {
-		log.Fatalf("Error inicializando DBF manager: %v", err)
+		log.Fatalf("Error abriendo ledger: %v", err)
 	}
+	defer ledg.Close()
+	ledg.Logf = seqStore.Log
+
+	svcHandler := &apiServerService{
+		store:        seqStore,
+		monitor:      monitor,
+		reservations: reservations,
+		idempotency:  idem,
+		ledger:       ledg,
+		done:         make(chan struct{}),
+	}
+	stopSweeper := svcHandler.startReservationSweeper(time.Minute)
+	defer stopSweeper()
 
 	// Iniciar el servicio (o debug)
-	runService(serviceName, *debugF, manager)
+	runService(serviceName, *debugF, svcHandler)
+}
+
+// openStore abre el almacén de tipo kind con las opciones de los flags. No
+// lo entrega si CTA A y CTA B ya emitieron algún número en común: seguir
+// asignando repetiría NCF (ver el subcomando check-cta).
+func openStore(kind string, monitor *alert.Monitor, marks []dbf.HighWater) (store.SequenceStore, error) {
+	s, err := openStoreKind(kind, monitor, marks)
+	if err != nil {
+		return nil, err
+	}
+	collisions, err := s.CheckCollisions()
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("error revisando colisiones entre CTA A y CTA B: %v", err)
+	}
+	if len(collisions) > 0 {
+		s.Close()
+		c := collisions[0]
+		return nil, fmt.Errorf("%d colisiones entre CTA A y CTA B, la primera en %s %d-%d (%s); configure particiones con -cta y revise con check-cta",
+			len(collisions), c.Tipo, c.Desde, c.Hasta, c.Detalle)
+	}
+	return s, nil
+}
+
+func openStoreKind(kind string, monitor *alert.Monitor, marks []dbf.HighWater) (store.SequenceStore, error) {
+	if kind == store.KindBolt {
+		opts := []store.BoltOption{store.WithStockObserver(monitor.Observe), store.WithHighWater(marks)}
+		if *ctaPath != "" {
+			parts, err := dbf.LoadPartitions(*ctaPath)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, store.WithPartitions(parts))
+		}
+		opts = append(opts, store.WithLogFile(*seqLog))
+		return store.OpenBolt(*boltPath, opts...)
+	}
+
+	manager, err := newManager(append(snapshotOptions(),
+		dbf.WithStockObserver(monitor.Observe),
+		dbf.WithHighWater(marks),
+		dbf.WithRollbackObserver(monitor.Rollback),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	// Con N(8) los contadores no llegan a los 10 dígitos de un e-NCF
+	if w := manager.FieldWidth("NUMERO_1"); w < ncf.SerieE.Digitos {
+		manager.Log(fmt.Sprintf("ADVERTENCIA: NUMERO_1 es N(%d) y los e-NCF usan %d dígitos; ver el subcomando ampliar-contadores", w, ncf.SerieE.Digitos))
+	}
+	return manager, nil
 }
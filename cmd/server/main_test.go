@@ -4,17 +4,28 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"ecf-sequence-server/internal/alert"
+	"ecf-sequence-server/internal/apikey"
 	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/idempotency"
+	"ecf-sequence-server/internal/ledger"
+	"ecf-sequence-server/internal/reservation"
+	"ecf-sequence-server/internal/store"
 )
 
 // Variables globales para pruebas
@@ -33,29 +44,60 @@ func setupTestService(t *testing.T) (*apiServerService, func()) {
 	dbfPath := filepath.Join(currentDir, "..", "..", "DBF", "FAC_PF_M.DBF")
 
 	// Crear manager
-	manager, err := dbf.NewManager(dbfPath)
+	// E32 se parte en dos mitades para poder emitir también por CTA B
+	// El journal y las marcas van a un directorio temporal: cada test tiene su
+	// propio Manager y el DBF de prueba se restaura entre corridas
+	tmp := t.TempDir()
+	manager, err := dbf.NewManager(dbfPath, dbf.WithPartitions([]dbf.Partition{
+		{Tipo: "E32", CTA: "A", Desde: 1, Hasta: 500000},
+		{Tipo: "E32", CTA: "B", Desde: 500001, Hasta: 1000000},
+	}), dbf.WithJournal(filepath.Join(tmp, "FAC_PF_M.WAL")), dbf.WithHighWaterFile(filepath.Join(tmp, "FAC_PF_M.HWM")))
 	if err != nil {
 		t.Fatalf("Error creando manager: %v", err)
 	}
 
 	// Configurar API key para pruebas
-	apiKey = &testAPIKey
+	keys, err := newKeyRegistry(testAPIKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.Store(&liveSettings{apiKey: testAPIKey, keys: keys, batchMax: maxBatchSize, bodyMax: 1 << 20})
+
+	reservations, err := reservation.Open(filepath.Join(t.TempDir(), "reservas.jsonl"), 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Error abriendo reservas: %v", err)
+	}
+
+	idem, err := idempotency.Open(filepath.Join(t.TempDir(), "idempotencia.jsonl"), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Error abriendo claves de idempotencia: %v", err)
+	}
+
+	ledg, err := ledger.Open(filepath.Join(t.TempDir(), "ledger"), 0)
+	if err != nil {
+		t.Fatalf("Error abriendo ledger: %v", err)
+	}
 
 	// Crear servicio (apiServerService)
 	svc := &apiServerService{
-		manager: manager,
-		done:    make(chan struct{}),
+		store:        manager,
+		reservations: reservations,
+		idempotency:  idem,
+		ledger:       ledg,
+		done:         make(chan struct{}),
 	}
 
-	// Configurar rutas HTTP usando un mux
-	mux := http.NewServeMux()
-	setupRoutes(svc, mux)
+	// Usar las mismas rutas que el servicio real
 	svc.server = &http.Server{
-		Handler: mux,
+		Handler: svc.routes(),
 	}
 
 	// Función de limpieza para llamar en defer
 	cleanup := func() {
+		manager.Close()
+		reservations.Close()
+		idem.Close()
+		ledg.Close()
 		if svc.server != nil {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
@@ -66,77 +108,6 @@ func setupTestService(t *testing.T) (*apiServerService, func()) {
 	return svc, cleanup
 }
 
-// setupRoutes configura las rutas HTTP para nuestras pruebas
-func setupRoutes(svc *apiServerService, mux *http.ServeMux) {
-	// Endpoint de salud
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-	})
-
-	// Endpoint de tipos
-	mux.HandleFunc("/api/tipos", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
-			return
-		}
-		if r.Header.Get("X-API-Key") != *apiKey {
-			http.Error(w, "No autorizado", http.StatusUnauthorized)
-			return
-		}
-		tipos, err := svc.manager.GetRecordTypes()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tipos)
-	})
-
-	// Endpoint de secuencias
-	mux.HandleFunc("/api/sequence", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
-			return
-		}
-		if r.Header.Get("X-API-Key") != *apiKey {
-			http.Error(w, "No autorizado", http.StatusUnauthorized)
-			return
-		}
-
-		var req struct {
-			Type string `json:"type"`
-			CTA  string `json:"cta"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Solicitud inválida", http.StatusBadRequest)
-			return
-		}
-
-		if len(req.Type) != 3 {
-			http.Error(w, "Tipo de secuencia inválido", http.StatusBadRequest)
-			return
-		}
-
-		// Si CTA no es "A" o "B", forzamos "A"
-		if req.CTA != "A" && req.CTA != "B" {
-			req.CTA = "A"
-		}
-
-		sequence, seqNum, err := svc.manager.GetSequence(req.Type, req.CTA)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"sequence":       sequence,
-			"sequenceNumber": strconv.FormatInt(seqNum, 10),
-		})
-	})
-}
-
 // ----- TESTS -----
 
 func TestHealthEndpoint(t *testing.T) {
@@ -161,6 +132,272 @@ func TestHealthEndpoint(t *testing.T) {
 	}
 }
 
+func TestHealthEndpointRollback(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	// Una copia del DBF cuyo E34 CTA A ya había emitido hasta 50 según el ledger
+	data, err := os.ReadFile(filepath.Join("..", "..", "DBF", "FAC_PF_M.DBF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "FAC_PF_M.DBF")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := dbf.NewManager(path, dbf.WithHighWater([]dbf.HighWater{{Tipo: "E34", CTA: "A", Numero: 50}}))
+	if err != nil {
+		t.Fatalf("Error creando manager: %v", err)
+	}
+	defer manager.Close()
+	svc.store = manager
+
+	w := httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/health = %d, se esperaba %d", w.Code, http.StatusServiceUnavailable)
+	}
+	var health struct {
+		Status    string         `json:"status"`
+		Rollbacks []dbf.Rollback `json:"rollbacks"`
+	}
+	json.NewDecoder(w.Body).Decode(&health)
+	if health.Status != "unhealthy" || len(health.Rollbacks) != 1 || health.Rollbacks[0].Emitido != 50 {
+		t.Errorf("/health = %+v", health)
+	}
+
+	body, _ := json.Marshal(map[string]string{"type": "E34", "cta": "A"})
+	req := httptest.NewRequest(http.MethodPost, "/api/sequence", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", testAPIKey)
+	w = httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "COUNTER_ROLLBACK") {
+		t.Errorf("POST /api/sequence = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSequenceEndpointBolt(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	// La misma API sobre el almacén bolt, sin DBF
+	bolt, err := store.OpenBolt(filepath.Join(t.TempDir(), "secuencias.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	defer bolt.Close()
+	if err := bolt.PutTipo(dbf.ComprobanteTipo{Numero: "E34", Nombre: "NOTA DE CREDITO", CantSecuen: 2}); err != nil {
+		t.Fatal(err)
+	}
+	svc.store = bolt
+
+	post := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"type": "E34", "cta": "A"})
+		req := httptest.NewRequest(http.MethodPost, "/api/sequence", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", testAPIKey)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+	for _, want := range []string{"E340000000001", "E340000000002"} {
+		if w := post(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("POST /api/sequence = %d %s, se esperaba %s", w.Code, w.Body.String(), want)
+		}
+	}
+	if w := post(); w.Code == http.StatusOK || !strings.Contains(w.Body.String(), "RANGE_EXHAUSTED") {
+		t.Errorf("POST /api/sequence = %d %s con el rango agotado", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tipos", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	w := httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "NOTA DE CREDITO") {
+		t.Errorf("GET /api/tipos = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSnapshotEndpoints(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	data, err := os.ReadFile(filepath.Join("..", "..", "DBF", "FAC_PF_M.DBF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "FAC_PF_M.DBF")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := dbf.NewManager(path, dbf.WithSnapshots(filepath.Join(dir, "respaldos"), dbf.DefaultSnapshotPolicy))
+	if err != nil {
+		t.Fatalf("Error creando manager: %v", err)
+	}
+	defer manager.Close()
+	svc.store = manager
+
+	// La primera asignación respalda el DBF
+	if w := postJSON(svc, "/api/sequence", `{"type":"E34","cta":"A"}`); w.Code != http.StatusOK {
+		t.Fatalf("POST /api/sequence = %d %s", w.Code, w.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/respaldos", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	w := httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, req)
+	var snaps []dbf.Snapshot
+	if err := json.NewDecoder(w.Body).Decode(&snaps); err != nil || w.Code != http.StatusOK || len(snaps) != 1 {
+		t.Fatalf("GET /api/respaldos = %d %+v, %v", w.Code, snaps, err)
+	}
+
+	if w := postJSON(svc, "/api/respaldos/restaurar", `{"nombre":"FAC_PF_M-19990101-000000"}`); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "SNAPSHOT_NOT_FOUND") {
+		t.Errorf("POST /api/respaldos/restaurar = %d %s con un respaldo que no existe", w.Code, w.Body.String())
+	}
+	w = postJSON(svc, "/api/respaldos/restaurar", fmt.Sprintf(`{"nombre":%q}`, snaps[0].Nombre))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"emitido":1`) {
+		t.Errorf("POST /api/respaldos/restaurar = %d %s", w.Code, w.Body.String())
+	}
+	if w := postJSON(svc, "/api/sequence", `{"type":"E34","cta":"A"}`); !strings.Contains(w.Body.String(), "E340000000002") {
+		t.Errorf("POST /api/sequence = %d %s después de restaurar", w.Code, w.Body.String())
+	}
+
+	// El almacén bolt no guarda respaldos
+	bolt, err := store.OpenBolt(filepath.Join(t.TempDir(), "secuencias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+	svc.store = bolt
+	req = httptest.NewRequest(http.MethodGet, "/api/respaldos", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	w = httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotImplemented || !strings.Contains(w.Body.String(), "SNAPSHOTS_UNAVAILABLE") {
+		t.Errorf("GET /api/respaldos = %d %s con bolt", w.Code, w.Body.String())
+	}
+}
+
+func TestPauseEndpoint(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"type":"E32","cta":"A"}`))
+		req.Header.Set("X-API-Key", testAPIKey)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// La pausa espera a que termine la asignación en curso
+	done, ok := svc.beginAllocation(httptest.NewRecorder())
+	if !ok {
+		t.Fatal("beginAllocation() rechazó una asignación sin pausa")
+	}
+	paused := make(chan *httptest.ResponseRecorder)
+	go func() { paused <- do(http.MethodPost, "/api/pausa") }()
+	select {
+	case <-paused:
+		t.Fatal("la pausa no esperó a la asignación en curso")
+	case <-time.After(100 * time.Millisecond):
+	}
+	done()
+	if w := <-paused; w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"pausado":true`) {
+		t.Fatalf("POST /api/pausa = %d %s", w.Code, w.Body.String())
+	}
+
+	w := do(http.MethodPost, "/api/sequence")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" || !strings.Contains(w.Body.String(), "SERVICE_PAUSED") {
+		t.Errorf("POST /api/sequence en pausa = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/sequence/reserve"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /api/sequence/reserve en pausa = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/tipos"); w.Code != http.StatusOK {
+		t.Errorf("GET /api/tipos en pausa = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/health"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "paused") {
+		t.Errorf("/health en pausa = %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/api/pausa"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"pausado":false`) {
+		t.Fatalf("DELETE /api/pausa = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/sequence"); w.Code != http.StatusOK {
+		t.Errorf("POST /api/sequence después de reanudar = %d %s", w.Code, w.Body.String())
+	}
+}
+
+// stuckSuspender es un almacén que no puede soltar sus archivos al pausar
+type stuckSuspender struct{ store.SequenceStore }
+
+func (stuckSuspender) Suspend() error { return errors.New("journal en uso") }
+func (stuckSuspender) Resume() error  { return nil }
+
+func TestCounterEndpoint(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	get := func() counterStatus {
+		req := httptest.NewRequest(http.MethodGet, "/api/contador?type=E32&cta=A", nil)
+		req.Header.Set("X-API-Key", testAPIKey)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/contador = %d %s", w.Code, w.Body.String())
+		}
+		var st counterStatus
+		json.NewDecoder(w.Body).Decode(&st)
+		return st
+	}
+
+	// Consultar no asigna
+	before := get()
+	if again := get(); again != before {
+		t.Errorf("GET /api/contador asignó: %+v y después %+v", before, again)
+	}
+	w := postJSON(svc, "/api/sequence", `{"type":"E32","cta":"A"}`)
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["sequence"] != before.NextSequence {
+		t.Errorf("la asignación entregó %s y la consulta anunciaba %s", resp["sequence"], before.NextSequence)
+	}
+
+	// Ajustar hacia adelante continúa desde ahí
+	if w := postJSON(svc, "/api/contador", `{"type":"E32","cta":"A","numero":100}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "E320000000101") {
+		t.Fatalf("POST /api/contador = %d %s", w.Code, w.Body.String())
+	}
+	// No se puede volver por debajo de lo emitido
+	w = postJSON(svc, "/api/contador", `{"type":"E32","cta":"A","numero":1}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), errCodeCounterRollback) {
+		t.Errorf("POST /api/contador hacia atrás = %d %s", w.Code, w.Body.String())
+	}
+	if st := get(); st.NextSequence != "E320000000101" {
+		t.Errorf("GET /api/contador = %+v después de un ajuste rechazado", st)
+	}
+}
+
+func TestPauseWhenSuspendFails(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+	svc.store = stuckSuspender{svc.store}
+
+	// Las asignaciones se detienen igual: la respuesta dice que está en pausa
+	// y por qué no se liberó el almacén
+	w := postJSON(svc, "/api/pausa", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"pausado":true`) || !strings.Contains(w.Body.String(), "journal en uso") {
+		t.Fatalf("POST /api/pausa = %d %s", w.Code, w.Body.String())
+	}
+	if st := svc.pauseStatus(); !st.Pausado {
+		t.Error("pauseStatus() no refleja la pausa")
+	}
+	if w := postJSON(svc, "/api/sequence", `{"type":"E32","cta":"A"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /api/sequence en pausa = %d", w.Code)
+	}
+}
+
 func TestTiposEndpoint(t *testing.T) {
 	svc, cleanup := setupTestService(t)
 	defer cleanup()
@@ -224,6 +461,46 @@ func TestTiposEndpoint(t *testing.T) {
 	}
 }
 
+func TestTiposEndpointLowStockFlag(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	// Sembrar el monitor como al arrancar el servicio; en el DBF de prueba E31
+	// ya no tiene secuencias disponibles
+	svc.monitor = alert.NewMonitor(alert.Config{Logf: func(string) {}})
+	svc.monitor.Start()
+	levels, err := svc.store.StockLevels()
+	if err != nil {
+		t.Fatalf("StockLevels() error = %v", err)
+	}
+	for _, level := range levels {
+		svc.monitor.Observe(level)
+	}
+	svc.monitor.Stop()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tipos", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	w := httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, req)
+
+	var tipos []dbf.ComprobanteTipo
+	if err := json.NewDecoder(w.Body).Decode(&tipos); err != nil {
+		t.Fatalf("Error decodificando respuesta: %v", err)
+	}
+	for _, tipo := range tipos {
+		switch tipo.NCFTipo {
+		case "E31":
+			if !tipo.BajoMinimo {
+				t.Error("E31 debería estar marcado con bajo_minimo")
+			}
+		case "E32":
+			if tipo.BajoMinimo {
+				t.Error("E32 no debería estar marcado con bajo_minimo")
+			}
+		}
+	}
+}
+
 func TestSequenceEndpoint(t *testing.T) {
 	svc, cleanup := setupTestService(t)
 	defer cleanup()
@@ -253,13 +530,21 @@ func TestSequenceEndpoint(t *testing.T) {
 			cta:        "A",
 			wantStatus: http.StatusMethodNotAllowed,
 		},
+		{
+			name:       "tipo fuera del catálogo DGII",
+			method:     http.MethodPost,
+			apiKey:     testAPIKey,
+			type_:      "XXX", // length=3, pero no es un tipo de la DGII => Bad Request
+			cta:        "A",
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:       "tipo inexistente en DBF",
 			method:     http.MethodPost,
 			apiKey:     testAPIKey,
-			type_:      "XXX", // length=3, pero no existe => Internal Server Error
+			type_:      "E33", // está en el catálogo pero no en el DBF => Not Found
 			cta:        "A",
-			wantStatus: http.StatusInternalServerError,
+			wantStatus: http.StatusNotFound,
 		},
 		{
 			name:       "tipo válido, CTA por defecto (A)",
@@ -345,6 +630,417 @@ func TestSequenceEndpoint(t *testing.T) {
 	}
 }
 
+func TestSequenceEndpointAllocationErrors(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	// En el DBF de prueba E31 ya superó CANTSECUEN y B12 venció en 2019
+	tests := []struct {
+		name       string
+		type_      string
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "rango agotado",
+			type_:      "E31",
+			wantStatus: http.StatusConflict,
+			wantCode:   errCodeRangeExhausted,
+		},
+		{
+			name:       "autorización vencida",
+			type_:      "B12",
+			wantStatus: http.StatusGone,
+			wantCode:   errCodeAuthorizationExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.NewBufferString(fmt.Sprintf(`{"type":"%s","cta":"A"}`, tt.type_))
+			req := httptest.NewRequest(http.MethodPost, "/api/sequence", body)
+			req.Header.Set("X-API-Key", testAPIKey)
+			w := httptest.NewRecorder()
+			svc.server.Handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("[%s] Status code esperado %d, obtuvimos %d", tt.name, tt.wantStatus, w.Code)
+			}
+			var resp map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decodificando respuesta: %v", err)
+			}
+			if resp["code"] != tt.wantCode {
+				t.Errorf("[%s] Código esperado %s, obtuvimos %s", tt.name, tt.wantCode, resp["code"])
+			}
+		})
+	}
+}
+
+func TestSequenceBatchEndpoint(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCount  int
+	}{
+		{
+			name:       "lote válido",
+			body:       `{"type":"E32","cta":"A","count":50}`,
+			wantStatus: http.StatusOK,
+			wantCount:  50,
+		},
+		{
+			name:       "count en cero",
+			body:       `{"type":"E32","cta":"A","count":0}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "count mayor al máximo",
+			body:       fmt.Sprintf(`{"type":"E32","cta":"A","count":%d}`, maxBatchSize+1),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rango agotado",
+			body:       `{"type":"E31","cta":"A","count":10}`,
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/sequences/batch", bytes.NewBufferString(tt.body))
+			req.Header.Set("X-API-Key", testAPIKey)
+			w := httptest.NewRecorder()
+			svc.server.Handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("[%s] Status code esperado %d, obtuvimos %d", tt.name, tt.wantStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Sequences []string `json:"sequences"`
+				Count     int      `json:"count"`
+				First     string   `json:"firstSequenceNumber"`
+				Last      string   `json:"lastSequenceNumber"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Error decodificando respuesta: %v", err)
+			}
+			if resp.Count != tt.wantCount || len(resp.Sequences) != tt.wantCount {
+				t.Errorf("Se esperaban %d secuencias, se obtuvieron %d", tt.wantCount, len(resp.Sequences))
+			}
+			first, _ := strconv.ParseInt(resp.First, 10, 64)
+			last, _ := strconv.ParseInt(resp.Last, 10, 64)
+			if last-first+1 != int64(tt.wantCount) {
+				t.Errorf("El lote %s-%s no es contiguo", resp.First, resp.Last)
+			}
+		})
+	}
+}
+
+// postJSON envía un POST autenticado al handler del servicio
+func postJSON(svc *apiServerService, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("X-API-Key", testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestSequenceIdempotencyKey(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	send := func(body, key string) (map[string]string, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sequence", bytes.NewBufferString(body))
+		req.Header.Set("X-API-Key", testAPIKey)
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp, w
+	}
+
+	first, w := send(`{"type":"E32","cta":"A"}`, "caja-01-000123")
+	if w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("La primera solicitud no debe marcarse como repetida")
+	}
+
+	// El reintento recibe exactamente la misma respuesta
+	retry, w := send(`{"type":"E32","cta":"A"}`, "caja-01-000123")
+	if retry["sequence"] != first["sequence"] || retry["sequenceNumber"] != first["sequenceNumber"] {
+		t.Errorf("El reintento devolvió %v, se esperaba %v", retry, first)
+	}
+	if w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("El reintento debe marcarse con Idempotent-Replayed")
+	}
+
+	// Una clave nueva asigna otro número
+	other, _ := send(`{"type":"E32","cta":"A"}`, "caja-01-000124")
+	if other["sequence"] == first["sequence"] {
+		t.Errorf("Una clave distinta devolvió el mismo NCF %s", other["sequence"])
+	}
+
+	// La misma clave con otra cuenta no devuelve el NCF de CTA A
+	otherCTA, w := send(`{"type":"E32","cta":"B"}`, "caja-01-000123")
+	if otherCTA["sequence"] == first["sequence"] || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("La clave de CTA A se repitió para CTA B: %v", otherCTA)
+	}
+}
+
+func TestReservationLifecycle(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	reserve := func() map[string]string {
+		w := postJSON(svc, "/api/sequence/reserve", `{"type":"E32","cta":"A"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("reserve: status %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Error decodificando respuesta: %v", err)
+		}
+		if resp["token"] == "" || resp["sequence"] == "" || resp["expiresAt"] == "" {
+			t.Fatalf("Respuesta de reserva incompleta: %v", resp)
+		}
+		return resp
+	}
+
+	// Reservar y confirmar con la factura
+	first := reserve()
+	w := postJSON(svc, "/api/sequence/confirm", fmt.Sprintf(`{"token":"%s","invoiceId":"FAC-1"}`, first["token"]))
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: status %d: %s", w.Code, w.Body.String())
+	}
+	var res reservation.Reservation
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.Estado != reservation.StatusConfirmed || res.NCF != first["sequence"] {
+		t.Errorf("confirm devolvió %+v", res)
+	}
+
+	// Una reserva cerrada no se puede volver a confirmar ni anular
+	w = postJSON(svc, "/api/sequence/void", fmt.Sprintf(`{"token":"%s","reason":"04"}`, first["token"]))
+	if w.Code != http.StatusConflict {
+		t.Errorf("void sobre confirmada: status %d, se esperaba %d", w.Code, http.StatusConflict)
+	}
+
+	// Reservar y anular
+	second := reserve()
+	w = postJSON(svc, "/api/sequence/void", fmt.Sprintf(`{"token":"%s","reason":"99"}`, second["token"]))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("void con motivo inválido: status %d, se esperaba %d", w.Code, http.StatusBadRequest)
+	}
+	w = postJSON(svc, "/api/sequence/void", fmt.Sprintf(`{"token":"%s","reason":"04"}`, second["token"]))
+	if w.Code != http.StatusOK {
+		t.Errorf("void: status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postJSON(svc, "/api/sequence/confirm", `{"token":"no-existe","invoiceId":"FAC-2"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("confirm token inexistente: status %d, se esperaba %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestReservationExpiry(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	// Con TTL cero toda reserva queda vencida de inmediato
+	store, err := reservation.Open(filepath.Join(t.TempDir(), "reservas.jsonl"), 0)
+	if err != nil {
+		t.Fatalf("Error abriendo reservas: %v", err)
+	}
+	defer store.Close()
+	svc.reservations = store
+
+	w := postJSON(svc, "/api/sequence/reserve", `{"type":"E32","cta":"A"}`)
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	svc.expireReservations()
+
+	res, err := store.Get(resp["token"])
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if res.Estado != reservation.StatusVoided {
+		t.Errorf("La reserva vencida quedó %s, se esperaba %s", res.Estado, reservation.StatusVoided)
+	}
+}
+
+func TestLedgerRecordsAllocations(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	lookup := func(ncf string) []ledger.Record {
+		req := httptest.NewRequest(http.MethodGet, "/api/ledger?ncf="+ncf, nil)
+		req.Header.Set("X-API-Key", testAPIKey)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ledger %s: status %d: %s", ncf, w.Code, w.Body.String())
+		}
+		var records []ledger.Record
+		json.NewDecoder(w.Body).Decode(&records)
+		return records
+	}
+
+	// Asignación simple: un registro "emitido" con la identidad de la API Key
+	w := postJSON(svc, "/api/sequence", `{"type":"E32","cta":"A"}`)
+	var seq map[string]string
+	json.NewDecoder(w.Body).Decode(&seq)
+	records := lookup(seq["sequence"])
+	if len(records) != 1 || records[0].Evento != ledger.EventIssued {
+		t.Fatalf("ledger de %s = %+v", seq["sequence"], records)
+	}
+	if records[0].APIKey != apiKeyIdentity(testAPIKey) || records[0].Cliente != legacyClient ||
+		records[0].Tipo != "E32" || records[0].CTA != "A" {
+		t.Errorf("registro incompleto: %+v", records[0])
+	}
+
+	// Lote: un registro por NCF
+	w = postJSON(svc, "/api/sequences/batch", `{"type":"E32","cta":"A","count":3}`)
+	var batch struct {
+		Sequences []string `json:"sequences"`
+	}
+	json.NewDecoder(w.Body).Decode(&batch)
+	for _, ncf := range batch.Sequences {
+		if got := lookup(ncf); len(got) != 1 {
+			t.Errorf("ledger de %s tiene %d registros, se esperaba 1", ncf, len(got))
+		}
+	}
+
+	// Reserva anulada: emitido + anulado con el motivo
+	w = postJSON(svc, "/api/sequence/reserve", `{"type":"E32","cta":"A"}`)
+	var res map[string]string
+	json.NewDecoder(w.Body).Decode(&res)
+	postJSON(svc, "/api/sequence/void", fmt.Sprintf(`{"token":"%s","reason":"04"}`, res["token"]))
+	records = lookup(res["sequence"])
+	if len(records) != 2 || records[1].Evento != ledger.EventVoided || records[1].Motivo != "04" {
+		t.Errorf("ledger de la reserva anulada = %+v", records)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/ledger?ncf=E329999999999", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	rec := httptest.NewRecorder()
+	svc.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("NCF inexistente: status %d, se esperaba %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestLedgerFailureWithholdsNCF(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+	defer func(d []time.Duration) { ledgerRetryDelays = d }(ledgerRetryDelays)
+	ledgerRetryDelays = []time.Duration{time.Millisecond}
+
+	// Un ledger cerrado no acepta escrituras
+	dir := t.TempDir()
+	broken, err := ledger.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken.Close()
+	svc.ledger = broken
+
+	_, consumed, err := svc.store.Peek("E32", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"type":"E32","cta":"A"}`))
+		req.Header.Set("X-API-Key", testAPIKey)
+		req.Header.Set("Idempotency-Key", "factura-1")
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+	for _, path := range []string{"/api/sequence", "/api/sequence/reserve"} {
+		w := send(path)
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusServiceUnavailable || resp["code"] != errCodeLedgerUnavailable {
+			t.Errorf("%s con el ledger fallando: status %d, %v; el NCF no se entrega sin registrar", path, w.Code, resp)
+		}
+	}
+
+	// Con el ledger de nuevo disponible, el reintento con la misma clave
+	// recibe un número nuevo: los consumidos quedan como salto
+	svc.ledger, err = ledger.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.ledger.Close()
+	w := send("/api/sequence")
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp["sequenceNumber"] != fmt.Sprintf("%d", consumed+2) {
+		t.Fatalf("reintento: status %d, %v; se esperaba el número %d", w.Code, resp, consumed+2)
+	}
+	if svc.ledger.LastSeq() != 1 {
+		t.Errorf("LastSeq() = %d, se esperaba solo el registro entregado", svc.ledger.LastSeq())
+	}
+}
+
+func TestReport608Endpoint(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/reportes/608?"+query, nil)
+		req.Header.Set("X-API-Key", testAPIKey)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Reservar y anular un número en el período actual
+	w := postJSON(svc, "/api/sequence/reserve", `{"type":"E32","cta":"A"}`)
+	var res map[string]string
+	json.NewDecoder(w.Body).Decode(&res)
+	postJSON(svc, "/api/sequence/void", fmt.Sprintf(`{"token":"%s","reason":"04"}`, res["token"]))
+
+	periodo := time.Now().Format("200601")
+	w = get("rnc=101010101&periodo=" + periodo)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	want := fmt.Sprintf("608|101010101|%s|1\r\n%s|%s|04\r\n", periodo, res["sequence"], time.Now().Format("20060102"))
+	if w.Body.String() != want {
+		t.Errorf("608 =\n%q\nse esperaba\n%q", w.Body.String(), want)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != fmt.Sprintf(`attachment; filename="DGII_F_608_101010101_%s.TXT"`, periodo) {
+		t.Errorf("Content-Disposition = %s", cd)
+	}
+
+	if w := get("rnc=123&periodo=" + periodo); w.Code != http.StatusBadRequest {
+		t.Errorf("RNC inválido: status %d, se esperaba %d", w.Code, http.StatusBadRequest)
+	}
+	if w := get("rnc=101010101&periodo=2025"); w.Code != http.StatusBadRequest {
+		t.Errorf("período inválido: status %d, se esperaba %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Una anulación de un número que el servidor no emitió impide el reporte
+	svc.ledger.Append(ledger.Record{Evento: ledger.EventVoided, NCF: "E329999999999", Motivo: "04"})
+	if w := get("rnc=101010101&periodo=" + periodo); w.Code != http.StatusConflict {
+		t.Errorf("anulado no emitido: status %d, se esperaba %d", w.Code, http.StatusConflict)
+	}
+}
+
 func TestConcurrentSequenceRequests(t *testing.T) {
 	svc, cleanup := setupTestService(t)
 	defer cleanup()
@@ -446,3 +1142,231 @@ func TestServiceShutdown(t *testing.T) {
 		t.Error("Timeout esperando que el servicio se cierre")
 	}
 }
+
+func TestNewKeyRegistryReservesLegacyClient(t *testing.T) {
+	claves := []apikey.Key{
+		{Cliente: "caja-03", Hash: apikey.Hash("clave-caja"), Permisos: []string{apikey.ScopeRead}},
+		{Cliente: legacyClient, Hash: apikey.Hash("otra"), Permisos: []string{apikey.ScopeRead}},
+	}
+	// Con o sin -key el nombre está reservado y el error lo dice
+	for _, key := range []string{testAPIKey, ""} {
+		_, err := newKeyRegistry(key, claves)
+		if err == nil || !strings.Contains(err.Error(), "reservado") {
+			t.Errorf("newKeyRegistry(%q) error = %v, se esperaba el nombre %s reservado", key, err, legacyClient)
+		}
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+	ayer := time.Now().Add(-24 * time.Hour)
+	claves := []apikey.Key{
+		{Cliente: "caja-03", Hash: apikey.Hash("clave-caja"), Permisos: []string{apikey.Allocate("E32")}},
+		{Cliente: "contabilidad", Hash: apikey.Hash("clave-conta"), Permisos: []string{apikey.ScopeRead}},
+		{Cliente: "caja-vieja", Hash: apikey.Hash("clave-vieja"), Permisos: []string{apikey.Allocate("*")}, Expira: &ayer},
+	}
+	keys, err := newKeyRegistry(testAPIKey, claves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := *currentSettings()
+	live.claves, live.keys = claves, keys
+	settings.Store(&live)
+
+	request := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name, method, path, key, body string
+		wantStatus                    int
+	}{
+		{"asigna su tipo", http.MethodPost, "/api/sequence", "clave-caja", `{"type":"E32"}`, http.StatusOK},
+		{"otro tipo", http.MethodPost, "/api/sequence", "clave-caja", `{"type":"E31"}`, http.StatusForbidden},
+		{"lote de otro tipo", http.MethodPost, "/api/sequences/batch", "clave-caja", `{"type":"E34","count":2}`, http.StatusForbidden},
+		{"consulta sin leer", http.MethodGet, "/api/tipos", "clave-caja", "", http.StatusForbidden},
+		{"consulta con leer", http.MethodGet, "/api/tipos", "clave-conta", "", http.StatusOK},
+		{"asigna con leer", http.MethodPost, "/api/sequence", "clave-conta", `{"type":"E32"}`, http.StatusForbidden},
+		{"pausa sin admin", http.MethodPost, "/api/pausa", "clave-conta", "", http.StatusForbidden},
+		{"ajuste sin admin", http.MethodPost, "/api/contador", "clave-conta", `{"type":"E32","numero":5}`, http.StatusForbidden},
+		{"consulta de contador", http.MethodGet, "/api/contador?type=E32", "clave-conta", "", http.StatusOK},
+		{"estado de pausa", http.MethodGet, "/api/pausa", "clave-conta", "", http.StatusOK},
+		{"clave vencida", http.MethodPost, "/api/sequence", "clave-vieja", `{"type":"E32"}`, http.StatusUnauthorized},
+		{"clave principal", http.MethodGet, "/api/tipos", testAPIKey, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := request(tt.method, tt.path, tt.key, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, se esperaba %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), errCodeForbidden) {
+				t.Errorf("respuesta sin código %s: %s", errCodeForbidden, w.Body.String())
+			}
+		})
+	}
+
+	// El ledger guarda qué cliente consumió cada NCF
+	w := request(http.MethodPost, "/api/sequence/reserve", "clave-caja", `{"type":"E32"}`)
+	var res map[string]string
+	json.NewDecoder(w.Body).Decode(&res)
+	w = request(http.MethodGet, "/api/ledger?ncf="+res["sequence"], "clave-conta", "")
+	var records []ledger.Record
+	json.NewDecoder(w.Body).Decode(&records)
+	if len(records) != 1 || records[0].Cliente != "caja-03" || records[0].APIKey != apikey.Hash("clave-caja")[:16] {
+		t.Errorf("ledger de %s = %+v", res["sequence"], records)
+	}
+	// Solo quien puede asignar el tipo cierra la reserva
+	body := fmt.Sprintf(`{"token":%q,"invoiceId":"F-1"}`, res["token"])
+	if w := request(http.MethodPost, "/api/sequence/confirm", "clave-conta", body); w.Code != http.StatusForbidden {
+		t.Errorf("confirmar con leer = %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/api/sequence/confirm", "clave-caja", body); w.Code != http.StatusOK {
+		t.Errorf("confirmar con asignar:E32 = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// isolateConfig guarda los flags y la configuración en uso y los restaura al
+// terminar el test. Devuelve la ruta del archivo de configuración del test,
+// que queda como -config.
+func isolateConfig(t *testing.T) string {
+	t.Helper()
+	saved := flagValues(flag.CommandLine)
+	savedSettings, savedLoaded, savedSources := currentSettings(), loadedValues, configSources
+	t.Cleanup(func() {
+		// Value.Set para no marcarlos como pasados en la línea de comandos
+		for name, value := range saved {
+			flag.Lookup(name).Value.Set(value)
+		}
+		settings.Store(savedSettings)
+		loadedValues, configSources = savedLoaded, savedSources
+		if logFile != nil {
+			log.SetOutput(os.Stderr)
+			logFile.Close()
+			logFile = nil
+		}
+	})
+	*configF = filepath.Join(t.TempDir(), "ecf-sequence.yaml")
+	return *configF
+}
+
+// writeConfig escribe el archivo de configuración del test; %DBF% se
+// reemplaza por el DBF de prueba
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	_, filename, _, _ := runtime.Caller(0)
+	dbfPath := filepath.Join(filepath.Dir(filename), "..", "..", "DBF", "FAC_PF_M.DBF")
+	content = strings.ReplaceAll(content, "%DBF%", dbfPath)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := isolateConfig(t)
+	keyPath := filepath.Join(filepath.Dir(path), "api.key")
+	if err := os.WriteFile(keyPath, []byte("  secreta\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, path, "dbf: %DBF%\nport: \"99999\"\nkey-archivo: "+keyPath+"\nlote-max: 50\n")
+	t.Setenv("ECF_LOTE_MAX", "20")
+
+	_, errs := loadConfig()
+	if len(errs) != 1 {
+		t.Fatalf("loadConfig() errores = %v, se esperaba solo el de port", errs)
+	}
+	if msg := errs[0].Error(); !strings.Contains(msg, `campo "port"`) || !strings.Contains(msg, path+":2") {
+		t.Errorf("el error no indica el campo ni la línea: %s", msg)
+	}
+
+	writeConfig(t, path, "dbf: %DBF%\nport: 8099\nkey-archivo: "+keyPath+"\nlote-max: 50\n")
+	sources, errs := loadConfig()
+	if len(errs) > 0 {
+		t.Fatalf("loadConfig() errores = %v", errs)
+	}
+	live := currentSettings()
+	if live.batchMax != 20 || sources["lote-max"] != "ECF_LOTE_MAX" {
+		t.Errorf("lote-max = %d desde %q, se esperaba 20 desde ECF_LOTE_MAX", live.batchMax, sources["lote-max"])
+	}
+	if live.apiKey != "secreta" {
+		t.Errorf("key = %q, se esperaba la del archivo de key-archivo", live.apiKey)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	path := isolateConfig(t)
+	svc, cleanup := setupTestService(t)
+	defer cleanup()
+	logPath := filepath.Join(filepath.Dir(path), "ecf-sequence.log")
+	writeConfig(t, path, "dbf: %DBF%\nkey: clave-1\nlote-max: 5\nlog: "+logPath+"\n")
+	if _, errs := loadConfig(); len(errs) > 0 {
+		t.Fatalf("loadConfig() errores = %v", errs)
+	}
+
+	request := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		svc.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Nueva API Key, otro límite y un cambio de puerto que espera reinicio
+	writeConfig(t, path, "dbf: %DBF%\nkey: clave-2\nlote-max: 3\nlog: "+logPath+"\nport: 9090\n")
+	w := request(http.MethodPost, "/api/configuracion/recargar", "clave-1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("recargar = %d: %s", w.Code, w.Body.String())
+	}
+	var report reloadReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(report.Aplicados) != "[key lote-max]" || fmt.Sprint(report.Reinicio) != "[port]" {
+		t.Errorf("reporte = %+v", report)
+	}
+	if w := request(http.MethodGet, "/api/tipos", "clave-1", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("la clave anterior sigue valiendo: %d", w.Code)
+	}
+	if w := request(http.MethodGet, "/api/tipos", "clave-2", ""); w.Code != http.StatusOK {
+		t.Errorf("la clave nueva no vale: %d", w.Code)
+	}
+	body := `{"type":"E32","cta":"A","count":4}`
+	if w := request(http.MethodPost, "/api/sequences/batch", "clave-2", body); w.Code != http.StatusBadRequest {
+		t.Errorf("lote de 4 con lote-max 3 = %d", w.Code)
+	}
+
+	// Un valor inválido no aplica nada, pero el log rotado se reabre igual
+	os.Rename(logPath, logPath+".1")
+	writeConfig(t, path, "dbf: %DBF%\nkey: clave-3\nlote-max: 0\nlog: "+logPath+"\n")
+	w = request(http.MethodPost, "/api/configuracion/recargar", "clave-2", "")
+	if _, err := os.Stat(logPath); err != nil {
+		t.Errorf("el log no se reabrió tras una recarga inválida: %v", err)
+	}
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), errCodeConfigInvalid) ||
+		!strings.Contains(w.Body.String(), `lote-max`) {
+		t.Errorf("recargar con lote-max 0 = %d: %s", w.Code, w.Body.String())
+	}
+	if got := currentSettings(); got.apiKey != "clave-2" || got.batchMax != 3 {
+		t.Errorf("la configuración cambió tras una recarga inválida: key %q, lote-max %d", got.apiKey, got.batchMax)
+	}
+
+	// Quitar la única clave dejaría a todos afuera, incluida la recarga
+	writeConfig(t, path, "dbf: %DBF%\nlote-max: 3\nlog: "+logPath+"\n")
+	w = request(http.MethodPost, "/api/configuracion/recargar", "clave-2", "")
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "ninguna API Key") {
+		t.Errorf("recargar sin claves = %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodGet, "/api/tipos", "clave-2", ""); w.Code != http.StatusOK {
+		t.Errorf("la clave vigente dejó de valer tras una recarga sin claves: %d", w.Code)
+	}
+
+	// El método se valida antes que la clave, como en los demás endpoints
+	if w := request(http.MethodGet, "/api/configuracion/recargar", "", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET recargar sin clave = %d, se esperaba %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/store"
+)
+
+const errCodeServicePaused = "SERVICE_PAUSED"
+
+// pauseRetryAfter son los segundos que se sugiere esperar (Retry-After) a un
+// cliente que pide un número con el servicio en pausa
+const pauseRetryAfter = "30"
+
+// pauseState es el estado de mantenimiento del servicio. Cada asignación toma
+// mu en lectura mientras corre y pausar lo toma en escritura, así que la pausa
+// espera a que terminen las asignaciones en curso y no deja empezar otras.
+type pauseState struct {
+	mu     sync.RWMutex
+	paused bool
+	since  time.Time
+	origen string // quién pidió la pausa: SCM, señal o API
+	aviso  string // por qué el almacén no soltó sus archivos, si pasó
+}
+
+// beginAllocation deja pasar una asignación si el servicio no está en pausa y
+// devuelve la función que la da por terminada. En pausa responde 503 y
+// devuelve false.
+func (m *apiServerService) beginAllocation(w http.ResponseWriter) (func(), bool) {
+	m.pause.mu.RLock()
+	if m.pause.paused {
+		m.pause.mu.RUnlock()
+		w.Header().Set("Retry-After", pauseRetryAfter)
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeServicePaused, "el servicio está en pausa por mantenimiento")
+		return nil, false
+	}
+	return m.pause.mu.RUnlock, true
+}
+
+// pauseService deja de asignar números: espera las asignaciones en curso y, si
+// el almacén lo permite, suelta sus archivos (el journal del DBF) para que el
+// ERP corra sus procesos de cierre. Las consultas siguen funcionando. Siempre
+// queda en pausa: el almacén deja de asignar aunque no haya podido soltar
+// algún archivo, y ese error queda como aviso en el estado (ver pauseStatus).
+func (m *apiServerService) pauseService(origen string) {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+	if m.pause.paused {
+		return
+	}
+	m.pause.paused, m.pause.since, m.pause.origen, m.pause.aviso = true, time.Now(), origen, ""
+	if s, ok := m.store.(store.Suspender); ok {
+		if err := s.Suspend(); err != nil {
+			m.pause.aviso = fmt.Sprintf("el almacén no liberó sus archivos: %v", err)
+			m.store.Log(fmt.Sprintf("Servicio en pausa (%s), pero %s", origen, m.pause.aviso))
+			return
+		}
+	}
+	m.store.Log(fmt.Sprintf("Servicio en pausa (%s)", origen))
+}
+
+// resumeService vuelve a asignar. Si el almacén no puede retomar sus archivos
+// (p.ej. una herramienta de administración todavía tiene el journal) el
+// servicio sigue en pausa.
+func (m *apiServerService) resumeService(origen string) error {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+	if !m.pause.paused {
+		return nil
+	}
+	if s, ok := m.store.(store.Suspender); ok {
+		if err := s.Resume(); err != nil {
+			m.store.Log(fmt.Sprintf("No se pudo reanudar (%s): %v", origen, err))
+			return err
+		}
+	}
+	m.pause.paused = false
+	m.store.Log(fmt.Sprintf("Servicio reanudado (%s), pausado desde %s", origen, m.pause.since.Format(time.RFC3339)))
+	return nil
+}
+
+// pauseStatus es la respuesta de /api/pausa
+type pauseStatus struct {
+	Pausado bool       `json:"pausado"`
+	Desde   *time.Time `json:"desde,omitempty"`
+	Origen  string     `json:"origen,omitempty"`
+	Aviso   string     `json:"aviso,omitempty"`
+}
+
+func (m *apiServerService) pauseStatus() pauseStatus {
+	m.pause.mu.RLock()
+	defer m.pause.mu.RUnlock()
+	if !m.pause.paused {
+		return pauseStatus{}
+	}
+	since := m.pause.since
+	return pauseStatus{Pausado: true, Desde: &since, Origen: m.pause.origen, Aviso: m.pause.aviso}
+}
+
+// handlePause consulta o cambia la pausa de mantenimiento:
+//
+//	GET    /api/pausa  estado actual
+//	POST   /api/pausa  pausa las asignaciones
+//	DELETE /api/pausa  las reanuda
+func (m *apiServerService) handlePause(w http.ResponseWriter, r *http.Request) {
+	scope := apikey.ScopeAdmin
+	if r.Method == http.MethodGet {
+		scope = apikey.ScopeRead
+	}
+	if !m.authorized(w, r, scope) {
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		m.pauseService("API desde " + r.RemoteAddr)
+	case http.MethodDelete:
+		err = m.resumeService("API desde " + r.RemoteAddr)
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, errCodeServicePaused, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.pauseStatus())
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"ecf-sequence-server/internal/alert"
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/config"
+)
+
+const errCodeConfigInvalid = "CONFIG_INVALID"
+
+// liveSettings son los valores de la configuración que se pueden cambiar con
+// el servicio corriendo (ver reloadConfig). Se reemplazan enteros, así que
+// un handler siempre ve una combinación que pasó la validación.
+type liveSettings struct {
+	apiKey     string
+	claves     []apikey.Key     // las del archivo de -claves
+	keys       *apikey.Registry // claves más la de apiKey
+	batchMax   int
+	bodyMax    int64
+	logPath    string
+	webhook    string
+	histeresis int64
+}
+
+// liveFlags son los flags de liveSettings; key-archivo también, porque de
+// él sale la API Key. Cualquier otro cambio necesita reiniciar el servicio.
+var liveFlags = map[string]bool{
+	"key": true, "key-archivo": true, "claves": true, "lote-max": true, "cuerpo-max": true,
+	"log": true, "webhook": true, "histeresis": true,
+}
+
+var (
+	// settings es la configuración en uso; la carga loadConfig y la
+	// reemplaza reloadConfig
+	settings atomic.Pointer[liveSettings]
+
+	// loadedValues es el valor de cada flag al arrancar, para saber qué
+	// cambios de una recarga quedan pendientes de reinicio
+	loadedValues map[string]string
+
+	// reloadMu evita que dos recargas (p.ej. SIGHUP y la API) se pisen
+	reloadMu sync.Mutex
+)
+
+// currentSettings devuelve la configuración en uso
+func currentSettings() *liveSettings {
+	return settings.Load()
+}
+
+// newLiveSettings arma y valida la parte recargable de la configuración con
+// los flags de fs. Con key-archivo, además, lee la API Key del archivo, y con
+// claves el registro de claves de los clientes.
+func newLiveSettings(fs *flag.FlagSet, sources map[string]string) (*liveSettings, []error) {
+	value := func(name string) interface{} {
+		return fs.Lookup(name).Value.(flag.Getter).Get()
+	}
+	s := &liveSettings{
+		apiKey:     value("key").(string),
+		batchMax:   value("lote-max").(int),
+		bodyMax:    value("cuerpo-max").(int64),
+		logPath:    value("log").(string),
+		webhook:    value("webhook").(string),
+		histeresis: value("histeresis").(int64),
+	}
+
+	var errs []error
+	check := func(ok bool, campo, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, &config.FieldError{Campo: campo, Origen: sources[campo], Err: fmt.Errorf(format, args...)})
+		}
+	}
+	if keyFile := value("key-archivo").(string); keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		key := strings.TrimSpace(string(data))
+		switch {
+		case err != nil:
+			check(false, "key-archivo", "%v", err)
+		case key == "":
+			check(false, "key-archivo", "el archivo %s está vacío", keyFile)
+		case s.apiKey != "":
+			check(false, "key-archivo", "use key o key-archivo, no los dos")
+		default:
+			s.apiKey = key
+		}
+	}
+	if path := value("claves").(string); path != "" {
+		claves, err := apikey.Load(path)
+		check(err == nil, "claves", "%v", err)
+		s.claves = claves
+	}
+	keys, err := newKeyRegistry(s.apiKey, s.claves)
+	check(err == nil, "claves", "%v", err)
+	s.keys = keys
+	check(s.batchMax > 0, "lote-max", "tiene que ser mayor que cero")
+	check(s.bodyMax > 0, "cuerpo-max", "tiene que ser mayor que cero")
+	if s.webhook != "" {
+		u, err := url.Parse(s.webhook)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "webhook", "URL inválida %q", s.webhook)
+	}
+	check(s.histeresis >= 0, "histeresis", "no puede ser negativa")
+	if s.logPath != "" {
+		info, err := os.Stat(filepath.Dir(s.logPath))
+		check(err == nil && info.IsDir(), "log", "el directorio %s no existe", filepath.Dir(s.logPath))
+	}
+	return s, errs
+}
+
+// changes lista los flags cuyo valor en s es distinto del de old
+func (s *liveSettings) changes(old *liveSettings) []string {
+	var names []string
+	add := func(changed bool, name string) {
+		if changed {
+			names = append(names, name)
+		}
+	}
+	add(s.apiKey != old.apiKey, "key")
+	add(!reflect.DeepEqual(s.claves, old.claves), "claves")
+	add(s.batchMax != old.batchMax, "lote-max")
+	add(s.bodyMax != old.bodyMax, "cuerpo-max")
+	add(s.logPath != old.logPath, "log")
+	add(s.webhook != old.webhook, "webhook")
+	add(s.histeresis != old.histeresis, "histeresis")
+	return names
+}
+
+// flagValues devuelve el valor de cada flag de fs como texto
+func flagValues(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { values[f.Name] = f.Value.String() })
+	return values
+}
+
+// reloadReport es el resultado de una recarga
+type reloadReport struct {
+	Aplicados []string `json:"aplicados"`          // flags que cambiaron y ya están en uso
+	Reinicio  []string `json:"requieren_reinicio"` // flags que cambiaron y esperan un reinicio
+}
+
+// reloadConfig vuelve a leer el archivo de configuración y las variables
+// ECF_* (lo pasado en la línea de comandos sigue ganando) y aplica de una
+// vez las API Keys, los límites, el log y las reglas de alerta. Los demás
+// cambios se informan como pendientes de reinicio. Si algo no valida, o si no
+// quedaría ninguna API Key, no se aplica nada. En cualquier caso el log se
+// vuelve a abrir (el nuevo o, si no se aplicó, el actual), así que sirve
+// también después de rotarlo.
+func (m *apiServerService) reloadConfig(origen string) (*reloadReport, []error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	// rejected reabre el log actual y devuelve errs
+	rejected := func(errs ...error) (*reloadReport, []error) {
+		if err := reopenLog(currentSettings().logPath); err != nil {
+			m.store.Log(fmt.Sprintf("Error reabriendo el log: %v", err))
+		}
+		return nil, errs
+	}
+
+	fs := config.Clone(flag.CommandLine, configSources)
+	sources, errs := config.Load(fs, configPath(), os.Environ(), "config")
+	if len(errs) > 0 {
+		return rejected(errs...)
+	}
+	live, errs := newLiveSettings(fs, sources)
+	if len(errs) > 0 {
+		return rejected(errs...)
+	}
+	// Sin ninguna clave nadie podría ni siquiera volver a recargar
+	if live.keys.Len() == 0 {
+		return rejected(&config.FieldError{Campo: "key", Origen: sources["key"],
+			Err: fmt.Errorf("la recarga dejaría el servicio sin ninguna API Key; se mantiene la configuración actual")})
+	}
+	if err := reopenLog(live.logPath); err != nil {
+		return rejected(&config.FieldError{Campo: "log", Origen: sources["log"], Err: err})
+	}
+
+	old := currentSettings()
+	settings.Store(live)
+	if m.monitor != nil {
+		m.monitor.Reconfigure(alert.Config{WebhookURL: live.webhook, HysteresisPct: live.histeresis})
+	}
+
+	report := &reloadReport{Aplicados: live.changes(old), Reinicio: []string{}}
+	if report.Aplicados == nil {
+		report.Aplicados = []string{}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		// config es el archivo que se acaba de leer, no un cambio
+		if f.Name == "config" || liveFlags[f.Name] {
+			return
+		}
+		if f.Value.String() != loadedValues[f.Name] {
+			report.Reinicio = append(report.Reinicio, f.Name)
+		}
+	})
+	msg := fmt.Sprintf("Configuración recargada (%s): aplicados [%s]", origen, strings.Join(report.Aplicados, ", "))
+	if len(report.Reinicio) > 0 {
+		msg += fmt.Sprintf("; requieren reinicio [%s]", strings.Join(report.Reinicio, ", "))
+	}
+	m.store.Log(msg)
+	return report, nil
+}
+
+// limitBody limita el cuerpo de cada solicitud a cuerpo-max, leído en cada
+// solicitud para que una recarga lo cambie
+func limitBody(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, currentSettings().bodyMax)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleReload recarga la configuración:
+//
+//	POST /api/configuracion/recargar
+//
+// Responde qué se aplicó y qué espera un reinicio, o 422 con los errores.
+func (m *apiServerService) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, apikey.ScopeAdmin) {
+		return
+	}
+	report, errs := m.reloadConfig("API desde " + r.RemoteAddr)
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		writeJSONError(w, http.StatusUnprocessableEntity, errCodeConfigInvalid, strings.Join(msgs, "; "))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/dgii"
+)
+
+const errCodeVoidNotIssued = "VOID_NOT_ISSUED"
+
+// handleReport608 genera el 608 del período a partir del ledger:
+// GET /api/reportes/608?periodo=AAAAMM[&rnc=XXXXXXXXX]
+func (m *apiServerService) handleReport608(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, apikey.ScopeRead) {
+		return
+	}
+	if m.ledger == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeInternal, "ledger no configurado")
+		return
+	}
+
+	rnc := r.URL.Query().Get("rnc")
+	if rnc == "" {
+		rnc = *rncF
+	}
+	if !dgii.ValidRNC(rnc) {
+		http.Error(w, fmt.Sprintf("RNC inválido: %q", rnc), http.StatusBadRequest)
+		return
+	}
+	periodo, err := dgii.ParsePeriodo(r.URL.Query().Get("periodo"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	anulados, err := dgii.Anulados608(m.ledger.Scan, periodo)
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error generando 608: %v", err))
+		status, code := http.StatusInternalServerError, errCodeInternal
+		if errors.Is(err, dgii.ErrAnuladoNoEmitido) {
+			status, code = http.StatusConflict, errCodeVoidNotIssued
+		}
+		writeJSONError(w, status, code, err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := dgii.Write608(&buf, rnc, periodo, anulados); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, errCodeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", dgii.FileName608(rnc, periodo)))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/ledger"
+	"ecf-sequence-server/internal/reservation"
+)
+
+const (
+	errCodeReservationNotFound = "RESERVATION_NOT_FOUND"
+	errCodeReservationClosed   = "RESERVATION_CLOSED"
+	errCodeReservationExpired  = "RESERVATION_EXPIRED"
+	errCodeInvalidReason       = "INVALID_REASON"
+)
+
+// handleReserve asigna un NCF igual que /api/sequence pero lo deja pendiente
+// hasta que el cliente lo confirme con su factura o lo anule.
+func (m *apiServerService) handleReserve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, "") {
+		return
+	}
+	done, ok := m.beginAllocation(w)
+	if !ok {
+		return
+	}
+	defer done()
+	req, ok := decodeSequenceRequest(w, r)
+	if !ok || !m.authorized(w, r, apikey.Allocate(req.Type)) {
+		return
+	}
+
+	sequence, num, err := m.store.GetSequence(req.Type, req.CTA)
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error generando secuencia para %s: %v", clientName(r), err))
+		writeAllocationError(w, err)
+		return
+	}
+	// El registro "emitido" va al ledger antes que la reserva, para que la
+	// confirmación o anulación siempre encuentre su emisión
+	issued := false
+	res, err := m.reservations.Reserve(sequence, req.Type, req.CTA, num, func(res reservation.Reservation) error {
+		if err := m.recordIssued(r, req.Type, req.CTA, []string{sequence}, num, res.Token); err != nil {
+			return err
+		}
+		issued = true
+		return nil
+	})
+	if err != nil {
+		if issued {
+			// Está en el ledger como emitido pero sin reserva que lo cierre
+			m.store.Log(fmt.Sprintf("Error registrando reserva de %s: %v", sequence, err))
+			writeJSONError(w, http.StatusInternalServerError, errCodeInternal, err.Error())
+			return
+		}
+		writeAllocationError(w, err)
+		return
+	}
+	m.store.Log(fmt.Sprintf("Reserved sequence: %s (expira %s, cliente %s)", sequence, res.ExpiraEn.Format(time.RFC3339), clientName(r)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":          res.Token,
+		"sequence":       sequence,
+		"sequenceNumber": fmt.Sprintf("%d", num),
+		"expiresAt":      res.ExpiraEn.Format(time.RFC3339),
+	})
+}
+
+// handleConfirm cierra una reserva asociándola al número de factura
+func (m *apiServerService) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, "") {
+		return
+	}
+	var req struct {
+		Token     string `json:"token"`
+		InvoiceID string `json:"invoiceId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.InvoiceID == "" {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return
+	}
+	if !m.reservationAllowed(w, r, req.Token) {
+		return
+	}
+
+	// El ledger se escribe antes de cerrar la reserva: si falla, sigue
+	// pendiente y el cliente puede reintentar
+	res, err := m.reservations.Confirm(req.Token, req.InvoiceID, func(res reservation.Reservation) error {
+		return m.recordReservation(r, ledger.EventConfirmed, res)
+	})
+	if err != nil {
+		writeReservationError(w, err)
+		return
+	}
+	m.store.Log(fmt.Sprintf("Confirmed sequence: %s (factura %s, cliente %s)", res.NCF, res.Factura, clientName(r)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleVoid anula una reserva con un tipo de anulación de la DGII
+func (m *apiServerService) handleVoid(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, "") {
+		return
+	}
+	var req struct {
+		Token  string `json:"token"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return
+	}
+	if !m.reservationAllowed(w, r, req.Token) {
+		return
+	}
+
+	res, err := m.reservations.Void(req.Token, req.Reason, func(res reservation.Reservation) error {
+		return m.recordReservation(r, ledger.EventVoided, res)
+	})
+	if err != nil {
+		writeReservationError(w, err)
+		return
+	}
+	m.store.Log(fmt.Sprintf("Voided sequence: %s (motivo %s, cliente %s)", res.NCF, res.Motivo, clientName(r)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// reservationAllowed verifica que la clave pueda asignar el tipo de la
+// reserva de token; si no existe responde como Confirm y Void
+func (m *apiServerService) reservationAllowed(w http.ResponseWriter, r *http.Request, token string) bool {
+	res, err := m.reservations.Get(token)
+	if err != nil {
+		writeReservationError(w, err)
+		return false
+	}
+	return m.authorized(w, r, apikey.Allocate(res.Tipo))
+}
+
+func writeReservationError(w http.ResponseWriter, err error) {
+	status, code := http.StatusInternalServerError, errCodeInternal
+	switch {
+	case errors.Is(err, reservation.ErrNotFound):
+		status, code = http.StatusNotFound, errCodeReservationNotFound
+	case errors.Is(err, reservation.ErrNotPending):
+		status, code = http.StatusConflict, errCodeReservationClosed
+	case errors.Is(err, reservation.ErrExpired):
+		status, code = http.StatusGone, errCodeReservationExpired
+	case errors.Is(err, reservation.ErrInvalidReason):
+		status, code = http.StatusBadRequest, errCodeInvalidReason
+	case errors.Is(err, errLedgerUnavailable):
+		status, code = http.StatusServiceUnavailable, errCodeLedgerUnavailable
+	}
+	writeJSONError(w, status, code, err.Error())
+}
+
+// startReservationSweeper anula periódicamente las reservas vencidas. La
+// función devuelta detiene la goroutine.
+func (m *apiServerService) startReservationSweeper(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.expireReservations()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// expireReservations anula las reservas vencidas, anotándolas primero en el
+// ledger. Las que no se pudieron anular quedan para el próximo barrido.
+func (m *apiServerService) expireReservations() {
+	expired, err := m.reservations.ExpireDue(func(res reservation.Reservation) error {
+		return m.recordReservation(nil, ledger.EventVoided, res)
+	})
+	for _, res := range expired {
+		m.store.Log(fmt.Sprintf("Voided sequence: %s (reserva vencida sin confirmar)", res.NCF))
+	}
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error anulando reservas vencidas (se reintenta en el próximo barrido): %v", err))
+	}
+}
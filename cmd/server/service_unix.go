@@ -0,0 +1,99 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ecf-sequence-server/internal/systemd"
+)
+
+// runService corre el servicio en primer plano hasta recibir SIGTERM o
+// SIGINT. Bajo systemd (Type=notify) avisa READY=1 cuando el puerto ya está
+// abierto y, si la unidad tiene WatchdogSec, avisa WATCHDOG=1 mientras el
+// almacén responda; si el almacén queda colgado systemd reinicia el servicio.
+// SIGHUP (systemctl reload) recarga la configuración (ver reloadConfig) y
+// vuelve a abrir el log después de una rotación. SIGUSR1 pausa las
+// asignaciones (ver pauseService) y SIGUSR2 las reanuda.
+func runService(name string, isDebug bool, m *apiServerService) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	if err := m.startHTTPServer(); err != nil {
+		m.store.Log(err.Error())
+		log.Fatalf("Error iniciando %s: %v", name, err)
+	}
+	notify(systemd.Ready + "\n" + systemd.Status("Atendiendo en "+listenAddr()))
+
+	var watchdog <-chan time.Time
+	if interval, ok := systemd.WatchdogInterval(); ok {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGHUP:
+				notify(systemd.Reloading)
+				if _, errs := m.reloadConfig("SIGHUP"); len(errs) > 0 {
+					// La configuración anterior sigue en uso; el log igual
+					// se reabrió por si lo rotaron
+					for _, err := range errs {
+						m.store.Log(fmt.Sprintf("Error recargando la configuración: %v", err))
+					}
+				}
+				log.Print("Recibida señal SIGHUP, configuración recargada y log reabierto.")
+				notify(systemd.Ready)
+				continue
+			case syscall.SIGUSR1:
+				m.pauseService("SIGUSR1")
+				notify(systemd.Status("En pausa"))
+				continue
+			case syscall.SIGUSR2:
+				if err := m.resumeService("SIGUSR2"); err != nil {
+					log.Printf("Error al reanudar: %v", err)
+					continue
+				}
+				notify(systemd.Status("Atendiendo en " + listenAddr()))
+				continue
+			}
+			log.Printf("Recibida señal %v, cerrando el servidor.", sig)
+			notify(systemd.Stopping)
+			m.stopHTTPServer()
+			return
+
+		case <-watchdog:
+			// Rollbacks toma el lock del almacén: si una asignación quedó
+			// colgada no se llega a avisar y systemd reinicia el servicio. Un
+			// error (p.ej. el recurso compartido no responde) no se arregla
+			// reiniciando, así que igual se avisa.
+			if _, err := m.store.Rollbacks(); err != nil {
+				log.Printf("Watchdog: el almacén no responde bien: %v", err)
+			}
+			notify(systemd.Watchdog)
+
+		case <-m.done:
+			// El servidor HTTP terminó sin que se lo pidiéramos: salir con
+			// error para que systemd (Restart=on-failure) lo reinicie
+			m.store.Log(fmt.Sprintf("El servidor HTTP de %s terminó inesperadamente", name))
+			notify(systemd.Stopping)
+			log.Fatalf("El servidor HTTP de %s terminó inesperadamente", name)
+		}
+	}
+}
+
+// notify avisa a systemd; un error solo se registra
+func notify(state string) {
+	if err := systemd.Notify(state); err != nil {
+		log.Printf("sd_notify: %v", err)
+	}
+}
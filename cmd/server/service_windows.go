@@ -0,0 +1,105 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/debug"
+)
+
+// Execute es donde el SCM (Service Control Manager) interactúa con el servicio.
+// Acá escuchamos señales de Start, Stop, Pause, etc. y hacemos lo necesario.
+func (m *apiServerService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
+
+	// cmdsAccepted indica qué señales vamos a aceptar:
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue | svc.AcceptParamChange
+
+	// Avisamos al SCM que estamos "iniciando".
+	s <- svc.Status{State: svc.StartPending}
+
+	// Iniciar la goroutine del servidor HTTP
+	if err := m.startHTTPServer(); err != nil {
+		log.Print(err)
+		m.store.Log(err.Error())
+		return true, 1
+	}
+
+	// Avisamos que ya estamos "corriendo" y aceptamos las señales indicadas.
+	s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+
+	// Bucle principal de escucha de señales
+loop:
+	for {
+		select {
+		// No tenemos un "tick" en este caso, así que solo escuchamos señales del SCM
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				// El SCM pregunta "¿cómo estás?" => respondemos con estado actual
+				s <- c.CurrentStatus
+
+			case svc.Stop, svc.Shutdown:
+				// Nos ordenan detener => paramos el servidor y salimos
+				log.Print("Recibida señal de STOP/SHUTDOWN, cerrando el servidor.")
+				m.stopHTTPServer()
+				break loop
+
+			case svc.Pause:
+				// Se dejan de asignar números y se libera el DBF; las
+				// consultas siguen funcionando
+				s <- svc.Status{State: svc.PausePending}
+				m.pauseService("SCM")
+				s <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
+
+			case svc.Continue:
+				// Si no se puede retomar el DBF el servicio sigue en pausa
+				s <- svc.Status{State: svc.ContinuePending}
+				if err := m.resumeService("SCM"); err != nil {
+					log.Printf("Error al reanudar: %v", err)
+					s <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
+					continue
+				}
+				s <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+
+			case svc.ParamChange:
+				// sc control ECFSequence paramchange: recarga la
+				// configuración sin cortar las conexiones
+				if _, errs := m.reloadConfig("SCM"); len(errs) > 0 {
+					for _, err := range errs {
+						m.store.Log(fmt.Sprintf("Error recargando la configuración: %v", err))
+					}
+				}
+				s <- c.CurrentStatus
+
+			default:
+				log.Printf("Recibida señal no esperada: %v", c.Cmd)
+			}
+		}
+	}
+
+	// Avisar al SCM que estamos en proceso de detener
+	s <- svc.Status{State: svc.StopPending}
+
+	// Retornamos (fin de Execute => fin de servicio)
+	return false, 0
+}
+
+// runService permite ejecutar el servicio en modo real (SCM) o debug.
+func runService(name string, isDebug bool, svcHandler *apiServerService) {
+	if isDebug {
+		// Modo consola normal (debug.Run => no necesita instalarse en Windows)
+		err := debug.Run(name, svcHandler)
+		if err != nil {
+			log.Fatalf("Error corriendo en modo debug: %v", err)
+		}
+	} else {
+		// Modo servicio normal => Interactúa con el SCM
+		err := svc.Run(name, svcHandler)
+		if err != nil {
+			log.Fatalf("Error corriendo como servicio: %v", err)
+		}
+	}
+}
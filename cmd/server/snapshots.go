@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ecf-sequence-server/internal/apikey"
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/store"
+)
+
+const (
+	errCodeSnapshotsUnavailable = "SNAPSHOTS_UNAVAILABLE"
+	errCodeSnapshotNotFound     = "SNAPSHOT_NOT_FOUND"
+)
+
+// snapshotter devuelve el almacén como store.Snapshotter o responde 501 si
+// no guarda respaldos (p.ej. bolt)
+func (m *apiServerService) snapshotter(w http.ResponseWriter) (store.Snapshotter, bool) {
+	s, ok := m.store.(store.Snapshotter)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, errCodeSnapshotsUnavailable, "el almacén configurado no guarda respaldos")
+	}
+	return s, ok
+}
+
+// handleSnapshots lista los respaldos del DBF: GET /api/respaldos
+func (m *apiServerService) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, apikey.ScopeRead) {
+		return
+	}
+	s, ok := m.snapshotter(w)
+	if !ok {
+		return
+	}
+	snaps, err := s.Snapshots()
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errCodeSnapshotsUnavailable, err.Error())
+		return
+	}
+	if snaps == nil {
+		snaps = []dbf.Snapshot{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snaps)
+}
+
+// handleRestoreSnapshot restaura un respaldo y adelanta los contadores que
+// queden por debajo de lo emitido: POST /api/respaldos/restaurar {"nombre": "..."}
+func (m *apiServerService) handleRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.authorized(w, r, apikey.ScopeAdmin) {
+		return
+	}
+	s, ok := m.snapshotter(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Nombre string `json:"nombre"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Nombre == "" {
+		http.Error(w, "Se requiere el nombre del respaldo", http.StatusBadRequest)
+		return
+	}
+
+	advanced, err := s.RestoreSnapshot(req.Nombre)
+	if err != nil {
+		m.store.Log(fmt.Sprintf("Error restaurando el respaldo %s: %v", req.Nombre, err))
+		if errors.Is(err, dbf.ErrSnapshotNotFound) {
+			writeJSONError(w, http.StatusNotFound, errCodeSnapshotNotFound, err.Error())
+			return
+		}
+		writeAllocationError(w, err)
+		return
+	}
+	if advanced == nil {
+		advanced = []dbf.Rollback{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"restaurado": req.Nombre, "adelantados": advanced})
+}
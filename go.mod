@@ -4,7 +4,8 @@ go 1.23.5
 
 require (
 	github.com/LindsayBradford/go-dbf v1.0.0-aplha.4
+	github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394
+	go.etcd.io/bbolt v1.3.11
 	golang.org/x/sys v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394 // indirect
@@ -0,0 +1,236 @@
+// internal/alert/monitor.go
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// Eventos que se envían al webhook
+const (
+	EventLowStock  = "stock_bajo"
+	EventRecovered = "stock_normal"
+	EventRollback  = "contador_retrocedido"
+)
+
+// Config reúne los parámetros del monitor de stock
+type Config struct {
+	// WebhookURL recibe un POST JSON por cada alerta. Vacío = sin webhook.
+	WebhookURL string
+	// HysteresisPct es el porcentaje de MINIMO que el stock debe superar por
+	// encima del mínimo para rearmar la alerta (evita una alerta por factura).
+	HysteresisPct int64
+	// Logf recibe los mensajes de alerta; por defecto usa log.Print.
+	Logf func(string)
+}
+
+// Event es lo que se envía al webhook
+type Event struct {
+	Evento    string    `json:"evento"`
+	Tipo      string    `json:"tipo"`
+	CTA       string    `json:"cta"`
+	Restantes int64     `json:"restantes"`
+	Minimo    int64     `json:"minimo"`
+	Hasta     int64     `json:"hasta"`
+	Contador  int64     `json:"contador,omitempty"` // solo en contador_retrocedido
+	Emitido   int64     `json:"emitido,omitempty"`  // solo en contador_retrocedido
+	Fecha     time.Time `json:"fecha"`
+}
+
+// Monitor recibe el stock de cada cuenta después de cada asignación y dispara
+// alertas cuando baja de MINIMO. La evaluación corre en una goroutine propia
+// para no demorar la respuesta al POS.
+type Monitor struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	alerted map[string]bool // clave: "TIPO/CTA"
+	// webhook e hysteresis son los de cfg, bajo mu porque Reconfigure los cambia
+	webhook    string
+	hysteresis int64
+
+	levels    chan dbf.StockLevel
+	rollbacks chan dbf.Rollback
+	// quit lo cierra Stop; levels y rollbacks no se cierran nunca porque los
+	// handlers que siguen en curso después del apagado pueden enviar todavía
+	quit     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewMonitor crea un Monitor; hay que llamar Start para que procese eventos.
+func NewMonitor(cfg Config) *Monitor {
+	if cfg.Logf == nil {
+		cfg.Logf = func(msg string) { log.Print(msg) }
+	}
+	if cfg.HysteresisPct < 0 {
+		cfg.HysteresisPct = 0
+	}
+	return &Monitor{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		alerted:    make(map[string]bool),
+		webhook:    cfg.WebhookURL,
+		hysteresis: cfg.HysteresisPct,
+		levels:     make(chan dbf.StockLevel, 256),
+		rollbacks:  make(chan dbf.Rollback, 16),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Reconfigure cambia el webhook y la histéresis mientras el monitor corre.
+// Las alertas ya disparadas se mantienen; Logf no cambia.
+func (m *Monitor) Reconfigure(cfg Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhook = cfg.WebhookURL
+	m.hysteresis = max(cfg.HysteresisPct, 0)
+}
+
+// Start arranca la goroutine que evalúa los niveles recibidos.
+func (m *Monitor) Start() {
+	go func() {
+		defer close(m.done)
+		for {
+			select {
+			case <-m.quit:
+				// Los niveles y retrocesos que quedaron en cola también se procesan
+				for len(m.levels) > 0 {
+					m.evaluate(<-m.levels)
+				}
+				for len(m.rollbacks) > 0 {
+					m.sendRollback(<-m.rollbacks)
+				}
+				return
+			case level := <-m.levels:
+				m.evaluate(level)
+			case rb := <-m.rollbacks:
+				m.sendRollback(rb)
+			}
+		}
+	}()
+}
+
+// Stop deja de aceptar niveles y espera a que se procesen los pendientes. Se
+// puede llamar más de una vez.
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() { close(m.quit) })
+	<-m.done
+}
+
+// Observe encola un nivel de stock sin bloquear. Es la función que se pasa a
+// dbf.WithStockObserver. Después de Stop los niveles se descartan.
+func (m *Monitor) Observe(level dbf.StockLevel) {
+	select {
+	case <-m.quit:
+	case m.levels <- level:
+	default:
+		m.cfg.Logf(fmt.Sprintf("Monitor de stock saturado, se descarta el nivel de %s/%s", level.Tipo, level.CTA))
+	}
+}
+
+// Rollback encola el aviso de un contador del DBF que quedó por debajo de lo
+// ya emitido. Es la función que se pasa a dbf.WithRollbackObserver; el Manager
+// ya lo dejó en su log, acá solo se avisa al webhook.
+func (m *Monitor) Rollback(rb dbf.Rollback) {
+	select {
+	case <-m.quit:
+	case m.rollbacks <- rb:
+	default:
+		m.cfg.Logf(fmt.Sprintf("Monitor saturado, no se avisará al webhook del retroceso de %s/%s", rb.Tipo, rb.CTA))
+	}
+}
+
+func (m *Monitor) sendRollback(rb dbf.Rollback) {
+	m.sendWebhook(Event{
+		Evento:   EventRollback,
+		Tipo:     rb.Tipo,
+		CTA:      rb.CTA,
+		Contador: rb.Contador,
+		Emitido:  rb.Emitido,
+		Fecha:    time.Now(),
+	})
+}
+
+// Low indica si alguna cuenta del tipo está por debajo de su mínimo.
+func (m *Monitor) Low(tipo string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.alerted[tipo+"/A"] || m.alerted[tipo+"/B"]
+}
+
+// evaluate aplica la histéresis: alerta una vez al cruzar MINIMO hacia abajo y
+// se rearma cuando el stock vuelve a superar MINIMO más el margen.
+func (m *Monitor) evaluate(level dbf.StockLevel) {
+	if level.Minimo <= 0 {
+		return
+	}
+	key := level.Tipo + "/" + level.CTA
+
+	m.mu.Lock()
+	margin := max(level.Minimo*m.hysteresis/100, 1)
+	alerted := m.alerted[key]
+	var evento string
+	switch {
+	case !alerted && level.Restantes < level.Minimo:
+		m.alerted[key] = true
+		evento = EventLowStock
+	case alerted && level.Restantes >= level.Minimo+margin:
+		delete(m.alerted, key)
+		evento = EventRecovered
+	}
+	m.mu.Unlock()
+
+	if evento == "" {
+		return
+	}
+
+	if evento == EventLowStock {
+		m.cfg.Logf(fmt.Sprintf("ALERTA: a %s CTA %s le quedan %d secuencias (mínimo %d, hasta %d)",
+			level.Tipo, level.CTA, level.Restantes, level.Minimo, level.Hasta))
+	} else {
+		m.cfg.Logf(fmt.Sprintf("Stock de %s CTA %s normalizado: %d secuencias disponibles",
+			level.Tipo, level.CTA, level.Restantes))
+	}
+
+	m.sendWebhook(Event{
+		Evento:    evento,
+		Tipo:      level.Tipo,
+		CTA:       level.CTA,
+		Restantes: level.Restantes,
+		Minimo:    level.Minimo,
+		Hasta:     level.Hasta,
+		Fecha:     time.Now(),
+	})
+}
+
+func (m *Monitor) sendWebhook(ev Event) {
+	m.mu.Lock()
+	url := m.webhook
+	m.mu.Unlock()
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	resp, err := m.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		m.cfg.Logf(fmt.Sprintf("Error enviando alerta al webhook: %v", err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		m.cfg.Logf(fmt.Sprintf("El webhook de alertas respondió %d", resp.StatusCode))
+	}
+}
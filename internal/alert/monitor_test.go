@@ -0,0 +1,146 @@
+package alert_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/alert"
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestMonitorHysteresis(t *testing.T) {
+	var mu sync.Mutex
+	var events []alert.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev alert.Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("Error decodificando evento: %v", err)
+		}
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	mon := alert.NewMonitor(alert.Config{
+		WebhookURL:    srv.URL,
+		HysteresisPct: 20,
+		Logf:          func(string) {},
+	})
+	mon.Start()
+
+	// Con MINIMO=10 y 20% de histéresis, la alerta se rearma al llegar a 12
+	for _, restantes := range []int64{12, 9, 8, 7, 11, 9, 12, 9} {
+		mon.Observe(dbf.StockLevel{Tipo: "E32", CTA: "A", Restantes: restantes, Minimo: 10, Hasta: 100})
+	}
+	mon.Stop()
+
+	want := []string{
+		alert.EventLowStock,  // 9
+		alert.EventRecovered, // 12
+		alert.EventLowStock,  // 9
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != len(want) {
+		t.Fatalf("Se esperaban %d eventos, se obtuvieron %d: %+v", len(want), len(events), events)
+	}
+	for i, ev := range events {
+		if ev.Evento != want[i] {
+			t.Errorf("Evento %d = %s, se esperaba %s", i, ev.Evento, want[i])
+		}
+	}
+	if !mon.Low("E32") {
+		t.Error("Low(E32) debería ser true después de la última alerta")
+	}
+	if mon.Low("E31") {
+		t.Error("Low(E31) debería ser false")
+	}
+}
+
+func TestMonitorIgnoresZeroMinimum(t *testing.T) {
+	mon := alert.NewMonitor(alert.Config{Logf: func(string) {}})
+	mon.Start()
+	mon.Observe(dbf.StockLevel{Tipo: "E44", CTA: "A", Restantes: 0, Minimo: 0, Hasta: 50})
+	mon.Stop()
+
+	if mon.Low("E44") {
+		t.Error("Un tipo sin MINIMO no debe generar alertas")
+	}
+}
+
+func TestMonitorObserveAfterStop(t *testing.T) {
+	mon := alert.NewMonitor(alert.Config{Logf: func(string) {}})
+	mon.Start()
+	mon.Stop()
+
+	// Un handler que sigue en curso después del apagado no debe provocar un panic
+	mon.Observe(dbf.StockLevel{Tipo: "E31", CTA: "A", Restantes: 1, Minimo: 10, Hasta: 100})
+	mon.Rollback(dbf.Rollback{Tipo: "E31", CTA: "A", Contador: 1, Emitido: 2})
+	mon.Stop()
+}
+
+func TestMonitorRollbackWebhook(t *testing.T) {
+	events := make(chan alert.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev alert.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer srv.Close()
+
+	mon := alert.NewMonitor(alert.Config{WebhookURL: srv.URL, Logf: func(string) {}})
+	// Se puede avisar antes de Start: el Manager detecta retrocesos al crearse
+	mon.Rollback(dbf.Rollback{Tipo: "E34", CTA: "A", Contador: 0, Emitido: 2})
+	mon.Start()
+	mon.Stop()
+
+	select {
+	case ev := <-events:
+		if ev.Evento != alert.EventRollback || ev.Tipo != "E34" || ev.Contador != 0 || ev.Emitido != 2 {
+			t.Errorf("evento = %+v", ev)
+		}
+	default:
+		t.Fatal("no se envió el aviso de retroceso")
+	}
+}
+
+func TestMonitorReconfigure(t *testing.T) {
+	events := make(chan alert.Event, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev alert.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer srv.Close()
+
+	// Sin webhook la alerta queda registrada pero no se envía
+	mon := alert.NewMonitor(alert.Config{HysteresisPct: 10, Logf: func(string) {}})
+	mon.Start()
+	mon.Observe(dbf.StockLevel{Tipo: "E32", CTA: "A", Restantes: 9, Minimo: 10, Hasta: 100})
+	for deadline := time.Now().Add(2 * time.Second); !mon.Low("E32"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("el monitor no procesó el nivel bajo")
+		}
+	}
+
+	// Con 50% de histéresis 14 ya no rearma la alerta y 15 sí
+	mon.Reconfigure(alert.Config{WebhookURL: srv.URL, HysteresisPct: 50})
+	mon.Observe(dbf.StockLevel{Tipo: "E32", CTA: "A", Restantes: 14, Minimo: 10, Hasta: 100})
+	mon.Observe(dbf.StockLevel{Tipo: "E32", CTA: "A", Restantes: 15, Minimo: 10, Hasta: 100})
+	mon.Stop()
+
+	close(events)
+	var got []string
+	for ev := range events {
+		got = append(got, fmt.Sprintf("%s %d", ev.Evento, ev.Restantes))
+	}
+	if len(got) != 1 || got[0] != alert.EventRecovered+" 15" {
+		t.Errorf("eventos = %v, se esperaba solo %s con 15", got, alert.EventRecovered)
+	}
+}
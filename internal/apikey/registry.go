@@ -0,0 +1,210 @@
+// internal/apikey/registry.go
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ecf-sequence-server/internal/ncf"
+)
+
+// Permisos de una clave. Un permiso asignar:TIPO deja pedir NCF de ese tipo
+// (ver Allocate); asignar:* de cualquiera.
+const (
+	ScopeRead  = "leer"  // consultar tipos, ledger, reportes, respaldos y la pausa
+	ScopeAdmin = "admin" // pausar, restaurar respaldos y recargar la configuración; incluye todos los demás
+
+	allocatePrefix = "asignar:"
+)
+
+var (
+	ErrUnknownKey = errors.New("API Key desconocida")
+	ErrExpired    = errors.New("API Key vencida")
+)
+
+// Allocate es el permiso para asignar NCF del tipo
+func Allocate(tipo string) string {
+	return allocatePrefix + tipo
+}
+
+// Key es una clave del registro. Hash es el SHA-256 de la clave en
+// hexadecimal (ver Hash): la clave en claro solo la ve quien la crea.
+type Key struct {
+	Cliente  string     `json:"cliente"` // p.ej. "caja-03"; va al log y al ledger
+	Hash     string     `json:"hash"`
+	Permisos []string   `json:"permisos"`
+	Expira   *time.Time `json:"expira,omitempty"`
+}
+
+// Allows indica si la clave tiene el permiso scope
+func (k *Key) Allows(scope string) bool {
+	for _, p := range k.Permisos {
+		switch {
+		case p == scope, p == ScopeAdmin:
+			return true
+		case p == Allocate("*") && strings.HasPrefix(scope, allocatePrefix):
+			return true
+		}
+	}
+	return false
+}
+
+// Expired indica si la clave ya venció en now
+func (k *Key) Expired(now time.Time) bool {
+	return k.Expira != nil && !now.Before(*k.Expira)
+}
+
+// Identity son los primeros 16 caracteres del hash: identifican la clave en
+// el ledger y en los listados sin exponerla
+func (k *Key) Identity() string {
+	return k.Hash[:16]
+}
+
+// Registry es el conjunto de claves aceptadas, indexado por hash
+type Registry struct {
+	keys   []Key
+	byHash map[string]*Key
+}
+
+// New arma un registro con keys después de validarlas: cliente no vacío y
+// sin repetir, hash SHA-256 en hexadecimal, al menos un permiso y permisos
+// conocidos (los tipos de asignar:TIPO tienen que estar en el catálogo).
+func New(keys []Key) (*Registry, error) {
+	r := &Registry{keys: keys, byHash: make(map[string]*Key, len(keys))}
+	clientes := make(map[string]bool)
+	for i := range keys {
+		k := &keys[i]
+		if k.Cliente == "" {
+			return nil, fmt.Errorf("clave %d: falta el cliente", i+1)
+		}
+		if clientes[k.Cliente] {
+			return nil, fmt.Errorf("clave %d: el cliente %s está repetido", i+1, k.Cliente)
+		}
+		clientes[k.Cliente] = true
+		if _, err := hex.DecodeString(k.Hash); err != nil || len(k.Hash) != 2*sha256.Size {
+			return nil, fmt.Errorf("clave %d (%s): el hash tiene que ser un SHA-256 en hexadecimal", i+1, k.Cliente)
+		}
+		k.Hash = strings.ToLower(k.Hash)
+		if _, ok := r.byHash[k.Hash]; ok {
+			return nil, fmt.Errorf("clave %d (%s): la misma clave ya está asignada a otro cliente", i+1, k.Cliente)
+		}
+		if len(k.Permisos) == 0 {
+			return nil, fmt.Errorf("clave %d (%s): no tiene permisos", i+1, k.Cliente)
+		}
+		for _, p := range k.Permisos {
+			if err := checkScope(p); err != nil {
+				return nil, fmt.Errorf("clave %d (%s): %v", i+1, k.Cliente, err)
+			}
+		}
+		r.byHash[k.Hash] = k
+	}
+	return r, nil
+}
+
+// checkScope revisa que p sea un permiso conocido
+func checkScope(p string) error {
+	switch {
+	case p == ScopeRead, p == ScopeAdmin, p == Allocate("*"):
+		return nil
+	case strings.HasPrefix(p, allocatePrefix):
+		if _, err := ncf.Lookup(strings.TrimPrefix(p, allocatePrefix)); err != nil {
+			return fmt.Errorf("permiso %q: %v", p, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("permiso desconocido %q (se esperaba %s, %s o %sTIPO)", p, ScopeRead, ScopeAdmin, allocatePrefix)
+}
+
+// Load lee un archivo JSON con la lista de claves. Un archivo que no existe
+// es un registro vacío, para poder crearlo con la primera clave. Por ejemplo:
+//
+//	[{"cliente":"caja-03","hash":"9f86d0...","permisos":["leer","asignar:E32"]},
+//	 {"cliente":"contabilidad","hash":"60303a...","permisos":["leer"],"expira":"2026-01-01T00:00:00-04:00"}]
+func Load(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo claves: %v", err)
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("error interpretando claves %s: %v", path, err)
+	}
+	return keys, nil
+}
+
+// Save escribe keys en path como JSON, legible solo por el dueño. Reemplaza
+// el archivo de una vez para que el servicio nunca lea uno a medias.
+func Save(path string, keys []Key) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creando archivo temporal: %v", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error escribiendo %s: %v", path, err)
+	}
+	return nil
+}
+
+// Keys devuelve las claves del registro
+func (r *Registry) Keys() []Key {
+	return r.keys
+}
+
+// Len es la cantidad de claves del registro
+func (r *Registry) Len() int {
+	return len(r.keys)
+}
+
+// Authenticate busca la clave en claro key. Una clave vencida se devuelve
+// junto con ErrExpired, para poder nombrar al cliente en el log.
+func (r *Registry) Authenticate(key string, now time.Time) (*Key, error) {
+	k, ok := r.byHash[Hash(key)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if k.Expired(now) {
+		return k, ErrExpired
+	}
+	return k, nil
+}
+
+// Hash es el SHA-256 de key en hexadecimal, como se guarda en el registro
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate crea una clave nueva al azar
+func Generate() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generando clave: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,128 @@
+package apikey_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/apikey"
+)
+
+func TestRegistryAuthenticate(t *testing.T) {
+	ayer := time.Now().Add(-24 * time.Hour)
+	reg, err := apikey.New([]apikey.Key{
+		{Cliente: "caja-03", Hash: apikey.Hash("clave-caja"), Permisos: []string{apikey.Allocate("E32")}},
+		{Cliente: "contabilidad", Hash: apikey.Hash("clave-conta"), Permisos: []string{apikey.ScopeRead}, Expira: &ayer},
+		{Cliente: "principal", Hash: strings.ToUpper(apikey.Hash("clave-admin")), Permisos: []string{apikey.ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	k, err := reg.Authenticate("clave-caja", time.Now())
+	if err != nil || k.Cliente != "caja-03" {
+		t.Fatalf("Authenticate(clave-caja) = %+v, %v", k, err)
+	}
+	if !k.Allows(apikey.Allocate("E32")) || k.Allows(apikey.Allocate("E31")) || k.Allows(apikey.ScopeRead) {
+		t.Errorf("permisos de caja-03 = %v", k.Permisos)
+	}
+	if _, err := reg.Authenticate("otra", time.Now()); !errors.Is(err, apikey.ErrUnknownKey) {
+		t.Errorf("Authenticate(otra) error = %v", err)
+	}
+	// Una clave vencida se devuelve para poder nombrar al cliente
+	if k, err := reg.Authenticate("clave-conta", time.Now()); !errors.Is(err, apikey.ErrExpired) || k.Cliente != "contabilidad" {
+		t.Errorf("Authenticate(clave-conta) = %+v, %v", k, err)
+	}
+	// El hash se acepta en mayúsculas y admin incluye todos los permisos
+	k, err = reg.Authenticate("clave-admin", time.Now())
+	if err != nil || !k.Allows(apikey.Allocate("E31")) || !k.Allows(apikey.ScopeRead) {
+		t.Errorf("Authenticate(clave-admin) = %+v, %v", k, err)
+	}
+	if k.Identity() != apikey.Hash("clave-admin")[:16] {
+		t.Errorf("Identity() = %s", k.Identity())
+	}
+}
+
+func TestAllocateAnyType(t *testing.T) {
+	k := apikey.Key{Permisos: []string{apikey.Allocate("*")}}
+	if !k.Allows(apikey.Allocate("E31")) || !k.Allows(apikey.Allocate("B01")) || k.Allows(apikey.ScopeRead) {
+		t.Errorf("asignar:* tiene que permitir cualquier tipo y nada más")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	hash := apikey.Hash("x")
+	tests := []struct {
+		name string
+		keys []apikey.Key
+		want string
+	}{
+		{"sin cliente", []apikey.Key{{Hash: hash, Permisos: []string{"leer"}}}, "falta el cliente"},
+		{"cliente repetido", []apikey.Key{
+			{Cliente: "caja", Hash: hash, Permisos: []string{"leer"}},
+			{Cliente: "caja", Hash: apikey.Hash("y"), Permisos: []string{"leer"}},
+		}, "repetido"},
+		{"hash inválido", []apikey.Key{{Cliente: "caja", Hash: "x", Permisos: []string{"leer"}}}, "SHA-256"},
+		{"clave repetida", []apikey.Key{
+			{Cliente: "caja-1", Hash: hash, Permisos: []string{"leer"}},
+			{Cliente: "caja-2", Hash: hash, Permisos: []string{"leer"}},
+		}, "otro cliente"},
+		{"sin permisos", []apikey.Key{{Cliente: "caja", Hash: hash}}, "no tiene permisos"},
+		{"permiso desconocido", []apikey.Key{{Cliente: "caja", Hash: hash, Permisos: []string{"escribir"}}}, `permiso desconocido "escribir"`},
+		{"tipo desconocido", []apikey.Key{{Cliente: "caja", Hash: hash, Permisos: []string{"asignar:E99"}}}, "E99"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := apikey.New(tt.keys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("New() error = %v, se esperaba que mencione %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claves.json")
+	key, err := apikey.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := apikey.Generate(); other == key || len(key) != 48 {
+		t.Errorf("Generate() = %q, %q", key, other)
+	}
+	expira := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []apikey.Key{{Cliente: "caja-03", Hash: apikey.Hash(key), Permisos: []string{"leer", "asignar:E32"}, Expira: &expira}}
+	if err := apikey.Save(path, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	keys, err := apikey.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	reg, err := apikey.New(keys)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	k, err := reg.Authenticate(key, expira.Add(-time.Second))
+	if err != nil || k.Cliente != "caja-03" || !k.Expira.Equal(expira) {
+		t.Errorf("Authenticate() = %+v, %v", k, err)
+	}
+	if _, err := reg.Authenticate(key, expira); !errors.Is(err, apikey.ErrExpired) {
+		t.Errorf("Authenticate() al vencer error = %v", err)
+	}
+	// El archivo no tiene la clave en claro
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), key) {
+		t.Error("la clave quedó en claro en el archivo")
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	keys, err := apikey.Load(filepath.Join(t.TempDir(), "claves.json"))
+	if err != nil || len(keys) != 0 {
+		t.Errorf("Load() de un archivo que no existe = %v, %v", keys, err)
+	}
+}
@@ -0,0 +1,225 @@
+// Package config carga la configuración del servicio desde un archivo YAML y
+// desde variables de entorno. No define campos propios: cada clave del
+// archivo es el nombre de un flag de la línea de comandos y cada variable es
+// ECF_ más ese nombre en mayúsculas con "_" en lugar de "-" (p.ej.
+// almacen-archivo → ECF_ALMACEN_ARCHIVO). Lo que se pasa en la línea de
+// comandos gana sobre el entorno, y el entorno sobre el archivo.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix es el prefijo de las variables de entorno de la configuración
+const EnvPrefix = "ECF_"
+
+// Orígenes de un valor que no salió del archivo ni de una variable
+const (
+	SourceDefault = "por defecto"
+	SourceFlag    = "línea de comandos"
+)
+
+// FieldError es un valor inválido de la configuración. Campo es el nombre
+// del flag y Origen de dónde salió el valor (p.ej. "ecf-sequence.yaml:12" o
+// "ECF_PORT").
+type FieldError struct {
+	Campo  string
+	Origen string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if e.Origen == "" || e.Origen == SourceDefault || e.Origen == SourceFlag {
+		return fmt.Sprintf("campo %q: %v", e.Campo, e.Err)
+	}
+	return fmt.Sprintf("%s: campo %q: %v", e.Origen, e.Campo, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// EnvName devuelve la variable de entorno que configura el flag name
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Load aplica sobre fs, que ya tiene parseada la línea de comandos, los
+// valores del archivo path (si no es vacío) y los de environ (con el formato
+// de os.Environ). Los flags de skip solo se aceptan en la línea de comandos.
+// Devuelve el origen de cada valor, por nombre de flag, y todos los errores
+// encontrados, no solo el primero.
+func Load(fs *flag.FlagSet, path string, environ []string, skip ...string) (map[string]string, []error) {
+	sources := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { sources[f.Name] = SourceDefault })
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = SourceFlag })
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+
+	var errs []error
+	set := func(name, value, origen string) {
+		if sources[name] == SourceFlag {
+			return
+		}
+		// Value.Set y no fs.Set: fs.Visit tiene que seguir mostrando solo la
+		// línea de comandos para que Load se pueda volver a llamar
+		if err := fs.Lookup(name).Value.Set(value); err != nil {
+			errs = append(errs, &FieldError{Campo: name, Origen: origen, Err: invalidValue(fs.Lookup(name), value)})
+			return
+		}
+		sources[name] = origen
+	}
+
+	if path != "" {
+		values, fileErrs, err := readFile(path)
+		if err != nil {
+			return sources, []error{err}
+		}
+		errs = append(errs, fileErrs...)
+		for _, v := range values {
+			origen := fmt.Sprintf("%s:%d", path, v.line)
+			switch {
+			case fs.Lookup(v.name) == nil:
+				errs = append(errs, &FieldError{Campo: v.name, Origen: origen, Err: errors.New("clave desconocida")})
+			case skipped[v.name]:
+				errs = append(errs, &FieldError{Campo: v.name, Origen: origen, Err: errors.New("solo se acepta en la línea de comandos")})
+			default:
+				set(v.name, v.value, origen)
+			}
+		}
+	}
+
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) {
+			env[k] = v
+		}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if skipped[f.Name] {
+			return
+		}
+		if v, ok := env[EnvName(f.Name)]; ok {
+			set(f.Name, v, EnvName(f.Name))
+		}
+	})
+	return sources, errs
+}
+
+// Clone arma un FlagSet nuevo con los mismos flags que fs, en sus valores
+// por defecto salvo los que sources marca como pasados en la línea de
+// comandos, que conservan su valor actual. Sirve para volver a cargar la
+// configuración con Load sin tocar los flags que está usando el servicio.
+// Los flags de tipos propios que no se pueden copiar (p.ej. los de go test)
+// quedan fuera.
+func Clone(fs *flag.FlagSet, sources map[string]string) *flag.FlagSet {
+	clone := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	fs.VisitAll(func(f *flag.Flag) {
+		t := reflect.TypeOf(f.Value)
+		if t.Kind() != reflect.Pointer {
+			return
+		}
+		value := reflect.New(t.Elem()).Interface().(flag.Value)
+		if value.Set(f.DefValue) != nil {
+			return
+		}
+		clone.Var(value, f.Name, f.Usage)
+		if sources[f.Name] == SourceFlag {
+			clone.Set(f.Name, f.Value.String())
+		}
+	})
+	return clone
+}
+
+// fileValue es una clave del archivo con la línea donde aparece
+type fileValue struct {
+	name, value string
+	line        int
+}
+
+// readFile lee el archivo YAML de path, que tiene que ser un mapa de valores
+// simples. Devuelve las claves válidas y los errores de las demás; err es un
+// archivo que no se pudo leer.
+func readFile(path string) (values []fileValue, errs []error, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error leyendo configuración: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, nil // archivo vacío o solo comentarios
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s:%d: se esperaba un mapa de clave: valor", path, root.Line)
+	}
+
+	seen := make(map[string]int)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, val := root.Content[i], root.Content[i+1]
+		origen := fmt.Sprintf("%s:%d", path, key.Line)
+		if prev, ok := seen[key.Value]; ok {
+			errs = append(errs, &FieldError{Campo: key.Value, Origen: origen, Err: fmt.Errorf("repetida (ya está en la línea %d)", prev)})
+			continue
+		}
+		seen[key.Value] = key.Line
+		if val.Kind != yaml.ScalarNode {
+			errs = append(errs, &FieldError{Campo: key.Value, Origen: origen, Err: errors.New("se esperaba un valor simple")})
+			continue
+		}
+		value := val.Value
+		if val.Tag == "!!null" {
+			value = ""
+		}
+		values = append(values, fileValue{name: key.Value, value: value, line: key.Line})
+	}
+	return values, errs, nil
+}
+
+// invalidValue explica qué se esperaba en el flag f
+func invalidValue(f *flag.Flag, value string) error {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return fmt.Errorf("valor inválido %q", value)
+	}
+	switch getter.Get().(type) {
+	case time.Duration:
+		return fmt.Errorf("valor inválido %q, se esperaba una duración como 90s, 15m o 24h", value)
+	case bool:
+		return fmt.Errorf("valor inválido %q, se esperaba true o false", value)
+	case int, int64, uint, uint64:
+		return fmt.Errorf("valor inválido %q, se esperaba un número entero", value)
+	default:
+		return fmt.Errorf("valor inválido %q", value)
+	}
+}
+
+// Write guarda values (pares clave, valor, en orden) como archivo de
+// configuración en path, legible solo por el dueño. header va como
+// comentario al principio.
+func Write(path string, header string, values [][2]string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(header), "\n") {
+		if line != "" {
+			b.WriteString("# " + line + "\n")
+		}
+	}
+	for _, kv := range values {
+		// Entre comillas simples una ruta de Windows no necesita escapes
+		fmt.Fprintf(&b, "%s: '%s'\n", kv[0], strings.ReplaceAll(kv[1], "'", "''"))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
@@ -0,0 +1,161 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/config"
+)
+
+// newFlags arma un FlagSet como el del servicio y parsea args
+func newFlags(t *testing.T, args ...string) (*flag.FlagSet, *string, *string, *time.Duration, *bool) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	dbf := fs.String("dbf", "", "")
+	port := fs.String("port", "8080", "")
+	ttl := fs.Duration("reserva-ttl", 15*time.Minute, "")
+	debug := fs.Bool("debug", false, "")
+	fs.String("config", "", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs, dbf, port, ttl, debug
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ecf-sequence.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "# comentario\ndbf: 'C:\\facturacion\\FAC_PF_M.DBF'\nport: 9000\nreserva-ttl: 5m\n")
+	fs, dbf, port, ttl, _ := newFlags(t, "-port=7000")
+	env := []string{"ECF_RESERVA_TTL=1m", "ECF_PORT=6000", "PATH=/usr/bin"}
+
+	sources, errs := config.Load(fs, path, env, "config")
+	if len(errs) > 0 {
+		t.Fatalf("Load() errores = %v", errs)
+	}
+	if *dbf != `C:\facturacion\FAC_PF_M.DBF` || sources["dbf"] != path+":2" {
+		t.Errorf("dbf = %q desde %q", *dbf, sources["dbf"])
+	}
+	// La línea de comandos gana sobre el entorno y el entorno sobre el archivo
+	if *port != "7000" || sources["port"] != config.SourceFlag {
+		t.Errorf("port = %q desde %q", *port, sources["port"])
+	}
+	if *ttl != time.Minute || sources["reserva-ttl"] != "ECF_RESERVA_TTL" {
+		t.Errorf("reserva-ttl = %v desde %q", *ttl, sources["reserva-ttl"])
+	}
+	if sources["debug"] != config.SourceDefault {
+		t.Errorf("debug desde %q", sources["debug"])
+	}
+	// Lo que vino del archivo o del entorno no cuenta como línea de comandos
+	var visited []string
+	fs.Visit(func(f *flag.Flag) { visited = append(visited, f.Name) })
+	if len(visited) != 1 || visited[0] != "port" {
+		t.Errorf("fs.Visit() = %v, se esperaba solo port", visited)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	path := writeFile(t, "dbf: a.DBF\nreserva-ttl: 15 minutos\npuerto: 8080\nconfig: otro.yaml\ndebug: [true]\ndbf: b.DBF\n")
+	fs, _, _, _, _ := newFlags(t)
+
+	_, errs := config.Load(fs, path, []string{"ECF_DEBUG=quizas"}, "config")
+	want := map[string]string{
+		"reserva-ttl": path + ":2",
+		"puerto":      path + ":3",
+		"config":      path + ":4",
+		"debug":       path + ":5",
+		"dbf":         path + ":6",
+	}
+	got := make(map[string]string)
+	for _, err := range errs {
+		var fe *config.FieldError
+		if !errors.As(err, &fe) {
+			t.Fatalf("error sin campo: %v", err)
+		}
+		if _, dup := got[fe.Campo]; !dup {
+			got[fe.Campo] = fe.Origen
+		}
+		if !strings.Contains(err.Error(), `campo "`+fe.Campo+`"`) {
+			t.Errorf("el error no nombra el campo: %v", err)
+		}
+	}
+	for campo, origen := range want {
+		if got[campo] != origen {
+			t.Errorf("error de %s desde %q, se esperaba %q (errores: %v)", campo, got[campo], origen, errs)
+		}
+	}
+	if len(errs) != 6 {
+		t.Errorf("Load() = %d errores, se esperaban 6 (con ECF_DEBUG): %v", len(errs), errs)
+	}
+}
+
+func TestLoad_NoFile(t *testing.T) {
+	fs, _, port, _, _ := newFlags(t)
+	if _, errs := config.Load(fs, "", []string{"ECF_PORT=9090"}); len(errs) > 0 || *port != "9090" {
+		t.Errorf("Load() sin archivo = %q, %v", *port, errs)
+	}
+	if _, errs := config.Load(fs, filepath.Join(t.TempDir(), "no.yaml"), nil); len(errs) != 1 {
+		t.Errorf("Load() con un archivo que no existe = %v", errs)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ecf-sequence.yaml")
+	values := [][2]string{{"dbf", `C:\O'Brien\FAC_PF_M.DBF`}, {"port", "8080"}}
+	if err := config.Write(path, "Generado por el instalador", values); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	fs, dbf, port, _, _ := newFlags(t)
+	if _, errs := config.Load(fs, path, nil); len(errs) > 0 {
+		t.Fatalf("Load() errores = %v", errs)
+	}
+	if *dbf != values[0][1] || *port != "8080" {
+		t.Errorf("releído dbf = %q, port = %q", *dbf, *port)
+	}
+}
+
+func TestClone(t *testing.T) {
+	path := writeFile(t, "dbf: FAC_PF_M.DBF\nport: 9000\n")
+	fs, dbf, port, _, _ := newFlags(t, "-port=7000")
+	sources, errs := config.Load(fs, path, nil, "config")
+	if len(errs) > 0 {
+		t.Fatalf("Load() errores = %v", errs)
+	}
+
+	// La copia parte de los valores por defecto salvo la línea de comandos
+	clone := config.Clone(fs, sources)
+	if got := clone.Lookup("dbf").Value.String(); got != "" {
+		t.Errorf("dbf en la copia = %q, se esperaba el valor por defecto", got)
+	}
+	if got := clone.Lookup("reserva-ttl").Value.String(); got != "15m0s" {
+		t.Errorf("reserva-ttl en la copia = %q", got)
+	}
+
+	path = writeFile(t, "dbf: OTRO.DBF\nport: 9000\n")
+	cloneSources, errs := config.Load(clone, path, nil, "config")
+	if len(errs) > 0 {
+		t.Fatalf("Load() sobre la copia errores = %v", errs)
+	}
+	if got := clone.Lookup("dbf").Value.String(); got != "OTRO.DBF" {
+		t.Errorf("dbf en la copia = %q", got)
+	}
+	if got := clone.Lookup("port").Value.String(); got != "7000" || cloneSources["port"] != config.SourceFlag {
+		t.Errorf("port en la copia = %q desde %q", got, cloneSources["port"])
+	}
+	// Los flags originales no cambian
+	if *dbf != "FAC_PF_M.DBF" || *port != "7000" {
+		t.Errorf("el original cambió: dbf = %q, port = %q", *dbf, *port)
+	}
+}
@@ -0,0 +1,51 @@
+package dbf_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestManager_GetSequences(t *testing.T) {
+	mgr, err := dbf.NewManager(copyFixture(t))
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+
+	// E34 arranca en 0 con CANTSECUEN=1000
+	sequences, first, err := mgr.GetSequences("E34", "A", 500)
+	if err != nil {
+		t.Fatalf("GetSequences() error = %v", err)
+	}
+	if first != 1 || len(sequences) != 500 {
+		t.Fatalf("GetSequences() = %d números desde %d, se esperaban 500 desde 1", len(sequences), first)
+	}
+	for i, seq := range sequences {
+		if want := fmt.Sprintf("E34%010d", first+int64(i)); seq != want {
+			t.Fatalf("sequences[%d] = %s, se esperaba %s", i, seq, want)
+		}
+	}
+
+	// El siguiente número individual continúa después del lote
+	if _, num, err := mgr.GetSequence("E34", "A"); err != nil || num != 501 {
+		t.Fatalf("GetSequence() = %d, %v; se esperaba 501", num, err)
+	}
+
+	// Todo o nada: 500 más no caben (501 + 500 > 1000) y el contador no se mueve
+	if _, _, err := mgr.GetSequences("E34", "A", 500); !errors.Is(err, dbf.ErrRangeExhausted) {
+		t.Fatalf("GetSequences() error = %v, se esperaba %v", err, dbf.ErrRangeExhausted)
+	}
+	sequences, first, err = mgr.GetSequences("E34", "A", 499)
+	if err != nil {
+		t.Fatalf("GetSequences() error = %v", err)
+	}
+	if first != 502 || sequences[len(sequences)-1] != "E340000001000" {
+		t.Errorf("GetSequences() desde %d hasta %s, se esperaba 502 hasta E340000001000", first, sequences[len(sequences)-1])
+	}
+
+	if _, _, err := mgr.GetSequences("E34", "A", 0); err == nil {
+		t.Error("GetSequences() con count=0 debería fallar")
+	}
+}
@@ -0,0 +1,203 @@
+// internal/dbf/cache.go
+package dbf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/LindsayBradford/go-dbf/godbf"
+)
+
+// fileStamp identifica una versión del DBF en disco. El ERP en FoxPro edita el
+// mismo archivo, así que cualquier cambio de fecha de modificación, tamaño o
+// fecha de actualización del encabezado obliga a releerlo.
+type fileStamp struct {
+	modTime int64 // UnixNano
+	size    int64
+	updated [3]byte // AA MM DD del encabezado
+}
+
+func statDBF(path string) (fileStamp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("error abriendo DBF: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("error leyendo DBF: %v", err)
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return fileStamp{}, fmt.Errorf("error leyendo encabezado DBF: %v", err)
+	}
+	return fileStamp{
+		modTime: info.ModTime().UnixNano(),
+		size:    info.Size(),
+		updated: [3]byte{head[1], head[2], head[3]},
+	}, nil
+}
+
+// cachedTable devuelve la tabla en memoria y solo la relee si el archivo
+// cambió desde la última lectura o escritura propia. En pausa no se abre el
+// archivo (ver Suspend). Se llama con m.mu tomado.
+func (m *Manager) cachedTable() (*godbf.DbfTable, error) {
+	if m.suspended {
+		if m.table == nil {
+			return nil, ErrSuspended
+		}
+		return m.table, nil
+	}
+	stamp, err := statDBF(m.dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	if m.table != nil && stamp == m.stamp {
+		return m.table, nil
+	}
+
+	table, err := m.reloadTable(stamp)
+	if err != nil {
+		return nil, err
+	}
+	// El archivo cambió por fuera: comprobar que no volvió atrás
+	m.checkRollbacks(table)
+	return table, nil
+}
+
+// reloadTable lee el DBF completo desde disco y lo deja como tabla en memoria
+// para la versión stamp. Se llama con m.mu tomado.
+func (m *Manager) reloadTable(stamp fileStamp) (*godbf.DbfTable, error) {
+	data, err := os.ReadFile(m.dbfPath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo DBF: %v", err)
+	}
+	// Si alguien amplió los campos mientras corríamos, tomar los nuevos anchos
+	header, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < header.HeaderLen+header.NumRecords*header.RecordLen {
+		return nil, fmt.Errorf("el DBF está truncado: %d registros declarados y %d bytes", header.NumRecords, len(data))
+	}
+	// godbf se queda con el slice y lo modifica; raw tiene que seguir igual al disco
+	table, err := godbf.NewFromByteArray(bytes.Clone(data), m.tableEncoding(header))
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DBF: %v", err)
+	}
+	m.header, m.widths = header, counterWidths(header)
+	m.table, m.raw, m.tipos, m.stamp = table, data, nil, stamp
+	m.reloads++
+	return table, nil
+}
+
+// lockedTable vuelve a tomar la tabla después de bloquear el registro row y
+// lo compara con el disco antes de escribir. La versión del archivo (ver
+// fileStamp) no alcanza: en recursos SMB o FAT la fecha de modificación tiene
+// resolución de 2 segundos, así que una edición del ERP en el mismo segundo,
+// con el mismo tamaño y la misma fecha de encabezado, no la cambia. Leer el
+// registro bloqueado es barato; si no coincide con la copia en memoria se
+// relee el archivo. Se llama con m.mu tomado.
+func (m *Manager) lockedTable(lock *dbfLock, row int) (*godbf.DbfTable, error) {
+	table, err := m.cachedTable()
+	if err != nil {
+		return nil, err
+	}
+	if row >= m.header.NumRecords {
+		return table, nil
+	}
+	start := m.header.HeaderLen + row*m.header.RecordLen
+	rec := make([]byte, m.header.RecordLen)
+	if _, err := lock.file.ReadAt(rec, int64(start)); err != nil {
+		return nil, fmt.Errorf("error leyendo el registro %d: %v", row+1, err)
+	}
+	if bytes.Equal(rec, m.raw[start:start+len(rec)]) {
+		return table, nil
+	}
+
+	m.Log(fmt.Sprintf("El registro %d cambió en disco sin cambiar la fecha del archivo; se relee el DBF", row+1))
+	stamp, err := statDBF(m.dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	if table, err = m.reloadTable(stamp); err != nil {
+		return nil, err
+	}
+	m.checkRollbacks(table)
+	return table, nil
+}
+
+// writeRecordField escribe un campo directamente en el archivo (ver
+// writeField) y después en la tabla en memoria. La versión resultante se
+// registra como propia, para no releerla en la próxima llamada, solo si justo
+// antes de escribir el archivo seguía en la versión de la tabla: si el ERP
+// tocó otro registro desde la última lectura, tomar la versión de después de
+// nuestra escritura escondería ese cambio, así que la tabla se descarta.
+func (m *Manager) writeRecordField(table *godbf.DbfTable, row int, name, value string) error {
+	before, err := statDBF(m.dbfPath)
+	if err != nil {
+		return err
+	}
+	if err := writeField(m.dbfPath, m.header, m.tableEncoding(m.header), row, name, value); err != nil {
+		// No se sabe qué llegó al disco: la próxima lectura lo relee
+		m.invalidate()
+		return err
+	}
+	// raw queda igual al disco para la comparación de lockedTable
+	f, _ := m.header.field(name)
+	data, err := encodeField(f, m.tableEncoding(m.header), value)
+	if err != nil {
+		m.invalidate()
+		return nil
+	}
+	copy(m.raw[m.header.HeaderLen+row*m.header.RecordLen+f.Offset:], data)
+	// El número ya quedó en el DBF; si el índice no se pudo actualizar se
+	// avisa y FoxPro lo corrige con REINDEX
+	if m.indexed[name] {
+		if err := m.updateIndex(); err != nil {
+			m.Log(fmt.Sprintf("ADVERTENCIA: no se pudo actualizar el índice %s: %v", m.cdxPath, err))
+		}
+	}
+	m.tipos = nil
+	if err := table.SetFieldValueByName(row, name, value); err != nil {
+		m.invalidate()
+		return nil
+	}
+	if before != m.stamp {
+		m.invalidate()
+		return nil
+	}
+	stamp, err := statDBF(m.dbfPath)
+	if err != nil {
+		m.invalidate()
+		return nil
+	}
+	m.stamp = stamp
+	return nil
+}
+
+// invalidate descarta la tabla en memoria; se usa cuando quedó modificada
+// sin llegar a guardarse.
+func (m *Manager) invalidate() {
+	m.table, m.tipos = nil, nil
+}
+
+// Reloads devuelve cuántas veces se leyó el DBF completo desde disco
+func (m *Manager) Reloads() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reloads
+}
+
+func counterWidths(h *dbfHeader) map[string]int {
+	widths := make(map[string]int)
+	for _, name := range []string{"NUMERO_1", "NUMERO_2"} {
+		if f, ok := h.field(name); ok {
+			widths[name] = f.Length
+		}
+	}
+	return widths
+}
@@ -0,0 +1,109 @@
+package dbf_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestManager_CacheDetectsExternalChanges(t *testing.T) {
+	path := copyFixture(t)
+
+	// mgr hace de servicio y erp de otro programa que edita el mismo archivo
+	// (con su propio journal: el de mgr es de un solo dueño)
+	mgr := mustManager(t, path)
+	erp := mustManager(t, path, dbf.WithJournal(filepath.Join(t.TempDir(), "erp.wal")))
+
+	if _, err := mgr.GetRecordTypes(); err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	mgr.GetRecordTypes()
+	if mgr.Reloads() != 1 {
+		t.Errorf("Reloads() = %d, dos lecturas sin cambios deben leer el disco una sola vez", mgr.Reloads())
+	}
+
+	// Las escrituras propias no obligan a releer
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000001" {
+		t.Fatalf("GetSequence() = %s, %v", seq, err)
+	}
+	mgr.GetRecordTypes()
+	if mgr.Reloads() != 1 {
+		t.Errorf("Reloads() = %d después de una escritura propia, se esperaba 1", mgr.Reloads())
+	}
+
+	// Un cambio externo se detecta y no se repite el número
+	if seq, _, err := erp.GetSequence("E34", "A"); err != nil || seq != "E340000000002" {
+		t.Fatalf("GetSequence() externo = %s, %v", seq, err)
+	}
+	// Asegurar una fecha de modificación distinta aunque el sistema de archivos
+	// tenga poca resolución
+	later := time.Now().Add(2 * time.Second)
+	os.Chtimes(path, later, later)
+
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000003" {
+		t.Errorf("GetSequence() tras cambio externo = %s, %v", seq, err)
+	}
+	if mgr.Reloads() != 2 {
+		t.Errorf("Reloads() = %d, se esperaba 2", mgr.Reloads())
+	}
+}
+
+func TestManager_LockedRecordChangedWithSameStamp(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path)
+	erp := mustManager(t, path, dbf.WithJournal(filepath.Join(t.TempDir(), "erp.wal")))
+
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000001" {
+		t.Fatalf("GetSequence() = %s, %v", seq, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// En un recurso con fecha de 2 segundos la edición del ERP no cambia la
+	// versión del archivo: mismo tamaño, misma fecha de encabezado y de
+	// modificación
+	if seq, _, err := erp.GetSequence("E34", "A"); err != nil || seq != "E340000000002" {
+		t.Fatalf("GetSequence() externo = %s, %v", seq, err)
+	}
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000003" {
+		t.Errorf("GetSequence() tras cambio con la misma fecha = %s, %v; se repitió un número", seq, err)
+	}
+	if mgr.Reloads() != 2 {
+		t.Errorf("Reloads() = %d, se esperaba 2", mgr.Reloads())
+	}
+}
+
+func BenchmarkManager_GetRecordTypes(b *testing.B) {
+	mgr, err := dbf.NewManager(copyFixture(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := mgr.GetRecordTypes(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkManager_GetSequence(b *testing.B) {
+	mgr, err := dbf.NewManager(copyFixture(b), dbf.WithPartitions([]dbf.Partition{
+		{Tipo: "E32", CTA: "A", Desde: 1, Hasta: 1000000},
+	}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := mgr.GetSequence("E32", "A"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
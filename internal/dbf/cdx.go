@@ -0,0 +1,238 @@
+// internal/dbf/cdx.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Estructura del índice compacto de FoxPro (CDX): un encabezado de 1024 bytes
+// por cada índice y nodos de 512. El primer índice del archivo es el
+// directorio de tags; cada una de sus claves es el nombre de un tag y apunta
+// al encabezado de ese tag.
+const (
+	cdxHeaderSize = 1024
+	cdxNodeSize   = 512
+
+	cdxLeafData     = cdxNodeSize - 24 // bytes para claves en un nodo hoja
+	cdxInteriorData = cdxNodeSize - 12 // bytes para claves en un nodo interior
+
+	cdxNodeInterior = 0x00
+	cdxNodeRoot     = 0x01
+	cdxNodeLeaf     = 0x02
+
+	cdxOptUnique   = 0x01
+	cdxOptFor      = 0x08
+	cdxOptCompact  = 0x20
+	cdxOptCompound = 0x40
+	cdxOptStruct   = 0x80
+
+	cdxNoNode = 0xFFFFFFFF
+)
+
+// CDXTag es un tag del índice estructural
+type CDXTag struct {
+	Name       string
+	Expr       string // expresión de la clave, p.ej. "UPPER(NOMBRE)"
+	For        string // condición FOR; vacía si indexa todos los registros
+	KeyLen     int
+	Unique     bool
+	Descending bool
+
+	header   int64 // posición del encabezado del tag en el archivo
+	options  byte
+	reserved []byte // bytes 16-501 del encabezado, que FoxPro usa a su manera
+}
+
+// CDXKey es una entrada de un tag: la clave tal como está en el índice y el
+// número de registro (base 1) al que apunta.
+type CDXKey struct {
+	Key   []byte
+	Recno int
+}
+
+// CDX es un índice estructural leído completo en memoria
+type CDX struct {
+	Path string
+	Tags []CDXTag
+	data []byte
+}
+
+// ReadCDX lee el índice y su directorio de tags
+func ReadCDX(path string) (*CDX, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo CDX: %v", err)
+	}
+	c := &CDX{Path: path, data: data}
+
+	dir, err := c.readTag(0)
+	if err != nil {
+		return nil, fmt.Errorf("directorio de tags del CDX: %v", err)
+	}
+	entries, err := c.keys(dir, ' ')
+	if err != nil {
+		return nil, fmt.Errorf("directorio de tags del CDX: %v", err)
+	}
+	for _, e := range entries {
+		tag, err := c.readTag(int64(e.Recno))
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %v", strings.TrimSpace(string(e.Key)), err)
+		}
+		tag.Name = strings.TrimRight(string(bytes.TrimRight(e.Key, "\x00")), " ")
+		c.Tags = append(c.Tags, tag)
+	}
+	return c, nil
+}
+
+// Tag devuelve el tag name (sin distinguir mayúsculas)
+func (c *CDX) Tag(name string) (CDXTag, bool) {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return CDXTag{}, false
+}
+
+// readTag interpreta el encabezado de índice que empieza en off
+func (c *CDX) readTag(off int64) (CDXTag, error) {
+	if off < 0 || off+cdxHeaderSize > int64(len(c.data)) {
+		return CDXTag{}, fmt.Errorf("encabezado fuera del archivo (%#x)", off)
+	}
+	h := c.data[off : off+cdxHeaderSize]
+	tag := CDXTag{
+		KeyLen:     int(binary.LittleEndian.Uint16(h[12:14])),
+		options:    h[14],
+		Descending: binary.LittleEndian.Uint16(h[502:504]) != 0,
+		header:     off,
+		reserved:   h[16:502],
+	}
+	tag.Unique = tag.options&cdxOptUnique != 0
+	if tag.options&cdxOptCompact == 0 {
+		return CDXTag{}, fmt.Errorf("índice no compacto (opciones %#x)", tag.options)
+	}
+	if tag.KeyLen <= 0 || tag.KeyLen > 240 {
+		return CDXTag{}, fmt.Errorf("largo de clave inválido: %d", tag.KeyLen)
+	}
+
+	keyPool := int(binary.LittleEndian.Uint16(h[510:512]))
+	forPool := int(binary.LittleEndian.Uint16(h[506:508]))
+	if keyPool+forPool > cdxHeaderSize-512 {
+		return CDXTag{}, fmt.Errorf("expresiones fuera del encabezado")
+	}
+	pool := h[512:]
+	tag.Expr = cString(pool[:keyPool])
+	tag.For = cString(pool[keyPool : keyPool+forPool])
+	return tag, nil
+}
+
+// Keys devuelve las entradas del tag en el orden en que están en el índice.
+// pad es el byte con el que FoxPro completa las claves: espacio para las de
+// caracteres y cero para las numéricas y de fecha.
+func (c *CDX) Keys(tag CDXTag, pad byte) ([]CDXKey, error) {
+	return c.keys(tag, pad)
+}
+
+func (c *CDX) keys(tag CDXTag, pad byte) ([]CDXKey, error) {
+	root := int64(binary.LittleEndian.Uint32(c.data[tag.header:]))
+
+	// Bajar por el primer hijo hasta la hoja de más a la izquierda
+	node := root
+	for depth := 0; ; depth++ {
+		n, err := c.node(node)
+		if err != nil {
+			return nil, err
+		}
+		attr := binary.LittleEndian.Uint16(n[0:2])
+		if attr&cdxNodeLeaf != 0 {
+			break
+		}
+		if depth > 32 || binary.LittleEndian.Uint16(n[2:4]) == 0 {
+			return nil, fmt.Errorf("nodo interior inválido en %#x", node)
+		}
+		node = int64(binary.BigEndian.Uint32(n[12+tag.KeyLen+4:]))
+	}
+
+	// Recorrer las hojas por el puntero al hermano derecho
+	var keys []CDXKey
+	visited := make(map[int64]bool)
+	for node != cdxNoNode {
+		if visited[node] {
+			return nil, fmt.Errorf("las hojas del índice forman un ciclo en %#x", node)
+		}
+		visited[node] = true
+		n, err := c.node(node)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := decodeLeaf(n, tag.KeyLen, pad)
+		if err != nil {
+			return nil, fmt.Errorf("nodo %#x: %v", node, err)
+		}
+		keys = append(keys, leaf...)
+		node = int64(binary.LittleEndian.Uint32(n[8:12]))
+	}
+	return keys, nil
+}
+
+func (c *CDX) node(off int64) ([]byte, error) {
+	if off < cdxHeaderSize || off+cdxNodeSize > int64(len(c.data)) {
+		return nil, fmt.Errorf("nodo fuera del archivo (%#x)", off)
+	}
+	return c.data[off : off+cdxNodeSize], nil
+}
+
+// decodeLeaf descomprime las claves de un nodo hoja. Cada entrada guarda el
+// número de registro, cuántos bytes comparte con la clave anterior y cuántos
+// bytes de relleno tiene al final; los bytes restantes se guardan desde el
+// final del nodo hacia atrás.
+func decodeLeaf(n []byte, keyLen int, pad byte) ([]CDXKey, error) {
+	count := int(binary.LittleEndian.Uint16(n[2:4]))
+	recMask := uint64(binary.LittleEndian.Uint32(n[14:18]))
+	dupMask := uint64(n[18])
+	trailMask := uint64(n[19])
+	recBits, dupBits := uint(n[20]), uint(n[21])
+	size := int(n[23])
+	if size < 1 || size > 8 || 24+count*size > cdxNodeSize {
+		return nil, fmt.Errorf("hoja con %d claves de %d bytes", count, size)
+	}
+
+	keys := make([]CDXKey, 0, count)
+	prev := make([]byte, keyLen)
+	end := cdxNodeSize
+	for i := 0; i < count; i++ {
+		var info [8]byte
+		copy(info[:], n[24+i*size:24+(i+1)*size])
+		v := binary.LittleEndian.Uint64(info[:])
+		recno := int(v & recMask)
+		dup := int((v >> recBits) & dupMask)
+		trail := int((v >> (recBits + dupBits)) & trailMask)
+
+		newLen := keyLen - dup - trail
+		if newLen < 0 || end-newLen < 24+count*size {
+			return nil, fmt.Errorf("clave %d mal formada", i+1)
+		}
+		key := make([]byte, keyLen)
+		copy(key, prev[:dup])
+		copy(key[dup:], n[end-newLen:end])
+		for j := keyLen - trail; j < keyLen; j++ {
+			key[j] = pad
+		}
+		end -= newLen
+		keys = append(keys, CDXKey{Key: key, Recno: recno})
+		prev = key
+	}
+	return keys, nil
+}
+
+// cString corta b en el primer byte nulo
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
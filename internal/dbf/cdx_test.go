@@ -0,0 +1,203 @@
+package dbf_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestReadCDX(t *testing.T) {
+	cdx, err := dbf.ReadCDX("FAC_PF_M.CDX")
+	if err != nil {
+		t.Fatalf("ReadCDX() error = %v", err)
+	}
+	want := map[string]string{"CODIGO": "COD_PF_F", "NOMBRE": "NOMBRE"}
+	if len(cdx.Tags) != len(want) {
+		t.Fatalf("tags = %+v, se esperaban %v", cdx.Tags, want)
+	}
+	for _, tag := range cdx.Tags {
+		if want[tag.Name] != tag.Expr {
+			t.Errorf("tag %s con expresión %q, se esperaba %q", tag.Name, tag.Expr, want[tag.Name])
+		}
+	}
+
+	tag, ok := cdx.Tag("nombre")
+	if !ok || tag.KeyLen != 50 {
+		t.Fatalf("Tag(nombre) = %+v, %v", tag, ok)
+	}
+	keys, err := cdx.Keys(tag, ' ')
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if len(keys) != 9 || !strings.HasPrefix(string(keys[0].Key), "COMPROBANTES GUBERNAMENTALES") || keys[0].Recno != 4 {
+		t.Errorf("primera clave = %q (registro %d) de %d", keys[0].Key, keys[0].Recno, len(keys))
+	}
+}
+
+func TestVerifyIndex_Fixture(t *testing.T) {
+	report, err := dbf.VerifyIndex(copyFixture(t))
+	if err != nil {
+		t.Fatalf("VerifyIndex() error = %v", err)
+	}
+	if len(report.Tags) != 2 || len(report.Omitidos) != 0 || len(report.Problemas) != 0 {
+		t.Errorf("reporte = %+v", report)
+	}
+}
+
+func TestVerifyIndex_MissingCDX(t *testing.T) {
+	path := copyFixture(t)
+	if err := os.Remove(strings.TrimSuffix(path, ".DBF") + ".CDX"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := dbf.VerifyIndex(path)
+	if err != nil {
+		t.Fatalf("VerifyIndex() error = %v", err)
+	}
+	// El encabezado del DBF de prueba declara el CDX estructural
+	if len(report.Problemas) != 1 || !strings.Contains(report.Problemas[0].Detalle, "no existe") {
+		t.Errorf("problemas = %+v", report.Problemas)
+	}
+}
+
+func TestRebuildIndex_MatchesFoxPro(t *testing.T) {
+	path := copyFixture(t)
+	if err := dbf.RebuildIndex(path); err != nil {
+		t.Fatalf("RebuildIndex() error = %v", err)
+	}
+	got, err := os.ReadFile(strings.TrimSuffix(path, ".DBF") + ".CDX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("FAC_PF_M.CDX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("el CDX reconstruido difiere del que generó FoxPro (%d y %d bytes)", len(got), len(want))
+	}
+}
+
+// indexCounter cambia la expresión del tag CODIGO por NUMERO_1 (mismo largo),
+// como si el ERP indexara el contador. Las claves quedan con COD_PF_F.
+func indexCounter(t *testing.T, path string) string {
+	t.Helper()
+	cdxPath := strings.TrimSuffix(path, ".DBF") + ".CDX"
+	data, err := os.ReadFile(cdxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("COD_PF_F\x00"), []byte("NUMERO_1\x00"), 1)
+	if err := os.WriteFile(cdxPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return cdxPath
+}
+
+func TestVerifyIndex_Mismatch(t *testing.T) {
+	path := copyFixture(t)
+	indexCounter(t, path)
+
+	report, err := dbf.VerifyIndex(path)
+	if err != nil {
+		t.Fatalf("VerifyIndex() error = %v", err)
+	}
+	if len(report.Problemas) == 0 {
+		t.Fatal("no se detectaron diferencias entre el índice y la tabla")
+	}
+	for _, p := range report.Problemas {
+		if p.Tag != "CODIGO" || p.Recno == 0 {
+			t.Errorf("problema inesperado: %+v", p)
+		}
+	}
+
+	if err := dbf.RebuildIndex(path); err != nil {
+		t.Fatalf("RebuildIndex() error = %v", err)
+	}
+	if report, err = dbf.VerifyIndex(path); err != nil || len(report.Problemas) != 0 {
+		t.Errorf("después de reconstruir: %+v, %v", report, err)
+	}
+}
+
+func TestManager_UpdatesIndexedCounter(t *testing.T) {
+	path := copyFixture(t)
+	cdxPath := indexCounter(t, path)
+	if err := dbf.RebuildIndex(path); err != nil {
+		t.Fatalf("RebuildIndex() error = %v", err)
+	}
+
+	mgr := mustManager(t, path)
+	defer mgr.Close()
+	_, n, err := mgr.GetSequence("E34", "A")
+	if err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+
+	report, err := dbf.VerifyIndex(path)
+	if err != nil || len(report.Problemas) != 0 {
+		t.Fatalf("el índice no acompañó la asignación: %+v, %v", report, err)
+	}
+	// La reescritura del CDX quedó anotada en el journal antes de hacerse
+	wal, err := os.ReadFile(strings.TrimSuffix(path, ".DBF") + ".WAL")
+	if err != nil || !bytes.Contains(wal, []byte(`"op":"indice"`)) {
+		t.Errorf("el journal no registra la escritura del índice: %s, %v", wal, err)
+	}
+	cdx, err := dbf.ReadCDX(cdxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, _ := cdx.Tag("CODIGO")
+	keys, err := cdx.Keys(tag, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, 8)
+	binary.BigEndian.PutUint64(want, math.Float64bits(float64(n))|1<<63)
+	for _, k := range keys {
+		if k.Recno == 7 && !bytes.Equal(k.Key, want) {
+			t.Errorf("clave de E34 = %x, se esperaba %x (NUMERO_1 = %d)", k.Key, want, n)
+		}
+	}
+}
+
+func TestManager_RecoversInterruptedIndexWrite(t *testing.T) {
+	path := copyFixture(t)
+	// El CDX no coincide con la tabla, como si el proceso hubiera muerto a
+	// mitad de reescribirlo, y su intención quedó sin confirmar
+	indexCounter(t, path)
+	wal := strings.TrimSuffix(path, ".DBF") + ".WAL"
+	content := `{"id":1,"op":"indice","fecha":"2026-10-16T08:00:00Z"}` + "\n"
+	if err := os.WriteFile(wal, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := mustManager(t, path)
+	defer mgr.Close()
+	report, err := dbf.VerifyIndex(path)
+	if err != nil || len(report.Problemas) != 0 {
+		t.Errorf("el índice no se reconstruyó al recuperar el journal: %+v, %v", report, err)
+	}
+}
+
+func TestNewManager_RejectsUnmaintainableIndex(t *testing.T) {
+	path := copyFixture(t)
+	cdxPath := indexCounter(t, path)
+	// El tag NOMBRE pasa a usar un campo que no existe en la tabla
+	data, err := os.ReadFile(cdxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("NOMBRE\x00"), []byte("SOUNDX\x00"), 1)
+	if err := os.WriteFile(cdxPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if mgr, err := dbf.NewManager(path); err == nil {
+		mgr.Close()
+		t.Fatal("NewManager() aceptó un CDX que indexa los contadores y no se puede reconstruir")
+	}
+}
@@ -0,0 +1,250 @@
+// internal/dbf/cdxbuild.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+// cdxLayout son los anchos en bits de cada entrada de una hoja. FoxPro usa
+// al menos 3 bytes por entrada; el número de registro se queda con lo que no
+// usan los contadores de bytes repetidos y de relleno.
+type cdxLayout struct {
+	recBits, countBits uint
+	size               int
+}
+
+func newCDXLayout(maxRecno, keyLen int) cdxLayout {
+	countBits := uint(bits.Len(uint(keyLen)))
+	need := uint(bits.Len(uint(maxRecno))) + 2*countBits
+	size := max(3, int((need+7)/8))
+	return cdxLayout{recBits: uint(size*8) - 2*countBits, countBits: countBits, size: size}
+}
+
+// sortKeys ordena las entradas como las guarda el índice: por clave y, a
+// igual clave, por número de registro. En un tag UNIQUE queda solo el primer
+// registro de cada clave.
+func sortKeys(keys []CDXKey, unique bool) []CDXKey {
+	sort.SliceStable(keys, func(i, j int) bool {
+		if c := bytes.Compare(keys[i].Key, keys[j].Key); c != 0 {
+			return c < 0
+		}
+		return keys[i].Recno < keys[j].Recno
+	})
+	if !unique {
+		return keys
+	}
+	out := keys[:0]
+	for i, k := range keys {
+		if i > 0 && bytes.Equal(k.Key, out[len(out)-1].Key) {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// buildTree arma los nodos de un índice con las claves ya ordenadas. Los nodos
+// quedan contiguos a partir de base: primero las hojas y después cada nivel
+// interior. Devuelve los nodos y la posición de la raíz.
+func buildTree(keys []CDXKey, keyLen int, pad byte, base int64) ([]byte, int64) {
+	maxRecno := 0
+	for _, k := range keys {
+		maxRecno = max(maxRecno, k.Recno)
+	}
+	layout := newCDXLayout(maxRecno, keyLen)
+
+	// Hojas: se llenan mientras entren la entrada y los bytes nuevos de la clave
+	var leaves [][]CDXKey
+	var current []CDXKey
+	used := 0
+	var prev []byte
+	for _, k := range keys {
+		dup, trail := compressKey(prev, k.Key, pad)
+		cost := layout.size + keyLen - dup - trail
+		if len(current) > 0 && used+cost > cdxLeafData {
+			leaves = append(leaves, current)
+			current, used, prev = nil, 0, nil
+			dup, trail = compressKey(nil, k.Key, pad)
+			cost = layout.size + keyLen - dup - trail
+		}
+		current = append(current, k)
+		used += cost
+		prev = k.Key
+	}
+	leaves = append(leaves, current)
+
+	var nodes [][]byte
+	level := make([]int, len(leaves)) // nodos del nivel actual
+	last := make([]CDXKey, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = len(nodes)
+		nodes = append(nodes, encodeLeaf(leaf, keyLen, pad, layout))
+		if len(leaf) > 0 {
+			last[i] = leaf[len(leaf)-1]
+		}
+	}
+	linkSiblings(nodes, level, base)
+
+	// Niveles interiores hasta que quede un solo nodo
+	perNode := cdxInteriorData / (keyLen + 8)
+	for len(level) > 1 {
+		var upper []int
+		var upperLast []CDXKey
+		for i := 0; i < len(level); i += perNode {
+			j := min(i+perNode, len(level))
+			n := make([]byte, cdxNodeSize)
+			binary.LittleEndian.PutUint16(n[0:2], cdxNodeInterior)
+			binary.LittleEndian.PutUint16(n[2:4], uint16(j-i))
+			for e := i; e < j; e++ {
+				entry := n[12+(e-i)*(keyLen+8):]
+				copy(entry, last[e].Key)
+				binary.BigEndian.PutUint32(entry[keyLen:], uint32(last[e].Recno))
+				binary.BigEndian.PutUint32(entry[keyLen+4:], uint32(base+int64(level[e])*cdxNodeSize))
+			}
+			upper = append(upper, len(nodes))
+			upperLast = append(upperLast, last[j-1])
+			nodes = append(nodes, n)
+		}
+		linkSiblings(nodes, upper, base)
+		level, last = upper, upperLast
+	}
+
+	root := nodes[level[0]]
+	binary.LittleEndian.PutUint16(root[0:2], binary.LittleEndian.Uint16(root[0:2])|cdxNodeRoot)
+	return bytes.Join(nodes, nil), base + int64(level[0])*cdxNodeSize
+}
+
+// compressKey calcula cuántos bytes comparte key con prev y cuántos bytes de
+// relleno tiene al final, sin que entre los dos pasen del largo de la clave.
+func compressKey(prev, key []byte, pad byte) (dup, trail int) {
+	for dup < len(prev) && dup < len(key) && prev[dup] == key[dup] {
+		dup++
+	}
+	for trail < len(key)-dup && key[len(key)-1-trail] == pad {
+		trail++
+	}
+	return dup, trail
+}
+
+// encodeLeaf arma una hoja: las entradas al principio y los bytes nuevos de
+// cada clave desde el final hacia atrás (ver decodeLeaf).
+func encodeLeaf(keys []CDXKey, keyLen int, pad byte, layout cdxLayout) []byte {
+	n := make([]byte, cdxNodeSize)
+	binary.LittleEndian.PutUint16(n[0:2], cdxNodeLeaf)
+	binary.LittleEndian.PutUint16(n[2:4], uint16(len(keys)))
+	countMask := uint64(1)<<layout.countBits - 1
+	binary.LittleEndian.PutUint32(n[14:18], uint32(uint64(1)<<layout.recBits-1))
+	n[18], n[19] = byte(countMask), byte(countMask)
+	n[20], n[21], n[22] = byte(layout.recBits), byte(layout.countBits), byte(layout.countBits)
+	n[23] = byte(layout.size)
+
+	end := cdxNodeSize
+	var prev []byte
+	for i, k := range keys {
+		dup, trail := compressKey(prev, k.Key, pad)
+		v := uint64(k.Recno) | uint64(dup)<<layout.recBits | uint64(trail)<<(layout.recBits+layout.countBits)
+		var info [8]byte
+		binary.LittleEndian.PutUint64(info[:], v)
+		copy(n[24+i*layout.size:], info[:layout.size])
+
+		fresh := k.Key[dup : keyLen-trail]
+		end -= len(fresh)
+		copy(n[end:], fresh)
+		prev = k.Key
+	}
+	binary.LittleEndian.PutUint16(n[12:14], uint16(end-24-len(keys)*layout.size))
+	return n
+}
+
+// linkSiblings enlaza los nodos de un mismo nivel de izquierda a derecha
+func linkSiblings(nodes [][]byte, level []int, base int64) {
+	for i, idx := range level {
+		left, right := uint32(cdxNoNode), uint32(cdxNoNode)
+		if i > 0 {
+			left = uint32(base + int64(level[i-1])*cdxNodeSize)
+		}
+		if i < len(level)-1 {
+			right = uint32(base + int64(level[i+1])*cdxNodeSize)
+		}
+		binary.LittleEndian.PutUint32(nodes[idx][4:8], left)
+		binary.LittleEndian.PutUint32(nodes[idx][8:12], right)
+	}
+}
+
+// encodeCDXHeader arma el encabezado de 1024 bytes de un índice. Los bytes
+// que no se interpretan se conservan del encabezado leído.
+func encodeCDXHeader(tag CDXTag, root int64) []byte {
+	h := make([]byte, cdxHeaderSize)
+	binary.LittleEndian.PutUint32(h[0:4], uint32(root))
+	binary.LittleEndian.PutUint16(h[12:14], uint16(tag.KeyLen))
+	h[14] = tag.options
+	h[15] = 1
+	copy(h[16:502], tag.reserved)
+	if tag.Descending {
+		binary.LittleEndian.PutUint16(h[502:504], 1)
+	}
+	keyPool := len(tag.Expr) + 1
+	forPool := len(tag.For) + 1
+	binary.LittleEndian.PutUint16(h[504:506], uint16(keyPool))
+	binary.LittleEndian.PutUint16(h[506:508], uint16(forPool))
+	binary.LittleEndian.PutUint16(h[510:512], uint16(keyPool))
+	copy(h[512:], tag.Expr)
+	copy(h[512+keyPool:], tag.For)
+	return h
+}
+
+// buildCDX arma el archivo completo: el directorio de tags y, a continuación,
+// el encabezado y los nodos de cada tag. keys[i] son las entradas ya
+// ordenadas del tag tags[i] y pads[i] su byte de relleno.
+func buildCDX(tags []CDXTag, keys [][]CDXKey, pads []byte) []byte {
+	dirTag := CDXTag{KeyLen: 10, options: cdxOptCompact | cdxOptCompound | cdxOptStruct}
+
+	// El directorio apunta a los encabezados de los tags, que van después de
+	// él: se repite hasta que su tamaño no cambie
+	dirNodes := 1
+	var dir []byte
+	var dirRoot int64
+	var offsets []int64
+	for {
+		offsets = offsets[:0]
+		pos := int64(cdxHeaderSize + dirNodes*cdxNodeSize)
+		for i := range tags {
+			offsets = append(offsets, pos)
+			pos += cdxHeaderSize + int64(treeNodes(keys[i], tags[i].KeyLen, pads[i]))*cdxNodeSize
+		}
+		entries := make([]CDXKey, len(tags))
+		for i, t := range tags {
+			name := make([]byte, dirTag.KeyLen)
+			copy(name, bytes.ToUpper([]byte(t.Name)))
+			for j := len(t.Name); j < len(name); j++ {
+				name[j] = ' '
+			}
+			entries[i] = CDXKey{Key: name, Recno: int(offsets[i])}
+		}
+		entries = sortKeys(entries, false)
+		dir, dirRoot = buildTree(entries, dirTag.KeyLen, ' ', cdxHeaderSize)
+		if len(dir)/cdxNodeSize == dirNodes {
+			break
+		}
+		dirNodes = len(dir) / cdxNodeSize
+	}
+
+	var out bytes.Buffer
+	out.Write(encodeCDXHeader(dirTag, dirRoot))
+	out.Write(dir)
+	for i, t := range tags {
+		nodes, root := buildTree(keys[i], t.KeyLen, pads[i], offsets[i]+cdxHeaderSize)
+		out.Write(encodeCDXHeader(t, root))
+		out.Write(nodes)
+	}
+	return out.Bytes()
+}
+
+// treeNodes es la cantidad de nodos que ocupará el árbol de keys
+func treeNodes(keys []CDXKey, keyLen int, pad byte) int {
+	nodes, _ := buildTree(keys, keyLen, pad, 0)
+	return len(nodes) / cdxNodeSize
+}
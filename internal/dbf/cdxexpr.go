@@ -0,0 +1,333 @@
+// internal/dbf/cdxexpr.go
+package dbf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Evaluación de las expresiones de clave de los tags. Se cubre lo que suelen
+// usar los índices de FoxPro: campos, concatenación con "+", UPPER, STR, DTOS,
+// LEFT y SUBSTR. Los valores de caracteres se trabajan como bytes crudos del
+// DBF, igual que el índice con intercalación MACHINE.
+
+type valueKind int
+
+const (
+	kindChar valueKind = iota
+	kindNumeric
+	kindDate
+)
+
+type exprValue struct {
+	kind valueKind
+	s    []byte  // kindChar; kindDate como AAAAMMDD
+	n    float64 // kindNumeric
+}
+
+type exprNode struct {
+	kind   valueKind
+	width  int // largo del resultado para kindChar
+	fields []string
+	eval   func(rec []byte) exprValue
+}
+
+// keyExpr es una expresión de clave compilada contra la estructura del DBF
+type keyExpr struct {
+	root *exprNode
+}
+
+// Fields son los campos del DBF que usa la expresión
+func (e *keyExpr) Fields() []string { return e.root.fields }
+
+// pad es el byte de relleno de las claves de este tipo en el CDX
+func (e *keyExpr) pad() byte {
+	if e.root.kind == kindChar {
+		return ' '
+	}
+	return 0
+}
+
+// key arma la clave de rec tal como la guarda el índice
+func (e *keyExpr) key(rec []byte, keyLen int) []byte {
+	v := e.root.eval(rec)
+	switch v.kind {
+	case kindNumeric:
+		return numericKey(v.n)
+	case kindDate:
+		return numericKey(julianDay(v.s))
+	}
+	key := make([]byte, keyLen)
+	n := copy(key, v.s)
+	for i := n; i < keyLen; i++ {
+		key[i] = ' '
+	}
+	return key
+}
+
+// numericKey codifica un número como lo ordena FoxPro: el double en big endian
+// con el bit de signo invertido (positivos) o todos los bits invertidos
+// (negativos), así el orden de bytes coincide con el orden numérico.
+func numericKey(f float64) []byte {
+	bits := math.Float64bits(f)
+	if bits>>63 == 0 {
+		bits |= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, bits)
+	return key
+}
+
+// julianDay convierte una fecha AAAAMMDD al número de día juliano que FoxPro
+// usa como clave; una fecha vacía vale 0.
+func julianDay(s []byte) float64 {
+	t, err := time.Parse("20060102", strings.TrimSpace(string(s)))
+	if err != nil {
+		return 0
+	}
+	return float64(t.Unix()/86400 + 2440588)
+}
+
+// compileKeyExpr interpreta expr con los campos de h
+func compileKeyExpr(expr string, h *dbfHeader) (*keyExpr, error) {
+	p := &exprParser{src: expr, h: h}
+	p.next()
+	node, err := p.parseConcat()
+	if err != nil {
+		return nil, fmt.Errorf("expresión %q: %v", expr, err)
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("expresión %q: sobra %q", expr, p.tok)
+	}
+	return &keyExpr{root: node}, nil
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok string
+	h   *dbfHeader
+}
+
+// next avanza al siguiente token: identificador, número o símbolo
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	c := rune(p.src[p.pos])
+	switch {
+	case c == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '>':
+		p.pos += 2
+	case unicode.IsLetter(c) || c == '_' || unicode.IsDigit(c):
+		for p.pos < len(p.src) {
+			r := rune(p.src[p.pos])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				break
+			}
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func (p *exprParser) expect(tok string) error {
+	if p.tok != tok {
+		return fmt.Errorf("se esperaba %q y llegó %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) parseConcat() (*exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind != kindChar || right.kind != kindChar {
+			return nil, fmt.Errorf("solo se admite concatenar caracteres con +")
+		}
+		l, r := left, right
+		left = &exprNode{
+			kind:   kindChar,
+			width:  l.width + r.width,
+			fields: append(append([]string(nil), l.fields...), r.fields...),
+			eval: func(rec []byte) exprValue {
+				a, b := l.eval(rec), r.eval(rec)
+				return exprValue{kind: kindChar, s: append(append([]byte(nil), a.s...), b.s...)}
+			},
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm() (*exprNode, error) {
+	if p.tok == "(" {
+		p.next()
+		n, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	}
+	name := strings.ToUpper(p.tok)
+	if name == "" {
+		return nil, fmt.Errorf("expresión incompleta")
+	}
+	p.next()
+
+	// Alias: FAC_PF_M.NOMBRE o FAC_PF_M->NOMBRE
+	if p.tok == "." || p.tok == "->" {
+		p.next()
+		name = strings.ToUpper(p.tok)
+		p.next()
+	}
+	if p.tok != "(" {
+		return p.field(name)
+	}
+	p.next()
+	var args []*exprNode
+	var nums []int
+	for p.tok != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			n, err := strconv.Atoi(p.tok)
+			if err != nil {
+				return nil, fmt.Errorf("argumento numérico inválido %q en %s", p.tok, name)
+			}
+			nums = append(nums, n)
+			p.next()
+			continue
+		}
+		arg, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s sin argumento", name)
+	}
+	return function(name, args[0], nums)
+}
+
+// field compila una referencia a un campo del DBF
+func (p *exprParser) field(name string) (*exprNode, error) {
+	f, ok := p.h.field(name)
+	if !ok {
+		return nil, fmt.Errorf("el campo %s no existe en el DBF", name)
+	}
+	raw := func(rec []byte) []byte { return rec[f.Offset : f.Offset+f.Length] }
+	switch f.Type {
+	case 'C':
+		return &exprNode{kind: kindChar, width: f.Length, fields: []string{name}, eval: func(rec []byte) exprValue {
+			return exprValue{kind: kindChar, s: raw(rec)}
+		}}, nil
+	case 'N', 'F':
+		return &exprNode{kind: kindNumeric, fields: []string{name}, eval: func(rec []byte) exprValue {
+			n, _ := strconv.ParseFloat(strings.TrimSpace(string(raw(rec))), 64)
+			return exprValue{kind: kindNumeric, n: n}
+		}}, nil
+	case 'D':
+		return &exprNode{kind: kindDate, width: 8, fields: []string{name}, eval: func(rec []byte) exprValue {
+			return exprValue{kind: kindDate, s: raw(rec)}
+		}}, nil
+	}
+	return nil, fmt.Errorf("campo %s de tipo %c no soportado en índices", name, f.Type)
+}
+
+func function(name string, arg *exprNode, nums []int) (*exprNode, error) {
+	fields := arg.fields
+	switch name {
+	case "UPPER":
+		if arg.kind != kindChar {
+			return nil, fmt.Errorf("UPPER espera caracteres")
+		}
+		return &exprNode{kind: kindChar, width: arg.width, fields: fields, eval: func(rec []byte) exprValue {
+			s := append([]byte(nil), arg.eval(rec).s...)
+			for i, c := range s {
+				if c >= 'a' && c <= 'z' {
+					s[i] = c - 'a' + 'A'
+				}
+			}
+			return exprValue{kind: kindChar, s: s}
+		}}, nil
+	case "STR":
+		if arg.kind != kindNumeric || len(nums) > 2 {
+			return nil, fmt.Errorf("STR espera un número, largo y decimales")
+		}
+		width, dec := 10, 0
+		if len(nums) > 0 {
+			width = nums[0]
+		}
+		if len(nums) > 1 {
+			dec = nums[1]
+		}
+		return &exprNode{kind: kindChar, width: width, fields: fields, eval: func(rec []byte) exprValue {
+			s := strconv.FormatFloat(arg.eval(rec).n, 'f', dec, 64)
+			if len(s) > width {
+				s = strings.Repeat("*", width)
+			}
+			return exprValue{kind: kindChar, s: []byte(strings.Repeat(" ", width-len(s)) + s)}
+		}}, nil
+	case "DTOS":
+		if arg.kind != kindDate {
+			return nil, fmt.Errorf("DTOS espera una fecha")
+		}
+		return &exprNode{kind: kindChar, width: 8, fields: fields, eval: func(rec []byte) exprValue {
+			return exprValue{kind: kindChar, s: arg.eval(rec).s}
+		}}, nil
+	case "LEFT", "SUBSTR":
+		if arg.kind != kindChar {
+			return nil, fmt.Errorf("%s espera caracteres", name)
+		}
+		start, length := 1, arg.width
+		if name == "LEFT" {
+			if len(nums) != 1 {
+				return nil, fmt.Errorf("LEFT espera un largo")
+			}
+			length = nums[0]
+		} else {
+			if len(nums) < 1 || len(nums) > 2 {
+				return nil, fmt.Errorf("SUBSTR espera inicio y largo")
+			}
+			start = nums[0]
+			length = arg.width - start + 1
+			if len(nums) == 2 {
+				length = nums[1]
+			}
+		}
+		if start < 1 || length < 0 {
+			return nil, fmt.Errorf("%s con argumentos inválidos", name)
+		}
+		return &exprNode{kind: kindChar, width: length, fields: fields, eval: func(rec []byte) exprValue {
+			s := arg.eval(rec).s
+			from := min(start-1, len(s))
+			to := min(from+length, len(s))
+			return exprValue{kind: kindChar, s: s[from:to]}
+		}}, nil
+	}
+	return nil, fmt.Errorf("función %s no soportada", name)
+}
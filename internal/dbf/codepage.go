@@ -0,0 +1,142 @@
+// internal/dbf/codepage.go
+package dbf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axgle/mahonia"
+)
+
+// defaultEncoding es la que se usaba siempre antes de leer el byte de idioma
+// del encabezado; se conserva para los DBF que no lo declaran.
+const defaultEncoding = "latin1"
+
+// languageDrivers traduce el byte de idioma del encabezado (posición 29) a la
+// página de códigos. Son los valores que escriben FoxPro y dBase; los que no
+// están aquí se leen con defaultEncoding.
+var languageDrivers = map[byte]string{
+	0x01: "cp437",        // DOS USA
+	0x02: "cp850",        // DOS Multilingüe
+	0x03: "windows-1252", // Windows ANSI
+	0x04: "macintosh",    // Macintosh estándar
+	0x08: "cp865",        // Danés OEM
+	0x09: "cp437",        // Holandés OEM
+	0x0A: "cp850",        // Holandés OEM*
+	0x0B: "cp437",        // Finlandés OEM
+	0x0D: "cp437",        // Francés OEM
+	0x0E: "cp850",        // Francés OEM*
+	0x0F: "cp437",        // Alemán OEM
+	0x10: "cp850",        // Alemán OEM*
+	0x11: "cp437",        // Italiano OEM
+	0x12: "cp850",        // Italiano OEM*
+	0x14: "cp850",        // Español OEM*
+	0x15: "cp437",        // Sueco OEM
+	0x16: "cp850",        // Sueco OEM*
+	0x17: "cp865",        // Noruego OEM
+	0x18: "cp437",        // Español OEM
+	0x19: "cp437",        // Inglés OEM (Gran Bretaña)
+	0x1A: "cp850",        // Inglés OEM (Gran Bretaña)*
+	0x1B: "cp437",        // Inglés OEM (EE.UU.)
+	0x1D: "cp850",        // Portugués OEM*
+	0x24: "cp860",        // Portugués OEM
+	0x25: "cp850",        // Inglés OEM (EE.UU.)*
+	0x37: "cp850",        // Inglés OEM (EE.UU.)*
+	0x57: "windows-1252", // ANSI
+	0x58: "windows-1252", // Europa occidental ANSI
+	0x59: "windows-1252", // Español ANSI
+	0x64: "cp852",        // Europa del este MS-DOS
+	0x65: "cp865",        // Nórdico MS-DOS
+	0x66: "cp866",        // Ruso MS-DOS
+	0x67: "cp861",        // Islandés MS-DOS
+	0x6A: "cp737",        // Griego MS-DOS
+	0x6B: "cp857",        // Turco MS-DOS
+	0xC8: "windows-1250", // Europa del este Windows
+	0xC9: "windows-1251", // Ruso Windows
+	0xCA: "windows-1254", // Turco Windows
+	0xCB: "windows-1253", // Griego Windows
+	0xCC: "windows-1257", // Báltico Windows
+}
+
+// headerEncoding devuelve la página de códigos que declara el DBF. ok es
+// false si el byte de idioma está en cero o no se conoce.
+func headerEncoding(h *dbfHeader) (name string, ok bool) {
+	name, ok = languageDrivers[h.LangDriver]
+	if !ok {
+		return defaultEncoding, false
+	}
+	return name, true
+}
+
+// WithEncoding fuerza la página de códigos del DBF (p.ej. "cp850" o
+// "windows-1252") en lugar de la que declara su encabezado. Sirve para los
+// archivos que el ERP dejó con el byte de idioma en cero o mal puesto.
+func WithEncoding(name string) Option {
+	return func(m *Manager) error {
+		name = strings.TrimSpace(name)
+		if err := CheckEncoding(name); err != nil {
+			return err
+		}
+		m.encoding = name
+		return nil
+	}
+}
+
+// CheckEncoding falla si name no es una página de códigos conocida
+func CheckEncoding(name string) error {
+	if mahonia.GetCharset(strings.TrimSpace(name)) == nil {
+		return fmt.Errorf("página de códigos desconocida: %q", name)
+	}
+	return nil
+}
+
+// Encoding devuelve la página de códigos con que se leen y escriben los
+// campos de caracteres del DBF.
+func (m *Manager) Encoding() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tableEncoding(m.header)
+}
+
+// tableEncoding es la página de códigos configurada o, si no hay, la del
+// encabezado h
+func (m *Manager) tableEncoding(h *dbfHeader) string {
+	if m.encoding != "" {
+		return m.encoding
+	}
+	name, _ := headerEncoding(h)
+	return name
+}
+
+// logEncoding deja constancia de la página de códigos elegida cuando no sale
+// directamente del encabezado
+func (m *Manager) logEncoding(h *dbfHeader) {
+	declared, ok := headerEncoding(h)
+	switch {
+	case m.encoding != "" && ok && !strings.EqualFold(m.encoding, declared):
+		m.Log(fmt.Sprintf("El DBF declara la página de códigos %s (idioma 0x%02X) y se usará %s por configuración",
+			declared, h.LangDriver, m.encoding))
+	case m.encoding == "" && !ok:
+		m.Log(fmt.Sprintf("ADVERTENCIA: el DBF no declara una página de códigos conocida (idioma 0x%02X); se usará %s",
+			h.LangDriver, defaultEncoding))
+	}
+}
+
+// encodeText convierte value a los bytes de la página de códigos name. Falla
+// si algún carácter no existe en ella, para no dejar un '?' en el DBF.
+func encodeText(name, value string) ([]byte, error) {
+	enc := mahonia.NewEncoder(name)
+	if enc == nil {
+		return nil, fmt.Errorf("página de códigos desconocida: %q", name)
+	}
+	out := make([]byte, 0, len(value))
+	buf := make([]byte, 8)
+	for _, r := range value {
+		n, status := enc(buf, r)
+		if status != mahonia.SUCCESS {
+			return nil, fmt.Errorf("el carácter %q no existe en la página de códigos %s", r, name)
+		}
+		out = append(out, buf[:n]...)
+	}
+	return out, nil
+}
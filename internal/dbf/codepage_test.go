@@ -0,0 +1,102 @@
+package dbf_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// withCodePage deja el DBF de prueba con el byte de idioma lang y el nombre
+// "CRÉDITO FISCAL" escrito con la É en el byte e de esa página de códigos.
+func withCodePage(t *testing.T, lang, e byte) string {
+	t.Helper()
+	path := copyFixture(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[29] = lang
+	data = bytes.Replace(data, []byte("CREDITO FISCAL"), append([]byte("CR"), append([]byte{e}, "DITO FISCAL"...)...), 1)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func nombre(t *testing.T, mgr *dbf.Manager, tipo string) string {
+	t.Helper()
+	tipos, err := mgr.GetRecordTypes()
+	if err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	for _, ct := range tipos {
+		if ct.NCFTipo == tipo {
+			return ct.Nombre
+		}
+	}
+	t.Fatalf("no se encontró %s", tipo)
+	return ""
+}
+
+func TestManager_EncodingFromHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang, e  byte
+		encoding string
+	}{
+		{"DOS multilingüe", 0x02, 0x90, "cp850"},
+		{"Windows ANSI", 0x03, 0xC9, "windows-1252"},
+		{"sin declarar", 0x00, 0xC9, "latin1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := mustManager(t, withCodePage(t, tt.lang, tt.e))
+			defer mgr.Close()
+			if got := mgr.Encoding(); got != tt.encoding {
+				t.Errorf("Encoding() = %q, se esperaba %q", got, tt.encoding)
+			}
+			if got := nombre(t, mgr, "E31"); got != "CRÉDITO FISCAL" {
+				t.Errorf("NOMBRE = %q", got)
+			}
+		})
+	}
+}
+
+func TestManager_EncodingOverride(t *testing.T) {
+	// El ERP dejó el byte de idioma en Windows ANSI pero escribió en CP850
+	path := withCodePage(t, 0x03, 0x90)
+	mgr := mustManager(t, path, dbf.WithEncoding("cp850"))
+	defer mgr.Close()
+	if got := nombre(t, mgr, "E31"); got != "CRÉDITO FISCAL" {
+		t.Errorf("NOMBRE = %q", got)
+	}
+
+	if _, err := dbf.NewManager(path, dbf.WithEncoding("ebcdic-marciano")); err == nil {
+		t.Error("NewManager() aceptó una página de códigos desconocida")
+	}
+}
+
+func TestManager_WritePreservesCodePage(t *testing.T) {
+	path := withCodePage(t, 0x02, 0x90)
+	mgr := mustManager(t, path)
+	defer mgr.Close()
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[29] != 0x02 {
+		t.Errorf("byte de idioma = %#x después de escribir", data[29])
+	}
+	if !bytes.Contains(data, []byte("CR\x90DITO FISCAL")) {
+		t.Error("el nombre dejó de estar en CP850 después de escribir")
+	}
+	if got := nombre(t, mgr, "E31"); got != "CRÉDITO FISCAL" {
+		t.Errorf("NOMBRE = %q después de escribir", got)
+	}
+}
@@ -0,0 +1,49 @@
+// internal/dbf/errors.go
+package dbf
+
+import "errors"
+
+// Errores tipados que devuelve el Manager al asignar secuencias. Se envuelven
+// con fmt.Errorf("%w: ...") para agregar contexto, así que los llamadores deben
+// compararlos con errors.Is.
+var (
+	// ErrTypeNotFound indica que el tipo de comprobante no existe en el DBF.
+	ErrTypeNotFound = errors.New("tipo de comprobante no encontrado")
+
+	// ErrInvalidCTA indica que la cuenta solicitada no es A ni B.
+	ErrInvalidCTA = errors.New("CTA no válido")
+
+	// ErrRangeExhausted indica que el siguiente número quedaría fuera del
+	// rango autorizado por la DGII (CANTSECUEN).
+	ErrRangeExhausted = errors.New("rango de secuencias autorizado agotado")
+
+	// ErrAuthorizationExpired indica que la fecha de vencimiento (FEC_DOC)
+	// de la autorización ya pasó.
+	ErrAuthorizationExpired = errors.New("autorización de secuencias vencida")
+
+	// ErrCTANotPartitioned indica que la cuenta no tiene un sub-rango propio
+	// configurado, por lo que emitir con ella duplicaría números de la otra.
+	ErrCTANotPartitioned = errors.New("CTA sin partición configurada")
+
+	// ErrFieldOverflow indica que el número a guardar no cabe en el ancho
+	// declarado del campo del contador (p.ej. NUMERO_1 N(8) con 9 dígitos).
+	ErrFieldOverflow = errors.New("el contador no cabe en el campo del DBF")
+
+	// ErrLockTimeout indica que otro proceso (normalmente el ERP) mantuvo
+	// bloqueado el registro o el encabezado más allá del tiempo configurado.
+	ErrLockTimeout = errors.New("tiempo de espera agotado bloqueando el DBF")
+
+	// ErrCounterRollback indica que el contador del DBF es menor que el último
+	// número ya emitido, normalmente porque se restauró una copia vieja.
+	ErrCounterRollback = errors.New("el contador del DBF retrocedió")
+
+	// ErrPartitionOverlap indica que dos particiones del mismo tipo se solapan.
+	ErrPartitionOverlap = errors.New("particiones de CTA solapadas")
+
+	// ErrSnapshotNotFound indica que no hay un respaldo con el nombre pedido.
+	ErrSnapshotNotFound = errors.New("respaldo no encontrado")
+
+	// ErrSuspended indica que el Manager está en pausa (ver Suspend) y no
+	// modifica el DBF hasta que se reanude.
+	ErrSuspended = errors.New("asignaciones en pausa")
+)
@@ -0,0 +1,171 @@
+// internal/dbf/export.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	godbf "github.com/LindsayBradford/go-dbf/godbf"
+)
+
+// ReadRecordTypes lee los tipos de comprobante de un DBF sin crear un
+// Manager: no toma el journal ni deja archivos junto a la tabla. encoding
+// vacío usa la página de códigos del encabezado.
+func ReadRecordTypes(path string, encoding string) ([]ComprobanteTipo, error) {
+	h, err := readHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == "" {
+		encoding, _ = headerEncoding(h)
+	}
+	table, err := godbf.NewFromFile(path, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DBF: %v", err)
+	}
+	var tipos []ComprobanteTipo
+	for i := 0; i < table.NumberOfRecords(); i++ {
+		if !table.RowIsDeleted(i) {
+			tipos = append(tipos, rowType(table, i))
+		}
+	}
+	return tipos, nil
+}
+
+// Fields lista los campos del tipo como pares (columna del DBF, valor) en el
+// formato en que se escriben
+func (t ComprobanteTipo) Fields() [][2]string {
+	return [][2]string{
+		{"COD_PF_F", strconv.Itoa(t.CodPFF)},
+		{"NOMBRE", t.Nombre},
+		{"RESUMEN", t.Resumen},
+		{"NUMERO", t.Numero},
+		{"NUMERO_1", strconv.FormatInt(t.Numero1, 10)},
+		{"NUMERO_2", strconv.FormatInt(t.Numero2, 10)},
+		{"FEC_DOC", t.FechaDoc},
+		{"MINIMO", strconv.FormatInt(t.Minimo, 10)},
+		{"CANTSECUEN", strconv.FormatInt(t.CantSecuen, 10)},
+	}
+}
+
+// ExportTable escribe en path una tabla con el esquema de original (los bytes
+// del DBF tal como estaba antes de migrar) y los valores de tipos. Los
+// registros se conservan en su orden, con sus marcas de borrado y los campos
+// que no son parte de ComprobanteTipo; de cada tipo solo se reescriben los
+// campos que cambiaron, así que un registro sin cambios queda idéntico. Los
+// tipos que no estaban en original se agregan al final. Si hay originalCDX se
+// deja junto a la tabla y se reconstruye a partir de ella.
+//
+// El archivo se arma en un temporal y reemplaza a path al final; path no debe
+// estar en uso.
+func ExportTable(path string, original, originalCDX []byte, tipos []ComprobanteTipo, encoding string) error {
+	h, err := parseHeader(original)
+	if err != nil {
+		return err
+	}
+	end := h.HeaderLen + h.NumRecords*h.RecordLen
+	if len(original) < end {
+		return fmt.Errorf("el DBF original está truncado: %d registros declarados y %d bytes", h.NumRecords, len(original))
+	}
+	if encoding == "" {
+		encoding, _ = headerEncoding(h)
+	}
+
+	// Registros en blanco al final para los tipos que el DBF no tenía
+	present := make(map[string]bool)
+	table, err := godbf.NewFromByteArray(original, encoding)
+	if err != nil {
+		return fmt.Errorf("error leyendo DBF original: %v", err)
+	}
+	for i := 0; i < table.NumberOfRecords(); i++ {
+		if !table.RowIsDeleted(i) {
+			present[rowType(table, i).NCFTipo] = true
+		}
+	}
+	var added []ComprobanteTipo
+	for _, t := range tipos {
+		if !present[t.NCFTipo] {
+			added = append(added, t)
+		}
+	}
+	data := append([]byte(nil), original[:end]...)
+	data = append(data, bytes.Repeat([]byte{' '}, len(added)*h.RecordLen)...)
+	data = append(data, 0x1A)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(h.NumRecords+len(added)))
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creando archivo temporal: %v", err)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fillTypes(tmpPath, encoding, tipos, h.NumRecords)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error reemplazando %s: %v", path, err)
+	}
+
+	if originalCDX == nil {
+		return nil
+	}
+	cdxPath := cdxPathFor(path)
+	if err := os.WriteFile(cdxPath, originalCDX, 0644); err != nil {
+		return fmt.Errorf("error escribiendo CDX: %v", err)
+	}
+	return rebuildCDX(path, cdxPath)
+}
+
+// fillTypes escribe en la tabla path los campos de cada tipo que difieren de
+// lo que ya tiene. Los registros desde first en adelante están en blanco y se
+// asignan, en orden, a los tipos que no aparecen antes.
+func fillTypes(path, encoding string, tipos []ComprobanteTipo, first int) error {
+	h, err := readHeader(path)
+	if err != nil {
+		return err
+	}
+	table, err := godbf.NewFromFile(path, encoding)
+	if err != nil {
+		return fmt.Errorf("error abriendo DBF exportado: %v", err)
+	}
+
+	rows := make(map[string][]int)
+	for i := 0; i < first; i++ {
+		if !table.RowIsDeleted(i) {
+			tipo := rowType(table, i).NCFTipo
+			rows[tipo] = append(rows[tipo], i)
+		}
+	}
+	next := first
+	for _, t := range tipos {
+		targets, ok := rows[t.NCFTipo]
+		if !ok {
+			targets = []int{next}
+			next++
+		}
+		for _, row := range targets {
+			current := rowType(table, row).Fields()
+			for i, field := range t.Fields() {
+				if _, exists := h.field(field[0]); !exists || current[i][1] == field[1] {
+					continue
+				}
+				if err := writeField(path, h, encoding, row, field[0], field[1]); err != nil {
+					return fmt.Errorf("%s, registro %d: %w", t.NCFTipo, row+1, err)
+				}
+			}
+		}
+	}
+	return nil
+}
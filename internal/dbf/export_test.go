@@ -0,0 +1,93 @@
+package dbf_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestExportTable_Unchanged(t *testing.T) {
+	original, err := os.ReadFile("FAC_PF_M.DBF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipos, err := dbf.ReadRecordTypes("FAC_PF_M.DBF", "")
+	if err != nil {
+		t.Fatalf("ReadRecordTypes() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "FAC_PF_M.DBF")
+	if err := dbf.ExportTable(path, original, nil, tipos, ""); err != nil {
+		t.Fatalf("ExportTable() error = %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, original) {
+		t.Error("sin cambios, la tabla exportada no quedó idéntica a la original")
+	}
+}
+
+func TestExportTable_Changes(t *testing.T) {
+	original, err := os.ReadFile("FAC_PF_M.DBF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdx, err := os.ReadFile("FAC_PF_M.CDX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipos, err := dbf.ReadRecordTypes("FAC_PF_M.DBF", "")
+	if err != nil {
+		t.Fatalf("ReadRecordTypes() error = %v", err)
+	}
+	for i := range tipos {
+		if tipos[i].NCFTipo == "E34" {
+			tipos[i].Numero1 = 42
+		}
+	}
+	tipos = append(tipos, dbf.ComprobanteTipo{
+		NCFTipo: "E41", CodPFF: 10, Nombre: "COMPRAS", Numero: "E41", Numero1: 7,
+		FechaDoc: "20271231", CantSecuen: 500,
+	})
+
+	path := filepath.Join(t.TempDir(), "FAC_PF_M.DBF")
+	if err := dbf.ExportTable(path, original, cdx, tipos, ""); err != nil {
+		t.Fatalf("ExportTable() error = %v", err)
+	}
+
+	got, err := dbf.ReadRecordTypes(path, "")
+	if err != nil {
+		t.Fatalf("ReadRecordTypes() error = %v", err)
+	}
+	if len(got) != len(tipos) {
+		t.Fatalf("la tabla exportada tiene %d tipos, se esperaban %d", len(got), len(tipos))
+	}
+	for i := range tipos {
+		if got[i] != tipos[i] {
+			t.Errorf("registro %d = %+v, se esperaba %+v", i+1, got[i], tipos[i])
+		}
+	}
+
+	// El primer registro no cambió: sus bytes (NCF_TIP incluido) son los mismos
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const headerLen, recordLen = 353, 116
+	if !bytes.Equal(data[headerLen:headerLen+recordLen], original[headerLen:headerLen+recordLen]) {
+		t.Error("el registro de E32 cambió sin tener cambios")
+	}
+
+	report, err := dbf.VerifyIndex(path)
+	if err != nil {
+		t.Fatalf("VerifyIndex() error = %v", err)
+	}
+	if len(report.Problemas) != 0 {
+		t.Errorf("el CDX exportado no coincide con la tabla: %+v", report.Problemas)
+	}
+}
@@ -0,0 +1,248 @@
+// internal/dbf/highwater.go
+package dbf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LindsayBradford/go-dbf/godbf"
+)
+
+// HighWater es el mayor número que se llegó a entregar de un tipo por una CTA.
+// Se guarda fuera del DBF para detectar cuando alguien restaura una copia
+// vieja del archivo y los contadores retroceden.
+type HighWater struct {
+	Tipo   string `json:"tipo"`
+	CTA    string `json:"cta"`
+	Numero int64  `json:"numero"`
+}
+
+// Rollback es un contador del DBF que quedó por debajo de lo ya emitido
+type Rollback struct {
+	Tipo     string `json:"tipo"`
+	CTA      string `json:"cta"`
+	Contador int64  `json:"contador"` // valor actual en el DBF
+	Emitido  int64  `json:"emitido"`  // mayor número ya entregado
+}
+
+// WithHighWaterFile cambia la ubicación del archivo de marcas (por defecto
+// FAC_PF_M.HWM junto al DBF).
+func WithHighWaterFile(path string) Option {
+	return func(m *Manager) error {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("ruta de marcas vacía")
+		}
+		m.hwmPath = path
+		return nil
+	}
+}
+
+// WithHighWater agrega marcas tomadas de otra fuente, normalmente el ledger.
+// Se combinan con las del archivo quedándose con la mayor.
+func WithHighWater(marks []HighWater) Option {
+	return func(m *Manager) error {
+		for _, hw := range marks {
+			m.raiseMark(strings.ToUpper(hw.Tipo), strings.ToUpper(hw.CTA), hw.Numero)
+		}
+		return nil
+	}
+}
+
+// WithRollbackObserver registra una función que recibe cada contador que se
+// detecta por debajo de su marca. Se avisa una vez por contador hasta que se
+// corrige. Se invoca con el lock del Manager tomado, así que no debe bloquear.
+func WithRollbackObserver(fn func(Rollback)) Option {
+	return func(m *Manager) error {
+		m.rollbackObserver = fn
+		return nil
+	}
+}
+
+func defaultHighWaterPath(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, ".DBF") + ".HWM"
+}
+
+// counterField es el contador que lleva la CTA y counterCTA su inverso
+func counterField(cta string) string {
+	if cta == "B" {
+		return "NUMERO_2"
+	}
+	return "NUMERO_1"
+}
+
+func counterCTA(campo string) string {
+	if campo == "NUMERO_2" {
+		return "B"
+	}
+	return "A"
+}
+
+// raiseMark sube la marca de tipo/cta a n si es mayor que la actual
+func (m *Manager) raiseMark(tipo, cta string, n int64) {
+	key := tipo + "/" + cta
+	if n > m.marks[key] {
+		m.marks[key] = n
+	}
+}
+
+// loadHighWater combina las marcas del archivo con las que ya tiene el Manager
+func (m *Manager) loadHighWater() error {
+	data, err := os.ReadFile(m.hwmPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error leyendo marcas de emisión: %v", err)
+	}
+	var marks []HighWater
+	if err := json.Unmarshal(data, &marks); err != nil {
+		return fmt.Errorf("archivo de marcas %s dañado: %v", m.hwmPath, err)
+	}
+	for _, hw := range marks {
+		m.raiseMark(hw.Tipo, hw.CTA, hw.Numero)
+	}
+	return nil
+}
+
+// sortedMarks arma la lista de marcas ordenada por tipo y CTA
+func (m *Manager) sortedMarks() []HighWater {
+	marks := make([]HighWater, 0, len(m.marks))
+	for key, n := range m.marks {
+		tipo, cta, _ := strings.Cut(key, "/")
+		marks = append(marks, HighWater{Tipo: tipo, CTA: cta, Numero: n})
+	}
+	sort.Slice(marks, func(i, j int) bool {
+		if marks[i].Tipo != marks[j].Tipo {
+			return marks[i].Tipo < marks[j].Tipo
+		}
+		return marks[i].CTA < marks[j].CTA
+	})
+	return marks
+}
+
+// saveHighWater reemplaza el archivo de marcas de forma atómica. Antes toma
+// las del archivo, que pudo guardar otro proceso (p.ej. un Adjust desde una
+// herramienta de administración con el servicio corriendo), para no bajarlas.
+func (m *Manager) saveHighWater() error {
+	if err := m.loadHighWater(); err != nil {
+		m.Log(fmt.Sprintf("ADVERTENCIA: %v; se reemplaza con las marcas en memoria", err))
+	}
+	data, err := json.MarshalIndent(m.sortedMarks(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.hwmPath), filepath.Base(m.hwmPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error guardando marcas de emisión: %v", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), m.hwmPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error guardando marcas de emisión: %v", err)
+	}
+	return nil
+}
+
+// Marks devuelve las marcas de emisión actuales
+func (m *Manager) Marks() []HighWater {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sortedMarks()
+}
+
+// Rollbacks compara los contadores actuales del DBF con las marcas y devuelve
+// los que retrocedieron. Mientras un contador figure aquí no se asigna de él.
+func (m *Manager) Rollbacks() ([]Rollback, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.cachedTable()
+	if err != nil {
+		return nil, err
+	}
+	return m.checkRollbacks(table), nil
+}
+
+// checkRollbacks busca contadores por debajo de su marca en table y avisa al
+// observador de los nuevos. Se llama con m.mu tomado cada vez que se relee el
+// DBF.
+func (m *Manager) checkRollbacks(table *godbf.DbfTable) []Rollback {
+	rollbacks := m.findRollbacks(table)
+	current := make(map[string]bool)
+	for _, rb := range rollbacks {
+		key := rb.Tipo + "/" + rb.CTA
+		current[key] = true
+		if !m.rolledBack[key] {
+			m.Log(fmt.Sprintf("ALERTA: el contador de %s CTA %s en el DBF (%d) es menor que el último número emitido (%d); "+
+				"¿se restauró una copia vieja? No se asignará hasta corregirlo (ver el subcomando adelantar-contadores)",
+				rb.Tipo, rb.CTA, rb.Contador, rb.Emitido))
+			if m.rollbackObserver != nil {
+				m.rollbackObserver(rb)
+			}
+		}
+	}
+	m.rolledBack = current
+	return rollbacks
+}
+
+// findRollbacks devuelve, ordenados, los contadores de table que están por
+// debajo de su marca
+func (m *Manager) findRollbacks(table *godbf.DbfTable) []Rollback {
+	var rollbacks []Rollback
+	for key, emitido := range m.marks {
+		tipo, cta, _ := strings.Cut(key, "/")
+		row, ok := findRow(table, tipo)
+		if !ok {
+			continue
+		}
+		contador, _ := table.Int64FieldValueByName(row, counterField(cta))
+		if contador < emitido {
+			rollbacks = append(rollbacks, Rollback{Tipo: tipo, CTA: cta, Contador: contador, Emitido: emitido})
+		}
+	}
+	sort.Slice(rollbacks, func(i, j int) bool {
+		if rollbacks[i].Tipo != rollbacks[j].Tipo {
+			return rollbacks[i].Tipo < rollbacks[j].Tipo
+		}
+		return rollbacks[i].CTA < rollbacks[j].CTA
+	})
+	return rollbacks
+}
+
+// FastForward lleva cada contador que retrocedió hasta su marca, para que la
+// próxima asignación continúe después del último número emitido. Devuelve los
+// contadores que corrigió.
+func (m *Manager) FastForward() ([]Rollback, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.suspended {
+		return nil, ErrSuspended
+	}
+	table, err := m.cachedTable()
+	if err != nil {
+		return nil, err
+	}
+	rollbacks := m.checkRollbacks(table)
+	for _, rb := range rollbacks {
+		if err := m.fastForward(rb.Tipo, counterField(rb.CTA), rb.Emitido); err != nil {
+			return nil, fmt.Errorf("adelantando %s CTA %s: %w", rb.Tipo, rb.CTA, err)
+		}
+	}
+	if table, err = m.cachedTable(); err == nil {
+		m.checkRollbacks(table)
+	}
+	return rollbacks, nil
+}
@@ -0,0 +1,106 @@
+package dbf_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// restoreBackup reemplaza el DBF por el de prueba, como quien restaura la copia
+// de la semana pasada. Se corre la fecha de modificación para que el cambio se
+// note aunque caiga en el mismo instante.
+func restoreBackup(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile("FAC_PF_M.DBF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManager_RollbackAfterRestart(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path)
+	for i := 0; i < 2; i++ {
+		if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+			t.Fatalf("GetSequence() error = %v", err)
+		}
+	}
+	if err := mgr.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	restoreBackup(t, path)
+
+	var alerts []dbf.Rollback
+	mgr = mustManager(t, path, dbf.WithRollbackObserver(func(rb dbf.Rollback) {
+		alerts = append(alerts, rb)
+	}))
+	want := []dbf.Rollback{{Tipo: "E34", CTA: "A", Contador: 0, Emitido: 2}}
+	if !reflect.DeepEqual(alerts, want) {
+		t.Errorf("alertas = %+v, se esperaba %+v", alerts, want)
+	}
+	rollbacks, err := mgr.Rollbacks()
+	if err != nil || !reflect.DeepEqual(rollbacks, want) {
+		t.Errorf("Rollbacks() = %+v, %v", rollbacks, err)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("se avisó %d veces del mismo retroceso", len(alerts))
+	}
+
+	// E34 no se asigna, los demás sí
+	if _, _, err := mgr.GetSequence("E34", "A"); !errors.Is(err, dbf.ErrCounterRollback) {
+		t.Fatalf("GetSequence() error = %v, se esperaba ErrCounterRollback", err)
+	}
+	if _, _, err := mgr.GetSequence("E32", "A"); err != nil {
+		t.Errorf("GetSequence(E32) error = %v", err)
+	}
+
+	// Adelantar el contador deja todo en orden y sigue después del último emitido
+	fixed, err := mgr.FastForward()
+	if err != nil || !reflect.DeepEqual(fixed, want) {
+		t.Fatalf("FastForward() = %+v, %v", fixed, err)
+	}
+	if rollbacks, _ := mgr.Rollbacks(); len(rollbacks) != 0 {
+		t.Errorf("Rollbacks() después de adelantar = %+v", rollbacks)
+	}
+	seq, _, err := mgr.GetSequence("E34", "A")
+	if err != nil || seq != "E340000000003" {
+		t.Errorf("GetSequence() = %s, %v; se esperaba E340000000003", seq, err)
+	}
+}
+
+func TestManager_RollbackWhileRunning(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path)
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+
+	restoreBackup(t, path)
+	if _, _, err := mgr.GetSequence("E34", "A"); !errors.Is(err, dbf.ErrCounterRollback) {
+		t.Errorf("GetSequence() error = %v, se esperaba ErrCounterRollback", err)
+	}
+}
+
+func TestManager_HighWaterFromLedger(t *testing.T) {
+	// El archivo de marcas y el journal se perdieron con el DBF; el ledger
+	// todavía sabe que se emitió hasta E34 CTA A 40
+	mgr := mustManager(t, copyFixture(t), dbf.WithHighWater([]dbf.HighWater{
+		{Tipo: "e34", CTA: "a", Numero: 40},
+	}))
+	rollbacks, err := mgr.Rollbacks()
+	if err != nil || len(rollbacks) != 1 || rollbacks[0].Emitido != 40 {
+		t.Errorf("Rollbacks() = %+v, %v", rollbacks, err)
+	}
+}
@@ -0,0 +1,324 @@
+// internal/dbf/index.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexProblem es una diferencia entre un tag del CDX y la tabla
+type IndexProblem struct {
+	Tag     string `json:"tag"`
+	Recno   int    `json:"registro,omitempty"`
+	Detalle string `json:"detalle"`
+}
+
+// IndexReport es el resultado de VerifyIndex
+type IndexReport struct {
+	CDX       string            `json:"cdx"`
+	Tags      []CDXTag          `json:"tags"`
+	Omitidos  map[string]string `json:"omitidos,omitempty"` // tag -> por qué no se verificó
+	Problemas []IndexProblem    `json:"problemas"`
+}
+
+// cdxPathFor es el índice estructural del DBF: mismo nombre, extensión CDX
+func cdxPathFor(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, ".DBF") + ".CDX"
+}
+
+// readTable lee el DBF completo y devuelve su encabezado y los bytes
+func readTable(dbfPath string) (*dbfHeader, []byte, error) {
+	data, err := os.ReadFile(dbfPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error leyendo DBF: %v", err)
+	}
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < h.HeaderLen+h.NumRecords*h.RecordLen {
+		return nil, nil, fmt.Errorf("el DBF está truncado: %d registros declarados y %d bytes", h.NumRecords, len(data))
+	}
+	return h, data, nil
+}
+
+// tableKeys calcula las entradas que debería tener tag según la tabla. FoxPro
+// indexa también los registros marcados como borrados.
+func tableKeys(tag CDXTag, h *dbfHeader, data []byte) ([]CDXKey, byte, error) {
+	if tag.For != "" {
+		return nil, 0, fmt.Errorf("condición FOR no soportada: %s", tag.For)
+	}
+	expr, err := compileKeyExpr(tag.Expr, h)
+	if err != nil {
+		return nil, 0, err
+	}
+	width := expr.root.width
+	if expr.root.kind != kindChar {
+		width = 8
+	}
+	if width != tag.KeyLen {
+		return nil, 0, fmt.Errorf("la expresión da claves de %d bytes y el tag usa %d", width, tag.KeyLen)
+	}
+
+	keys := make([]CDXKey, h.NumRecords)
+	for r := 0; r < h.NumRecords; r++ {
+		rec := data[h.HeaderLen+r*h.RecordLen : h.HeaderLen+(r+1)*h.RecordLen]
+		keys[r] = CDXKey{Key: expr.key(rec, tag.KeyLen), Recno: r + 1}
+	}
+	return sortKeys(keys, tag.Unique), expr.pad(), nil
+}
+
+// VerifyIndex compara cada tag del CDX con la tabla: registros que faltan en
+// el índice, entradas que apuntan a registros inexistentes, claves distintas
+// y claves fuera de orden. También revisa que el DBF marque su CDX.
+func VerifyIndex(dbfPath string) (*IndexReport, error) {
+	h, data, err := readTable(dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	report := &IndexReport{CDX: cdxPathFor(dbfPath), Omitidos: make(map[string]string)}
+
+	_, statErr := os.Stat(report.CDX)
+	hasFlag := h.Flags&0x01 != 0
+	switch {
+	case os.IsNotExist(statErr) && hasFlag:
+		report.Problemas = append(report.Problemas, IndexProblem{Detalle: "el DBF declara un CDX estructural que no existe"})
+		return report, nil
+	case os.IsNotExist(statErr):
+		return report, nil
+	case !hasFlag:
+		report.Problemas = append(report.Problemas, IndexProblem{Detalle: "el DBF no tiene marcado su CDX estructural"})
+	}
+
+	cdx, err := ReadCDX(report.CDX)
+	if err != nil {
+		return nil, err
+	}
+	report.Tags = cdx.Tags
+	for _, tag := range cdx.Tags {
+		want, pad, err := tableKeys(tag, h, data)
+		if err != nil {
+			report.Omitidos[tag.Name] = err.Error()
+			continue
+		}
+		got, err := cdx.Keys(tag, pad)
+		if err != nil {
+			report.Problemas = append(report.Problemas, IndexProblem{Tag: tag.Name, Detalle: err.Error()})
+			continue
+		}
+		report.Problemas = append(report.Problemas, compareKeys(tag, pad, got, want, h.NumRecords)...)
+	}
+	return report, nil
+}
+
+func compareKeys(tag CDXTag, pad byte, got, want []CDXKey, numRecords int) []IndexProblem {
+	var problems []IndexProblem
+	add := func(recno int, format string, args ...interface{}) {
+		problems = append(problems, IndexProblem{Tag: tag.Name, Recno: recno, Detalle: fmt.Sprintf(format, args...)})
+	}
+
+	inIndex := make(map[int][]byte)
+	for i, k := range got {
+		if k.Recno < 1 || k.Recno > numRecords {
+			add(k.Recno, "el índice apunta a un registro inexistente")
+			continue
+		}
+		if _, dup := inIndex[k.Recno]; dup {
+			add(k.Recno, "el registro aparece más de una vez en el índice")
+		}
+		inIndex[k.Recno] = k.Key
+		if i > 0 {
+			prev := got[i-1]
+			if c := bytes.Compare(prev.Key, k.Key); c > 0 || (c == 0 && prev.Recno > k.Recno) {
+				add(k.Recno, "clave fuera de orden después del registro %d", prev.Recno)
+			}
+		}
+	}
+	expected := make(map[int][]byte)
+	for _, k := range want {
+		expected[k.Recno] = k.Key
+		key, ok := inIndex[k.Recno]
+		switch {
+		case !ok:
+			add(k.Recno, "falta en el índice (clave %s)", formatKey(k.Key, pad))
+		case !bytes.Equal(key, k.Key):
+			add(k.Recno, "el índice tiene %s y la tabla %s", formatKey(key, pad), formatKey(k.Key, pad))
+		}
+	}
+	for recno := range inIndex {
+		if _, ok := expected[recno]; !ok && tag.Unique {
+			add(recno, "clave repetida en un tag UNIQUE")
+		}
+	}
+	return problems
+}
+
+// formatKey muestra una clave para el reporte: texto o el número que codifica
+func formatKey(key []byte, pad byte) string {
+	if pad != 0 || len(key) != 8 {
+		return strconv.Quote(string(bytes.TrimRight(key, " ")))
+	}
+	bits := binary.BigEndian.Uint64(key)
+	if bits>>63 == 1 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return strconv.FormatFloat(math.Float64frombits(bits), 'f', -1, 64)
+}
+
+// rebuildCDX arma de nuevo todos los tags a partir de la tabla y escribe en el
+// CDX solo los nodos que cambiaron (ver writeChangedNodes). Se escribe sobre
+// el mismo archivo, no con un rename, porque en Windows no se puede reemplazar
+// un archivo que FoxPro tiene abierto. Hay que tener tomado el bloqueo del
+// encabezado del DBF.
+func rebuildCDX(dbfPath, cdxPath string) error {
+	cdx, err := ReadCDX(cdxPath)
+	if err != nil {
+		return err
+	}
+	h, data, err := readTable(dbfPath)
+	if err != nil {
+		return err
+	}
+	keys := make([][]CDXKey, len(cdx.Tags))
+	pads := make([]byte, len(cdx.Tags))
+	for i, tag := range cdx.Tags {
+		if keys[i], pads[i], err = tableKeys(tag, h, data); err != nil {
+			return fmt.Errorf("no se puede reconstruir el tag %s: %v", tag.Name, err)
+		}
+	}
+	return writeChangedNodes(cdxPath, buildCDX(cdx.Tags, keys, pads))
+}
+
+// writeChangedNodes deja en path el contenido out escribiendo solo los bloques
+// de cdxNodeSize que difieren de lo que hay en disco. Al mover un contador
+// indexado cambian una o dos hojas, así que se reescriben unos pocos bytes en
+// lugar de todo el índice.
+func writeChangedNodes(path string, out []byte) error {
+	cur, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error leyendo CDX: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("error abriendo CDX: %v", err)
+	}
+	defer f.Close()
+
+	changed := len(cur) != len(out)
+	for off := 0; off < len(out); off += cdxNodeSize {
+		end := min(off+cdxNodeSize, len(out))
+		if end <= len(cur) && bytes.Equal(cur[off:end], out[off:end]) {
+			continue
+		}
+		if _, err := f.WriteAt(out[off:end], int64(off)); err != nil {
+			return fmt.Errorf("error escribiendo CDX: %v", err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if len(cur) > len(out) {
+		if err := f.Truncate(int64(len(out))); err != nil {
+			return fmt.Errorf("error escribiendo CDX: %v", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("error sincronizando CDX: %v", err)
+	}
+	return nil
+}
+
+// lockHeader bloquea el encabezado del DBF, como hace FoxPro al reindexar
+func lockHeader(dbfPath string, timeout, retry time.Duration) (*dbfLock, error) {
+	f, err := os.OpenFile(dbfPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DBF para bloquear: %v", err)
+	}
+	l := &dbfLock{file: f}
+	if err := l.acquire(headerLockOffset, timeout, retry); err != nil {
+		l.release()
+		return nil, fmt.Errorf("%w: encabezado de %s", err, dbfPath)
+	}
+	return l, nil
+}
+
+// RebuildIndex reconstruye el CDX estructural del DBF bloqueando antes el
+// encabezado, como hace FoxPro al reindexar.
+func RebuildIndex(dbfPath string) error {
+	l, err := lockHeader(dbfPath, DefaultLockTimeout, DefaultLockRetry)
+	if err != nil {
+		return err
+	}
+	defer l.release()
+	return rebuildCDX(dbfPath, cdxPathFor(dbfPath))
+}
+
+// updateIndex actualiza el CDX después de escribir un contador indexado. La
+// intención queda sincronizada en el journal antes de tocar el archivo: si el
+// proceso muere a mitad de la escritura, al arrancar se reconstruye desde el
+// DBF (ver recoverJournal) en lugar de dejar un índice dañado en el que el
+// ERP confiaría. Se llama con m.mu y el bloqueo del encabezado tomados.
+func (m *Manager) updateIndex() error {
+	if m.journal == nil {
+		return rebuildCDX(m.dbfPath, m.cdxPath)
+	}
+	id, err := m.journal.indexIntent()
+	if err != nil {
+		return err
+	}
+	if err := rebuildCDX(m.dbfPath, m.cdxPath); err != nil {
+		// La intención queda pendiente: el próximo arranque lo reconstruye
+		return err
+	}
+	return m.journal.commit(id)
+}
+
+// loadIndex revisa qué contadores usa algún tag del CDX. Si alguno se usa,
+// cada asignación reconstruye el índice, así que todos los tags tienen que
+// poder reconstruirse; si no, el Manager no arranca. Un CDX ilegible solo se
+// advierte: FoxPro lo reporta al abrir la tabla y se arregla con REINDEX.
+func (m *Manager) loadIndex() error {
+	if _, err := os.Stat(m.cdxPath); os.IsNotExist(err) {
+		return nil
+	}
+	cdx, err := ReadCDX(m.cdxPath)
+	if err != nil {
+		m.Log(fmt.Sprintf("ADVERTENCIA: no se pudo leer el índice %s: %v", m.cdxPath, err))
+		return nil
+	}
+	h, data, err := readTable(m.dbfPath)
+	if err != nil {
+		return err
+	}
+
+	m.indexed = make(map[string]bool)
+	for _, tag := range cdx.Tags {
+		expr, err := compileKeyExpr(tag.Expr, h)
+		if err != nil {
+			continue
+		}
+		for _, f := range expr.Fields() {
+			if f == "NUMERO_1" || f == "NUMERO_2" {
+				m.indexed[f] = true
+			}
+		}
+	}
+	if len(m.indexed) == 0 {
+		return nil
+	}
+	for _, tag := range cdx.Tags {
+		if _, _, err := tableKeys(tag, h, data); err != nil {
+			return fmt.Errorf("el CDX indexa los contadores pero el tag %s no se puede reconstruir: %v", tag.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+// internal/dbf/journal.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operaciones del journal
+const (
+	journalIntent = "intento"
+	journalIndex  = "indice" // se va a reescribir el CDX (ver updateIndex)
+	journalCommit = "confirmado"
+)
+
+// journalCompactSize es el tamaño a partir del cual el journal se vacía
+// después de una confirmación. Como las asignaciones se serializan con m.mu,
+// en ese momento no queda ninguna intención pendiente.
+const journalCompactSize = 1 << 20
+
+// journalEntry es una línea del journal (JSON Lines)
+type journalEntry struct {
+	ID    int64     `json:"id"`
+	Op    string    `json:"op"`
+	Tipo  string    `json:"tipo,omitempty"`
+	Campo string    `json:"campo,omitempty"`
+	Hasta int64     `json:"hasta,omitempty"`
+	Fecha time.Time `json:"fecha"`
+}
+
+// journal es el registro de escritura anticipada de las asignaciones. Antes de
+// tocar el contador en el DBF se graba (y se sincroniza) la intención con el
+// último número que se va a entregar; después de escribir el DBF se graba la
+// confirmación. Si el proceso muere entre las dos, al arrancar se lleva el
+// contador al número de la intención: puede quedar un hueco, nunca un NCF
+// repetido. Un solo proceso a la vez es dueño del journal (bloqueo del SO).
+type journal struct {
+	file *os.File
+	next int64
+	size int64
+}
+
+// WithJournal cambia la ubicación del journal (por defecto FAC_PF_M.WAL junto
+// al DBF).
+func WithJournal(path string) Option {
+	return func(m *Manager) error {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("ruta de journal vacía")
+		}
+		m.journalPath = path
+		return nil
+	}
+}
+
+// defaultJournalPath es la ruta del journal junto al DBF
+func defaultJournalPath(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, ".DBF") + ".WAL"
+}
+
+// readJournal devuelve las entradas del journal. Una última línea incompleta
+// (el proceso murió mientras se escribía) se ignora: esa intención nunca se
+// sincronizó, así que tampoco se llegó a escribir el DBF.
+func readJournal(path string) ([]journalEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo journal: %v", err)
+	}
+
+	// Lo que sigue al último salto de línea quedó a medio escribir
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		data = data[:i+1]
+	}
+	var entries []journalEntry
+	for n, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("journal %s dañado en la línea %d: %v", path, n+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// pendingIntents devuelve las intenciones (de contadores y del índice) sin
+// confirmación
+func pendingIntents(entries []journalEntry) []journalEntry {
+	committed := make(map[int64]bool)
+	for _, e := range entries {
+		if e.Op == journalCommit {
+			committed[e.ID] = true
+		}
+	}
+	var pending []journalEntry
+	for _, e := range entries {
+		if (e.Op == journalIntent || e.Op == journalIndex) && !committed[e.ID] {
+			pending = append(pending, e)
+		}
+	}
+	return pending
+}
+
+// recoverJournal toma el journal para este proceso, reconcilia el DBF con lo
+// que dejó la ejecución anterior y lo vacía. Todas las intenciones suben la
+// marca de emisión (ver highwater.go); las que no llegaron a confirmarse se
+// aplican además al DBF. Si otro proceso (el servicio) ya tiene el journal,
+// solo se leen sus marcas y este Manager queda sin poder asignar.
+func (m *Manager) recoverJournal() error {
+	file, err := os.OpenFile(m.journalPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo journal: %v", err)
+	}
+	owned, err := tryLockRange(file, lockBase, 1)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error bloqueando journal: %v", err)
+	}
+	if !owned {
+		file.Close()
+	}
+
+	entries, err := readJournal(m.journalPath)
+	if err != nil {
+		if owned {
+			file.Close()
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.Op == journalIntent {
+			m.raiseMark(e.Tipo, counterCTA(e.Campo), e.Hasta)
+		}
+	}
+	if !owned {
+		m.Log(fmt.Sprintf("Journal %s en uso por otro proceso: este Manager no asigna números", m.journalPath))
+		return nil
+	}
+
+	// Cada contador con intenciones sin confirmar queda en la mayor de ellas
+	pending := pendingIntents(entries)
+	type counter struct{ tipo, campo string }
+	highest := make(map[counter]int64)
+	var order []counter
+	reconciled := 0
+	for _, e := range pending {
+		if e.Op != journalIntent {
+			continue
+		}
+		reconciled++
+		c := counter{e.Tipo, e.Campo}
+		if _, ok := highest[c]; !ok {
+			order = append(order, c)
+		}
+		if e.Hasta > highest[c] {
+			highest[c] = e.Hasta
+		}
+	}
+	for _, c := range order {
+		err := m.fastForward(c.tipo, c.campo, highest[c])
+		if errors.Is(err, ErrTypeNotFound) {
+			// El tipo se quitó del DBF: no hay contador que proteger
+			m.Log(fmt.Sprintf("Journal: %s ya no está en el DBF, se omite", c.tipo))
+			continue
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("recuperando el journal: %w", err)
+		}
+	}
+	if reconciled > 0 {
+		m.Log(fmt.Sprintf("Journal: %d asignación(es) sin confirmar de la ejecución anterior reconciliada(s)", reconciled))
+	}
+	// Una escritura del CDX (o la asignación que la iba a hacer) pudo quedar
+	// a medias: se reconstruye desde el DBF, que ya está al día
+	if len(pending) > 0 && len(m.indexed) > 0 {
+		if err := m.recoverIndex(); err != nil {
+			m.Log(fmt.Sprintf("ADVERTENCIA: no se pudo reconstruir el índice %s: %v", m.cdxPath, err))
+		} else {
+			m.Log(fmt.Sprintf("Journal: índice %s reconstruido", m.cdxPath))
+		}
+	}
+
+	// Las marcas quedan guardadas antes de vaciar el journal que las respalda
+	if err := m.saveHighWater(); err != nil {
+		file.Close()
+		return err
+	}
+	var next int64 = 1
+	if len(entries) > 0 {
+		next = entries[len(entries)-1].ID + 1
+	}
+	m.journal = &journal{file: file, next: next}
+	if err := m.journal.reset(); err != nil {
+		m.journal = nil
+		file.Close()
+		return err
+	}
+	return nil
+}
+
+// Exclusive indica si este Manager es dueño del journal. Si es false, otro
+// proceso (normalmente el servicio) está asignando números sobre el DBF.
+func (m *Manager) Exclusive() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.journal != nil
+}
+
+// commitJournal confirma la intención id. Cuando el journal crece, primero se
+// guardan las marcas y después se vacía.
+func (m *Manager) commitJournal(id int64) error {
+	if err := m.journal.commit(id); err != nil {
+		return err
+	}
+	if m.journal.size < journalCompactSize {
+		return nil
+	}
+	if err := m.saveHighWater(); err != nil {
+		return err
+	}
+	return m.journal.reset()
+}
+
+// Close guarda las marcas de emisión y libera el journal para que otro
+// proceso pueda tomarlo
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.releaseJournal()
+}
+
+// releaseJournal guarda las marcas y suelta el journal. Se llama con m.mu
+// tomado.
+func (m *Manager) releaseJournal() error {
+	if m.journal == nil {
+		return nil
+	}
+	err := m.saveHighWater()
+	unlockRange(m.journal.file, lockBase, 1)
+	if cerr := m.journal.file.Close(); err == nil {
+		err = cerr
+	}
+	m.journal = nil
+	return err
+}
+
+// Suspend pone el Manager en pausa para que el ERP pueda correr sus procesos
+// de cierre: espera a que termine la asignación en curso y suelta el journal
+// (las herramientas de administración pueden tomarlo). Mientras tanto no se
+// abre el DBF: las lecturas se responden con la tabla en memoria tal como
+// estaba al pausar y las escrituras devuelven ErrSuspended.
+func (m *Manager) Suspend() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.suspended {
+		return nil
+	}
+	// Última lectura antes de soltar el archivo, por si el ERP lo cambió
+	if _, err := m.cachedTable(); err != nil {
+		m.Log(fmt.Sprintf("No se pudo leer el DBF antes de la pausa: %v", err))
+	}
+	err := m.releaseJournal()
+	m.suspended = true
+	m.Log("Manager en pausa: journal liberado")
+	return err
+}
+
+// Resume vuelve a tomar el journal, reconcilia lo que haya quedado en él y
+// relee el DBF, que pudo cambiar durante la pausa. Si otro proceso tiene el
+// journal el Manager sigue en pausa con la tabla que tenía.
+func (m *Manager) Resume() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.suspended {
+		return nil
+	}
+	table, tipos := m.table, m.tipos
+	m.suspended = false
+	m.invalidate()
+	err := m.recoverJournal()
+	if err == nil && m.journal == nil {
+		err = fmt.Errorf("el journal %s lo tiene otro proceso; el Manager sigue en pausa", m.journalPath)
+	}
+	if err != nil {
+		m.suspended = true
+		if m.table == nil {
+			m.table, m.tipos = table, tipos
+		}
+		return err
+	}
+	m.Log("Manager reanudado")
+	// Avisar si durante la pausa alguien dejó un contador por debajo de lo emitido
+	if table, err := m.cachedTable(); err == nil {
+		m.checkRollbacks(table)
+	}
+	return nil
+}
+
+// fastForward lleva el contador campo de tipo a hasta si quedó por debajo.
+// Se llama con m.mu tomado o durante NewManager.
+func (m *Manager) fastForward(tipo, campo string, hasta int64) error {
+	table, err := m.cachedTable()
+	if err != nil {
+		return err
+	}
+	row, ok := findRow(table, tipo)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTypeNotFound, tipo)
+	}
+	lock, err := m.lockForWrite(row)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	if table, err = m.lockedTable(lock, row); err != nil {
+		return err
+	}
+
+	actual, _ := table.Int64FieldValueByName(row, campo)
+	if actual >= hasta {
+		return nil
+	}
+	if err := m.writeRecordField(table, row, campo, strconv.FormatInt(hasta, 10)); err != nil {
+		return err
+	}
+	m.Log(fmt.Sprintf("Journal: %s %s avanzado de %d a %d", tipo, campo, actual, hasta))
+	return nil
+}
+
+// intent graba y sincroniza la intención de llevar campo de tipo a hasta
+func (j *journal) intent(tipo, campo string, hasta int64) (int64, error) {
+	id := j.next
+	if err := j.append(journalEntry{ID: id, Op: journalIntent, Tipo: tipo, Campo: campo, Hasta: hasta, Fecha: time.Now()}, true); err != nil {
+		return 0, err
+	}
+	j.next++
+	return id, nil
+}
+
+// indexIntent graba y sincroniza la intención de reescribir el CDX
+func (j *journal) indexIntent() (int64, error) {
+	id := j.next
+	if err := j.append(journalEntry{ID: id, Op: journalIndex, Fecha: time.Now()}, true); err != nil {
+		return 0, err
+	}
+	j.next++
+	return id, nil
+}
+
+// recoverIndex reconstruye el CDX con el encabezado del DBF bloqueado
+func (m *Manager) recoverIndex() error {
+	l, err := lockHeader(m.dbfPath, m.lockTimeout, m.lockRetry)
+	if err != nil {
+		return err
+	}
+	defer l.release()
+	return rebuildCDX(m.dbfPath, m.cdxPath)
+}
+
+// commit marca la intención id como escrita en el DBF. No hace falta
+// sincronizar: si se pierde, la recuperación solo reaplica un valor que el DBF
+// ya tiene.
+func (j *journal) commit(id int64) error {
+	return j.append(journalEntry{ID: id, Op: journalCommit, Fecha: time.Now()}, false)
+}
+
+// reset vacía el journal
+func (j *journal) reset() error {
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("error vaciando journal: %v", err)
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error vaciando journal: %v", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("error sincronizando journal: %v", err)
+	}
+	j.size = 0
+	return nil
+}
+
+func (j *journal) append(e journalEntry, sync bool) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error escribiendo journal: %v", err)
+	}
+	if sync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("error sincronizando journal: %v", err)
+		}
+	}
+	return nil
+}
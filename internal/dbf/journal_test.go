@@ -0,0 +1,175 @@
+package dbf_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func numero1(t *testing.T, mgr *dbf.Manager, tipo string) int64 {
+	t.Helper()
+	tipos, err := mgr.GetRecordTypes()
+	if err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	for _, ct := range tipos {
+		if ct.NCFTipo == tipo {
+			return ct.Numero1
+		}
+	}
+	t.Fatalf("%s no está en el DBF", tipo)
+	return 0
+}
+
+func TestManager_JournalRecordsAllocations(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path)
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+
+	f, err := os.Open(strings.TrimSuffix(path, ".DBF") + ".WAL")
+	if err != nil {
+		t.Fatalf("no se creó el journal: %v", err)
+	}
+	defer f.Close()
+	var ops []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e struct {
+			Op    string `json:"op"`
+			Tipo  string `json:"tipo"`
+			Hasta int64  `json:"hasta"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("línea inválida %q: %v", scanner.Text(), err)
+		}
+		ops = append(ops, e.Op)
+		if e.Op == "intento" && (e.Tipo != "E34" || e.Hasta != 1) {
+			t.Errorf("intento = %+v, se esperaba E34 hasta 1", e)
+		}
+	}
+	if strings.Join(ops, ",") != "intento,confirmado" {
+		t.Errorf("journal = %v, se esperaba intento y confirmado", ops)
+	}
+}
+
+func TestManager_JournalRecovery(t *testing.T) {
+	path := copyFixture(t)
+	wal := filepath.Join(t.TempDir(), "asignaciones.wal")
+
+	// El proceso murió después de grabar la intención de E34 hasta 7 y antes
+	// de escribir el DBF; la última línea quedó a medio escribir
+	content := `{"id":1,"op":"intento","tipo":"E32","campo":"NUMERO_1","hasta":3,"fecha":"2026-10-16T08:00:00Z"}
+{"id":1,"op":"confirmado","fecha":"2026-10-16T08:00:00Z"}
+{"id":2,"op":"intento","tipo":"E34","campo":"NUMERO_1","hasta":7,"fecha":"2026-10-16T08:00:01Z"}
+{"id":3,"op":"intento","tipo":"E34","campo":"NUMERO_1","hasta":9`
+	if err := os.WriteFile(wal, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr, err := dbf.NewManager(path, dbf.WithJournal(wal))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if n := numero1(t, mgr, "E34"); n != 7 {
+		t.Errorf("NUMERO_1 de E34 = %d, se esperaba 7", n)
+	}
+	// E32 sí llegó al DBF: que ahora esté en 0 es un retroceso (ver
+	// highwater.go), no algo que el journal deba corregir
+	if n := numero1(t, mgr, "E32"); n != 0 {
+		t.Errorf("NUMERO_1 de E32 = %d, se esperaba 0", n)
+	}
+	if _, _, err := mgr.GetSequence("E32", "A"); !errors.Is(err, dbf.ErrCounterRollback) {
+		t.Errorf("GetSequence(E32) error = %v, se esperaba ErrCounterRollback", err)
+	}
+
+	// El siguiente número no repite ninguno de los ya entregados
+	seq, _, err := mgr.GetSequence("E34", "A")
+	if err != nil || seq != "E340000000008" {
+		t.Errorf("GetSequence() = %s, %v; se esperaba E340000000008", seq, err)
+	}
+
+	// Al reabrir no se vuelve a aplicar nada
+	if err := mgr.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	mgr = mustManager(t, path, dbf.WithJournal(wal))
+	if n := numero1(t, mgr, "E34"); n != 8 {
+		t.Errorf("NUMERO_1 de E34 después de reabrir = %d, se esperaba 8", n)
+	}
+}
+
+func TestManager_JournalCorrupt(t *testing.T) {
+	path := copyFixture(t)
+	wal := filepath.Join(t.TempDir(), "asignaciones.wal")
+	if err := os.WriteFile(wal, []byte("basura\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.NewManager(path, dbf.WithJournal(wal)); err == nil {
+		t.Error("NewManager() debía fallar con un journal dañado")
+	}
+}
+
+func TestManager_SuspendResume(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path)
+	defer mgr.Close()
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+
+	if err := mgr.Suspend(); err != nil {
+		t.Fatalf("Suspend() error = %v", err)
+	}
+	if _, _, err := mgr.GetSequence("E34", "A"); !errors.Is(err, dbf.ErrSuspended) {
+		t.Errorf("GetSequence() en pausa = %v, se esperaba ErrSuspended", err)
+	}
+	if got := numero1(t, mgr, "E34"); got != 1 {
+		t.Errorf("GetRecordTypes() en pausa: E34 = %d, se esperaba 1", got)
+	}
+	if _, _, err := mgr.Peek("E34", "A"); !errors.Is(err, dbf.ErrSuspended) {
+		t.Errorf("Peek() en pausa = %v, se esperaba ErrSuspended", err)
+	}
+
+	// Con el journal libre, una herramienta de administración puede tomarlo
+	admin := mustManager(t, path)
+	if !admin.Exclusive() {
+		t.Fatal("el journal no se liberó durante la pausa")
+	}
+	reloads := mgr.Reloads()
+	if err := admin.Adjust("E34", "A", 10); err != nil {
+		t.Fatalf("Adjust() error = %v", err)
+	}
+	// En pausa el DBF no se abre aunque haya cambiado: se responde con la
+	// tabla que había al pausar
+	if got := numero1(t, mgr, "E34"); got != 1 || mgr.Reloads() != reloads {
+		t.Errorf("GetRecordTypes() en pausa tras un cambio: E34 = %d, %d relecturas", got, mgr.Reloads()-reloads)
+	}
+	if err := mgr.Resume(); err == nil {
+		t.Error("Resume() con el journal tomado por otro proceso no falló")
+	}
+	if got := numero1(t, mgr, "E34"); got != 1 {
+		t.Errorf("GetRecordTypes() tras un Resume() fallido: E34 = %d, se esperaba 1", got)
+	}
+	if _, _, err := mgr.GetSequence("E34", "A"); !errors.Is(err, dbf.ErrSuspended) {
+		t.Errorf("GetSequence() = %v, el Manager debía seguir en pausa", err)
+	}
+	admin.Close()
+
+	if err := mgr.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if !mgr.Exclusive() {
+		t.Error("Resume() no volvió a tomar el journal")
+	}
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000011" {
+		t.Errorf("GetSequence() = %q, %v; se esperaba continuar después del ajuste", seq, err)
+	}
+}
@@ -0,0 +1,97 @@
+// internal/dbf/lock.go
+package dbf
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Offsets de bloqueo de Visual FoxPro. FoxPro no bloquea los bytes del
+// registro sino posiciones más allá del fin del archivo: el encabezado en
+// lockBase y cada registro en lockBase - recno (recno en base 1). Usar las
+// mismas posiciones hace que el servicio y el ERP se esperen mutuamente.
+const (
+	lockBase         int64 = 0x7FFFFFFE
+	headerLockOffset       = lockBase
+)
+
+// recordLockOffset es la posición de bloqueo del registro row (base 0)
+func recordLockOffset(row int) int64 {
+	return lockBase - int64(row+1)
+}
+
+// Valores por defecto de WithLockTimeout
+const (
+	DefaultLockTimeout = 5 * time.Second
+	DefaultLockRetry   = 50 * time.Millisecond
+)
+
+// WithLockTimeout define cuánto se espera un bloqueo del DBF tomado por otro
+// proceso y cada cuánto se reintenta.
+func WithLockTimeout(timeout, retry time.Duration) Option {
+	return func(m *Manager) error {
+		if timeout < 0 || retry <= 0 {
+			return fmt.Errorf("tiempo de bloqueo inválido: timeout=%v reintento=%v", timeout, retry)
+		}
+		m.lockTimeout, m.lockRetry = timeout, retry
+		return nil
+	}
+}
+
+// dbfLock son los rangos bloqueados sobre un descriptor propio del DBF
+type dbfLock struct {
+	file *os.File
+	held []int64
+}
+
+// lockForWrite bloquea el registro row y el encabezado, en ese orden, antes de
+// actualizar el contador y la fecha de última modificación.
+func (m *Manager) lockForWrite(row int) (*dbfLock, error) {
+	f, err := os.OpenFile(m.dbfPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DBF para bloquear: %v", err)
+	}
+	l := &dbfLock{file: f}
+	for _, lock := range []struct {
+		offset int64
+		what   string
+	}{
+		{recordLockOffset(row), fmt.Sprintf("registro %d", row+1)},
+		{headerLockOffset, "encabezado"},
+	} {
+		if err := l.acquire(lock.offset, m.lockTimeout, m.lockRetry); err != nil {
+			l.release()
+			return nil, fmt.Errorf("%w: %s de %s", err, lock.what, m.dbfPath)
+		}
+	}
+	return l, nil
+}
+
+// acquire intenta tomar el byte offset hasta que se cumpla timeout
+func (l *dbfLock) acquire(offset int64, timeout, retry time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockRange(l.file, offset, 1)
+		if err != nil {
+			return err
+		}
+		if ok {
+			l.held = append(l.held, offset)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(retry)
+	}
+}
+
+// release libera los bloqueos en orden inverso y cierra el descriptor
+func (l *dbfLock) release() {
+	for i := len(l.held) - 1; i >= 0; i-- {
+		unlockRange(l.file, l.held[i], 1)
+	}
+	l.held = nil
+	l.file.Close()
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package dbf
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// En Linux se usan bloqueos fcntl de descripción de archivo abierto (OFD): a
+// diferencia de F_SETLK no se pierden cuando el mismo proceso cierra otro
+// descriptor del DBF (por ejemplo, al releer la tabla).
+func tryLockRange(f *os.File, offset, length int64) (bool, error) {
+	lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: io.SeekStart, Start: offset, Len: length}
+	err := unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, &lk)
+	if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EACCES) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockRange(f *os.File, offset, length int64) error {
+	lk := unix.Flock_t{Type: unix.F_UNLCK, Whence: io.SeekStart, Start: offset, Len: length}
+	return unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, &lk)
+}
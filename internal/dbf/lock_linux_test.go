@@ -0,0 +1,91 @@
+//go:build linux
+
+package dbf_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// Offset de bloqueo FoxPro del registro de E34 en el DBF de prueba
+// (registro 7): 0x7FFFFFFE - 7
+const fixtureE34LockOffset = 0x7FFFFFFE - 7
+
+// TestHelperLockHolder no es un test: es el proceso externo que hace de ERP y
+// mantiene el RLOCK del registro de E34 hasta que se le cierra la entrada.
+func TestHelperLockHolder(t *testing.T) {
+	path := os.Getenv("DBF_LOCK_HELPER")
+	if path == "" {
+		t.Skip("solo se usa como proceso auxiliar")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: io.SeekStart, Start: fixtureE34LockOffset, Len: 1}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_SETLK, &lk); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout.WriteString("bloqueado\n")
+	io.Copy(io.Discard, os.Stdin)
+	os.Exit(0)
+}
+
+func TestManager_RecordLockedByOtherProcess(t *testing.T) {
+	path := copyFixture(t)
+	mgr, err := dbf.NewManager(path, dbf.WithLockTimeout(200*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperLockHolder$")
+	cmd.Env = append(os.Environ(), "DBF_LOCK_HELPER="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "bloqueado\n" {
+		t.Fatalf("el proceso auxiliar no tomó el bloqueo: %q, %v", line, err)
+	}
+
+	// Mientras el otro proceso tiene el registro, E34 espera y se rinde
+	start := time.Now()
+	if _, _, err := mgr.GetSequence("E34", "A"); !errors.Is(err, dbf.ErrLockTimeout) {
+		t.Fatalf("GetSequence() error = %v, se esperaba ErrLockTimeout", err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("GetSequence() se rindió a los %v, antes del tiempo de espera", d)
+	}
+
+	// Otro registro no queda bloqueado
+	if _, _, err := mgr.GetSequence("E32", "A"); err != nil {
+		t.Errorf("GetSequence(E32) error = %v", err)
+	}
+
+	// Al liberar el bloqueo se asigna el siguiente número sin saltos
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("proceso auxiliar: %v", err)
+	}
+	seq, _, err := mgr.GetSequence("E34", "A")
+	if err != nil || seq != "E340000000001" {
+		t.Errorf("GetSequence() = %s, %v; se esperaba E340000000001", seq, err)
+	}
+}
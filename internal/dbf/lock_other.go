@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+
+package dbf
+
+import "os"
+
+// En otras plataformas no hay un ERP FoxPro con quien coordinar: los bloqueos
+// entre goroutines los cubre Manager.mu.
+func tryLockRange(f *os.File, offset, length int64) (bool, error) {
+	return true, nil
+}
+
+func unlockRange(f *os.File, offset, length int64) error {
+	return nil
+}
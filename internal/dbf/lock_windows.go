@@ -0,0 +1,27 @@
+//go:build windows
+
+package dbf
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// En Windows se usa LockFileEx, el mismo mecanismo que usa FoxPro.
+func tryLockRange(f *os.File, offset, length int64) (bool, error) {
+	ol := windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	err := windows.LockFileEx(windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, uint32(length), uint32(length>>32), &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) || errors.Is(err, windows.ERROR_IO_PENDING) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockRange(f *os.File, offset, length int64) error {
+	ol := windows.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, uint32(length), uint32(length>>32), &ol)
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/LindsayBradford/go-dbf/godbf"
+
+	"ecf-sequence-server/internal/ncf"
 )
 
 // ComprobanteTipo representa la estructura de un tipo de comprobante
@@ -25,40 +27,152 @@ type ComprobanteTipo struct {
 	FechaDoc   string `json:"fecha_vencimiento"`
 	Minimo     int64  `json:"minimo"`
 	CantSecuen int64  `json:"cantidad_secuencias"`
+	BajoMinimo bool   `json:"bajo_minimo"` // lo completa el monitor de stock
 }
 
 // Manager maneja las operaciones con archivos DBF (y opcionalmente CDX)
 type Manager struct {
-	mu      sync.Mutex
-	dbfPath string
-	cdxPath string
-	logFile *os.File
+	mu         sync.Mutex
+	dbfPath    string
+	cdxPath    string
+	logPath    string
+	logFile    *os.File
+	partitions Partitions     // clave: "TIPO/CTA"
+	widths     map[string]int // ancho declarado de los contadores
+
+	// Tabla en memoria; se relee solo cuando el archivo cambia (ver cache.go)
+	table   *godbf.DbfTable
+	header  *dbfHeader        // encabezado de la misma versión que table
+	raw     []byte            // bytes del archivo de los que salió table (ver lockedTable)
+	tipos   []ComprobanteTipo // armado a partir de table
+	stamp   fileStamp
+	reloads int
+
+	stockObserver func(StockLevel)
+
+	lockTimeout time.Duration
+	lockRetry   time.Duration
+
+	journalPath string
+	journal     *journal // nil si el journal lo tiene otro proceso
+	suspended   bool     // en pausa; ver Suspend
+
+	// Marcas de emisión (ver highwater.go); clave: "TIPO/CTA"
+	hwmPath          string
+	marks            map[string]int64
+	rolledBack       map[string]bool
+	rollbackObserver func(Rollback)
+
+	indexed map[string]bool // contadores que usa algún tag del CDX
+
+	encoding string // página de códigos forzada; vacía = la del encabezado
+
+	// Respaldos automáticos (ver snapshot.go); snapDir vacío = deshabilitados
+	snapDir      string
+	snapPolicy   SnapshotPolicy
+	lastSnapshot time.Time
 }
 
-// NewManager crea una nueva instancia de Manager
-func NewManager(dbfPath string) (*Manager, error) {
-	logFile, err := os.OpenFile("sequence.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("error creating log file: %v", err)
+// Option configura parámetros opcionales del Manager
+type Option func(*Manager) error
+
+// WithPartitions asigna a cada CTA su sub-rango de números. Se rechazan
+// particiones solapadas para que el servidor no arranque mal configurado.
+func WithPartitions(parts []Partition) Option {
+	return func(m *Manager) error {
+		ps, err := NewPartitions(parts)
+		if err != nil {
+			return err
+		}
+		for key, p := range ps {
+			m.partitions[key] = p
+		}
+		return nil
 	}
+}
 
+// NewManager crea una nueva instancia de Manager
+func NewManager(dbfPath string, opts ...Option) (*Manager, error) {
 	//valida que el archivo DBF exista
 	if _, err := os.Stat(dbfPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("el archivo DBF no existe: %s", dbfPath)
 	}
 
-	// Como el CDX no lo manejamos con la librería godbf, podrías simplemente
-	// omitir esta parte o validarla como en tu ejemplo original.
-	cdxPath := strings.TrimSuffix(dbfPath, ".DBF") + ".CDX"
+	// godbf no maneja el CDX; se mantiene a mano (ver index.go)
+	cdxPath := cdxPathFor(dbfPath)
 
-	return &Manager{
-		dbfPath: dbfPath,
-		cdxPath: cdxPath,
-		logFile: logFile,
-	}, nil
+	// El ancho de los contadores se toma del encabezado para no escribir un
+	// valor que el campo no pueda guardar
+	header, err := readHeader(dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	widths := counterWidths(header)
+
+	m := &Manager{
+		dbfPath:     dbfPath,
+		cdxPath:     cdxPath,
+		logPath:     "sequence.log",
+		partitions:  make(Partitions),
+		widths:      widths,
+		header:      header,
+		lockTimeout: DefaultLockTimeout,
+		lockRetry:   DefaultLockRetry,
+		journalPath: defaultJournalPath(dbfPath),
+		hwmPath:     defaultHighWaterPath(dbfPath),
+		marks:       make(map[string]int64),
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	m.logFile, err = os.OpenFile(m.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log file: %v", err)
+	}
+
+	m.logEncoding(header)
+	if err := m.loadIndex(); err != nil {
+		return nil, err
+	}
+	if err := m.loadHighWater(); err != nil {
+		return nil, err
+	}
+	if err := m.loadSnapshots(); err != nil {
+		return nil, err
+	}
+	// Si la ejecución anterior murió a mitad de una asignación, el DBF se
+	// pone al día antes de atender la primera solicitud
+	if err := m.recoverJournal(); err != nil {
+		return nil, err
+	}
+	// Avisar desde el arranque si alguien restauró una copia vieja del DBF
+	if _, err := m.Rollbacks(); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-// Log graba en el log local y en el archivo 'sequence.log'
+// FieldWidth devuelve el ancho declarado de un contador (NUMERO_1 o NUMERO_2)
+// según el encabezado leído al crear el Manager; 0 si el campo no existe.
+func (m *Manager) FieldWidth(name string) int {
+	return m.widths[name]
+}
+
+// WithLogFile cambia el archivo de log del Manager (por defecto
+// sequence.log en el directorio actual).
+func WithLogFile(path string) Option {
+	return func(m *Manager) error {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("ruta de log vacía")
+		}
+		m.logPath = path
+		return nil
+	}
+}
+
+// Log graba en el log local y en el archivo de log (sequence.log)
 func (m *Manager) Log(message string) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	fullMsg := fmt.Sprintf("%s: %s\n", timestamp, message)
@@ -81,10 +195,15 @@ func (m *Manager) GetRecordTypes() ([]ComprobanteTipo, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// 1. Abrimos el archivo DBF con godbf
-	table, err := godbf.NewFromFile(m.dbfPath, "latin1") // Ajusta la codificación si es necesario
+	// 1. Tomamos la tabla en memoria (se relee si el ERP modificó el archivo)
+	table, err := m.cachedTable()
 	if err != nil {
-		return nil, fmt.Errorf("error abriendo DBF: %v", err)
+		return nil, err
+	}
+	// Si la tabla no cambió desde la última consulta se devuelve una copia de
+	// la lista ya armada (el llamador puede modificarla)
+	if m.tipos != nil {
+		return append([]ComprobanteTipo(nil), m.tipos...), nil
 	}
 
 	var tipos []ComprobanteTipo
@@ -96,75 +215,325 @@ func (m *Manager) GetRecordTypes() ([]ComprobanteTipo, error) {
 		if table.RowIsDeleted(i) {
 			continue
 		}
+		tipos = append(tipos, rowType(table, i))
+	}
 
-		// Lee los valores de cada campo
-		codPffStr, _ := table.FieldValueByName(i, "COD_PF_F")
-		nombreStr, _ := table.FieldValueByName(i, "NOMBRE")
-		resumenStr, _ := table.FieldValueByName(i, "RESUMEN")
-		numeroStr, _ := table.FieldValueByName(i, "NUMERO")
-		num1Str, _ := table.FieldValueByName(i, "NUMERO_1")
-		num2Str, _ := table.FieldValueByName(i, "NUMERO_2")
-		fecDocStr, _ := table.FieldValueByName(i, "FEC_DOC")
-		minStr, _ := table.FieldValueByName(i, "MINIMO")
-		cantsStr, _ := table.FieldValueByName(i, "CANTSECUEN")
-
-		// Convertir a numérico donde corresponda
-		codPffVal := int(parseInt(codPffStr))
-		num1Val := parseInt(num1Str)
-		num2Val := parseInt(num2Str)
-		minVal := parseInt(minStr)
-		cantsVal := parseInt(cantsStr)
-
-		// Creamos el struct
-		comprob := ComprobanteTipo{
-			CodPFF:     codPffVal,
-			Nombre:     strings.TrimSpace(nombreStr),
-			Resumen:    strings.TrimSpace(resumenStr),
-			Numero:     strings.TrimSpace(numeroStr),
-			Numero1:    num1Val,
-			Numero2:    num2Val,
-			FechaDoc:   strings.TrimSpace(fecDocStr),
-			Minimo:     minVal,
-			CantSecuen: cantsVal,
-		}
+	m.tipos = tipos
+	return append([]ComprobanteTipo(nil), tipos...), nil
+}
 
-		// Extraer el NCF si "Numero" tiene al menos 3 caracteres
-		if len(comprob.Numero) >= 3 {
-			comprob.NCFTipo = comprob.Numero[:3]
-		}
+// rowType arma el ComprobanteTipo del registro i (base 0) de table
+func rowType(table *godbf.DbfTable, i int) ComprobanteTipo {
+	// Lee los valores de cada campo
+	codPffStr, _ := table.FieldValueByName(i, "COD_PF_F")
+	nombreStr, _ := table.FieldValueByName(i, "NOMBRE")
+	resumenStr, _ := table.FieldValueByName(i, "RESUMEN")
+	numeroStr, _ := table.FieldValueByName(i, "NUMERO")
+	num1Str, _ := table.FieldValueByName(i, "NUMERO_1")
+	num2Str, _ := table.FieldValueByName(i, "NUMERO_2")
+	fecDocStr, _ := table.FieldValueByName(i, "FEC_DOC")
+	minStr, _ := table.FieldValueByName(i, "MINIMO")
+	cantsStr, _ := table.FieldValueByName(i, "CANTSECUEN")
+
+	// Convertir a numérico donde corresponda
+	codPffVal := int(parseInt(codPffStr))
+	num1Val := parseInt(num1Str)
+	num2Val := parseInt(num2Str)
+	minVal := parseInt(minStr)
+	cantsVal := parseInt(cantsStr)
+
+	// Creamos el struct
+	comprob := ComprobanteTipo{
+		CodPFF:     codPffVal,
+		Nombre:     strings.TrimSpace(nombreStr),
+		Resumen:    strings.TrimSpace(resumenStr),
+		Numero:     strings.TrimSpace(numeroStr),
+		Numero1:    num1Val,
+		Numero2:    num2Val,
+		FechaDoc:   strings.TrimSpace(fecDocStr),
+		Minimo:     minVal,
+		CantSecuen: cantsVal,
+	}
 
-		tipos = append(tipos, comprob)
+	// Extraer el NCF si "Numero" tiene al menos 3 caracteres
+	if len(comprob.Numero) >= 3 {
+		comprob.NCFTipo = comprob.Numero[:3]
 	}
 
-	return tipos, nil
+	return comprob
 }
 
-// ...existing code...
+// GetSequence asigna el siguiente número de tipo/cta y devuelve el NCF junto
+// con el valor numérico que quedó en el contador.
 func (m *Manager) GetSequence(tipo string, cta string) (string, int64, error) {
+	sequences, first, err := m.GetSequences(tipo, cta, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return sequences[0], first, nil
+}
+
+// GetSequences reserva count números contiguos de tipo/cta con una sola
+// escritura del DBF. Es todo o nada: si el último número quedaría fuera del
+// rango autorizado no se asigna ninguno. Devuelve los NCF y el primer número.
+func (m *Manager) GetSequences(tipo string, cta string, count int) ([]string, int64, error) {
+	if count < 1 {
+		return nil, 0, fmt.Errorf("cantidad inválida: %d", count)
+	}
+	ncfTipo, err := ncf.Lookup(tipo)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.suspended {
+		return nil, 0, ErrSuspended
+	}
 
-	table, err := godbf.NewFromFile(m.dbfPath, "latin1")
+	table, err := m.cachedTable()
 	if err != nil {
-		return "", 0, fmt.Errorf("error abriendo DBF: %v", err)
+		return nil, 0, err
 	}
 
-	var found bool
-	var newSeqVal int64
-	var fieldName string
+	cta = strings.ToUpper(cta)
+	fieldName, err := ctaField(cta)
+	if err != nil {
+		return nil, 0, err
+	}
+	part, err := m.partitionFor(tipo, cta)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	// Determina si se incrementa NUMERO_1 o NUMERO_2
-	switch strings.ToUpper(cta) {
-	case "A":
-		fieldName = "NUMERO_1"
-	case "B":
-		fieldName = "NUMERO_2"
-	default:
-		return "", 0, fmt.Errorf("CTA no válido: %s", cta)
+	row, ok := findRow(table, tipo)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrTypeNotFound, tipo)
 	}
 
-	totalRecords := table.NumberOfRecords()
-	for i := 0; i < totalRecords; i++ {
+	// Bloquear el registro como lo hace FoxPro (RLOCK) y releer el contador
+	// bajo el bloqueo, por si el ERP lo cambió mientras esperábamos
+	lock, err := m.lockForWrite(row)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer lock.release()
+	if table, err = m.lockedTable(lock, row); err != nil {
+		return nil, 0, err
+	}
+	if r, ok := findRow(table, tipo); !ok || r != row {
+		return nil, 0, fmt.Errorf("el registro de %s cambió de posición mientras se bloqueaba, reintente", tipo)
+	}
+
+	// No se escribe nada si algún número queda fuera de lo autorizado
+	firstVal, lastVal, err := m.nextRange(table, row, ncfTipo, cta, part, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// La intención queda en disco antes de tocar el DBF (ver journal.go)
+	if m.journal == nil {
+		return nil, 0, fmt.Errorf("el journal %s lo tiene otro proceso; este Manager no puede asignar", m.journalPath)
+	}
+	m.maybeSnapshot()
+	id, err := m.journal.intent(tipo, fieldName, lastVal)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Solo se reescriben los bytes del contador en este registro
+	if err := m.writeRecordField(table, row, fieldName, strconv.FormatInt(lastVal, 10)); err != nil {
+		return nil, 0, err
+	}
+	m.raiseMark(tipo, cta, lastVal)
+	if err := m.commitJournal(id); err != nil {
+		// El DBF ya tiene el valor: la próxima recuperación no cambia nada
+		m.Log(fmt.Sprintf("Error confirmando en el journal: %v", err))
+	}
+
+	sequences := make([]string, 0, count)
+	for n := firstVal; n <= lastVal; n++ {
+		sequences = append(sequences, ncfTipo.Format(n))
+	}
+	if count == 1 {
+		m.Log(fmt.Sprintf("Generated sequence: %s", sequences[0]))
+	} else {
+		m.Log(fmt.Sprintf("Generated sequences: %s - %s (%d)", sequences[0], sequences[count-1], count))
+	}
+
+	if m.stockObserver != nil {
+		cantsStr, _ := table.FieldValueByName(row, "CANTSECUEN")
+		minStr, _ := table.FieldValueByName(row, "MINIMO")
+		if level, ok := StockLevelFor(part, parseInt(cantsStr), parseInt(minStr), lastVal); ok {
+			m.stockObserver(level)
+		}
+	}
+	return sequences, firstVal, nil
+}
+
+// ctaField es el contador que usa cta: NUMERO_1 para A y NUMERO_2 para B
+func ctaField(cta string) (string, error) {
+	switch cta {
+	case "A", "B":
+		return counterField(cta), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidCTA, cta)
+}
+
+// nextRange calcula los count números que siguen en la cuenta cta del
+// registro row y aplica todas las validaciones sin escribir nada. Se llama
+// con m.mu tomado.
+func (m *Manager) nextRange(table *godbf.DbfTable, row int, ncfTipo ncf.Tipo, cta string, part Partition, count int) (int64, int64, error) {
+	tipo, fieldName := ncfTipo.Codigo, counterField(cta)
+	seqVal, _ := table.Int64FieldValueByName(row, fieldName)
+	if emitido := m.marks[tipo+"/"+cta]; seqVal < emitido {
+		return 0, 0, fmt.Errorf("%w: %s CTA %s está en %d y ya se emitió hasta %d",
+			ErrCounterRollback, tipo, cta, seqVal, emitido)
+	}
+	firstVal, lastVal, err := PlanRange(ncfTipo, part, seqVal, count)
+	if err != nil {
+		return 0, 0, err
+	}
+	if width, ok := m.widths[fieldName]; ok && lastVal > maxForWidth(width) {
+		return 0, 0, fmt.Errorf("%w: %s CTA %s llegaría a %d y %s es N(%d)",
+			ErrFieldOverflow, tipo, cta, lastVal, fieldName, width)
+	}
+	fecDocStr, _ := table.FieldValueByName(row, "FEC_DOC")
+	cantsStr, _ := table.FieldValueByName(row, "CANTSECUEN")
+	if err := CheckAuthorization(tipo, fecDocStr, parseInt(cantsStr), lastVal); err != nil {
+		return 0, 0, err
+	}
+	return firstVal, lastVal, nil
+}
+
+// PlanRange calcula el tramo de count números que sigue a actual dentro de la
+// partición part y de la serie del tipo. La primera emisión dentro de la
+// partición salta a su inicio.
+func PlanRange(ncfTipo ncf.Tipo, part Partition, actual int64, count int) (int64, int64, error) {
+	firstVal := actual + 1
+	if firstVal < part.Desde {
+		firstVal = part.Desde
+	}
+	lastVal := firstVal + int64(count) - 1
+	if lastVal > ncfTipo.Serie.MaxNumero() {
+		return 0, 0, fmt.Errorf("%w: %s llegaría a %d y la serie admite hasta %d",
+			ErrRangeExhausted, ncfTipo.Codigo, lastVal, ncfTipo.Serie.MaxNumero())
+	}
+	if part.Hasta > 0 && lastVal > part.Hasta {
+		return 0, 0, fmt.Errorf("%w: %s CTA %s llegaría a %d y su partición termina en %d",
+			ErrRangeExhausted, ncfTipo.Codigo, part.CTA, lastVal, part.Hasta)
+	}
+	return firstVal, lastVal, nil
+}
+
+// Peek devuelve el NCF y el número que entregaría la próxima asignación de
+// tipo/cta, con las mismas validaciones, sin asignarlo. En pausa devuelve
+// ErrSuspended: la próxima asignación depende de lo que haga el ERP.
+func (m *Manager) Peek(tipo string, cta string) (string, int64, error) {
+	ncfTipo, err := ncf.Lookup(tipo)
+	if err != nil {
+		return "", 0, err
+	}
+	cta = strings.ToUpper(cta)
+	if _, err := ctaField(cta); err != nil {
+		return "", 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.suspended {
+		return "", 0, ErrSuspended
+	}
+	table, err := m.cachedTable()
+	if err != nil {
+		return "", 0, err
+	}
+	part, err := m.partitionFor(tipo, cta)
+	if err != nil {
+		return "", 0, err
+	}
+	row, ok := findRow(table, tipo)
+	if !ok {
+		return "", 0, fmt.Errorf("%w: %s", ErrTypeNotFound, tipo)
+	}
+	first, _, err := m.nextRange(table, row, ncfTipo, cta, part, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return ncfTipo.Format(first), first, nil
+}
+
+// Adjust deja el contador de tipo/cta en numero, el último número emitido,
+// por ejemplo para continuar la numeración de otro sistema. No se permite
+// bajarlo de lo que ya se emitió. Como en GetSequences, pasa por el journal y
+// sube la marca de emisión, que se guarda enseguida: si después se restaura
+// una copia anterior del DBF, el retroceso se detecta.
+func (m *Manager) Adjust(tipo string, cta string, numero int64) error {
+	cta = strings.ToUpper(cta)
+	fieldName, err := ctaField(cta)
+	if err != nil {
+		return err
+	}
+	if numero < 0 {
+		return fmt.Errorf("número inválido: %d", numero)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.suspended {
+		return ErrSuspended
+	}
+	if emitido := m.marks[tipo+"/"+cta]; numero < emitido {
+		return fmt.Errorf("%w: %s CTA %s no puede quedar en %d porque ya se emitió hasta %d",
+			ErrCounterRollback, tipo, cta, numero, emitido)
+	}
+	if width, ok := m.widths[fieldName]; ok && numero > maxForWidth(width) {
+		return fmt.Errorf("%w: %d no cabe en %s N(%d)", ErrFieldOverflow, numero, fieldName, width)
+	}
+
+	table, err := m.cachedTable()
+	if err != nil {
+		return err
+	}
+	row, ok := findRow(table, tipo)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTypeNotFound, tipo)
+	}
+	lock, err := m.lockForWrite(row)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	if table, err = m.lockedTable(lock, row); err != nil {
+		return err
+	}
+	m.maybeSnapshot()
+	actual, _ := table.Int64FieldValueByName(row, fieldName)
+	var id int64
+	if m.journal != nil {
+		if id, err = m.journal.intent(tipo, fieldName, numero); err != nil {
+			return err
+		}
+	}
+	if err := m.writeRecordField(table, row, fieldName, strconv.FormatInt(numero, 10)); err != nil {
+		return err
+	}
+	m.raiseMark(tipo, cta, numero)
+	if m.journal != nil {
+		if err := m.commitJournal(id); err != nil {
+			m.Log(fmt.Sprintf("Error confirmando en el journal: %v", err))
+		}
+	}
+	m.Log(fmt.Sprintf("%s CTA %s ajustado de %d a %d", tipo, cta, actual, numero))
+	if err := m.saveHighWater(); err != nil {
+		return fmt.Errorf("contador ajustado, pero no se guardó la marca: %w", err)
+	}
+	return nil
+}
+
+// findRow devuelve el registro (base 0) cuyo NUMERO empieza con tipo
+func findRow(table *godbf.DbfTable, tipo string) (int, bool) {
+	for i := 0; i < table.NumberOfRecords(); i++ {
 		if table.RowIsDeleted(i) {
 			continue
 		}
@@ -172,30 +541,34 @@ func (m *Manager) GetSequence(tipo string, cta string) (string, int64, error) {
 		if err != nil {
 			continue
 		}
-		numeroStr = strings.TrimSpace(numeroStr)
-
-		if strings.HasPrefix(numeroStr, tipo) {
-			seqVal, _ := table.Int64FieldValueByName(i, fieldName)
-			newSeqVal = seqVal + 1
-
-			err := table.SetFieldValueByName(i, fieldName, strconv.FormatInt(newSeqVal, 10))
-			if err != nil {
-				return "", 0, fmt.Errorf("error setFieldValue: %v", err)
-			}
-			found = true
-			break
+		if strings.HasPrefix(strings.TrimSpace(numeroStr), tipo) {
+			return i, true
 		}
 	}
+	return 0, false
+}
 
-	if !found {
-		return "", 0, fmt.Errorf("tipo de comprobante no encontrado: %s", tipo)
+// CheckAuthorization valida que numero no supere cantSecuen (CANTSECUEN) y
+// que fecDoc (FEC_DOC, AAAAMMDD) no haya pasado. Un CANTSECUEN en cero o un
+// FEC_DOC vacío se consideran sin límite.
+func CheckAuthorization(tipo, fecDoc string, cantSecuen, numero int64) error {
+	if vence, ok := parseFecha(fecDoc); ok {
+		// La autorización es válida hasta el final del día de vencimiento
+		if !time.Now().Before(vence.AddDate(0, 0, 1)) {
+			return fmt.Errorf("%w: %s venció el %s", ErrAuthorizationExpired, tipo, vence.Format("2006-01-02"))
+		}
 	}
-
-	if err := godbf.SaveToFile(table, m.dbfPath); err != nil {
-		return "", 0, fmt.Errorf("error guardando DBF: %v", err)
+	if cantSecuen > 0 && numero > cantSecuen {
+		return fmt.Errorf("%w: %s llegaría a %d y el máximo autorizado es %d", ErrRangeExhausted, tipo, numero, cantSecuen)
 	}
+	return nil
+}
 
-	sequence := fmt.Sprintf("%s%010d", tipo, newSeqVal)
-	m.Log(fmt.Sprintf("Generated sequence: %s", sequence))
-	return sequence, newSeqVal, nil
+// parseFecha interpreta un campo fecha DBF (AAAAMMDD) en hora local
+func parseFecha(s string) (time.Time, bool) {
+	t, err := time.ParseInLocation("20060102", strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
 }
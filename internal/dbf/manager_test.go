@@ -1,6 +1,7 @@
 package dbf_test
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/ncf"
 )
 
 // TestNewManager prueba la creación de un Manager con distintos escenarios
@@ -94,10 +96,14 @@ func TestManager_GetRecordTypes(t *testing.T) {
 
 // TestManager_GetSequence prueba la obtención de una secuencia para diferentes escenarios
 func TestManager_GetSequence(t *testing.T) {
-	currentDir, _ := os.Getwd()
-	realDBFPath := path.Join(currentDir, "FAC_PF_M.DBF")
+	// Se trabaja sobre una copia para no alterar los contadores del DBF de prueba
+	realDBFPath := copyFixture(t)
 
-	mgr, err := dbf.NewManager(realDBFPath)
+	// B03 necesita particiones para poder emitir por CTA B
+	mgr, err := dbf.NewManager(realDBFPath, dbf.WithPartitions([]dbf.Partition{
+		{Tipo: "B03", CTA: "A", Desde: 1, Hasta: 5000},
+		{Tipo: "B03", CTA: "B", Desde: 5001, Hasta: 10000},
+	}))
 	if err != nil {
 		t.Fatalf("Error creando Manager: %v", err)
 	}
@@ -111,11 +117,11 @@ func TestManager_GetSequence(t *testing.T) {
 		wantStart string // Prefijo esperado de la secuencia
 	}{
 		{
-			name:      "tipo existente (p.ej. E31), CTA A",
-			tipo:      "E31",
+			name:      "tipo existente (p.ej. E34), CTA A",
+			tipo:      "E34",
 			cta:       "A",
 			wantErr:   false,
-			wantStart: "E31",
+			wantStart: "E34",
 		},
 		{
 			name:      "tipo existente (p.ej. B03), CTA A",
@@ -171,6 +177,11 @@ func TestManager_GetSequence(t *testing.T) {
 				}
 			}
 
+			// B03 lleva 8 dígitos (11 caracteres) y los e-NCF 10 (13 caracteres)
+			if !ncf.Valid(seq) {
+				t.Errorf("GetSequence() = %s no tiene el formato de su serie", seq)
+			}
+
 			// Validar que seqNum sea > 0 (si se incrementó con éxito)
 			if seqNum <= 0 {
 				t.Errorf("El número de secuencia devuelto debe ser > 0, se obtuvo %d", seqNum)
@@ -190,10 +201,59 @@ func TestManager_GetSequence(t *testing.T) {
 	}
 }
 
+// TestManager_GetSequenceLimits verifica que no se asignen números fuera de lo
+// autorizado por la DGII y que el error devuelto permita distinguir la causa
+func TestManager_GetSequenceLimits(t *testing.T) {
+	// Se trabaja sobre una copia para no alterar los contadores del DBF de prueba
+	realDBFPath := copyFixture(t)
+
+	mgr, err := dbf.NewManager(realDBFPath)
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+
+	// En el DBF de prueba E31 ya superó CANTSECUEN (150) y B12 venció en 2019
+	tests := []struct {
+		name    string
+		tipo    string
+		wantErr error
+	}{
+		{name: "rango agotado", tipo: "E31", wantErr: dbf.ErrRangeExhausted},
+		{name: "autorización vencida", tipo: "B12", wantErr: dbf.ErrAuthorizationExpired},
+		{name: "tipo inexistente", tipo: "E33", wantErr: dbf.ErrTypeNotFound},
+		{name: "tipo fuera del catálogo", tipo: "XXX", wantErr: ncf.ErrUnknownType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := mgr.GetRecordTypes()
+			if err != nil {
+				t.Fatalf("GetRecordTypes() error = %v", err)
+			}
+
+			_, _, err = mgr.GetSequence(tt.tipo, "A")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetSequence() error = %v, se esperaba %v", err, tt.wantErr)
+			}
+
+			// El contador no debe moverse cuando se rechaza la asignación
+			after, err := mgr.GetRecordTypes()
+			if err != nil {
+				t.Fatalf("GetRecordTypes() error = %v", err)
+			}
+			for i := range before {
+				if before[i].Numero1 != after[i].Numero1 {
+					t.Errorf("El contador de %s cambió de %d a %d", before[i].NCFTipo, before[i].Numero1, after[i].Numero1)
+				}
+			}
+		})
+	}
+}
+
 // TestConcurrency prueba el acceso concurrente a GetSequence
 func TestConcurrency(t *testing.T) {
-	currentDir, _ := os.Getwd()
-	realDBFPath := path.Join(currentDir, "FAC_PF_M.DBF")
+	// Se trabaja sobre una copia para no alterar los contadores del DBF de prueba
+	realDBFPath := copyFixture(t)
 
 	mgr, err := dbf.NewManager(realDBFPath)
 	if err != nil {
@@ -260,3 +320,68 @@ func TestConcurrency(t *testing.T) {
 		}
 	}
 }
+
+func TestManager_PeekAndAdjust(t *testing.T) {
+	mgr := mustManager(t, copyFixture(t))
+	defer mgr.Close()
+
+	// E34 arranca en 0: Peek muestra el 1 sin tocar el contador
+	seq, num, err := mgr.Peek("E34", "A")
+	if err != nil || seq != "E340000000001" || num != 1 {
+		t.Fatalf("Peek() = %q, %d, %v", seq, num, err)
+	}
+	if got := numero1(t, mgr, "E34"); got != 0 {
+		t.Errorf("Peek() cambió el contador a %d", got)
+	}
+	if got, _, err := mgr.GetSequence("E34", "A"); err != nil || got != seq {
+		t.Errorf("GetSequence() = %q, %v; Peek() había dado %q", got, err, seq)
+	}
+
+	if err := mgr.Adjust("E34", "a", 100); err != nil {
+		t.Fatalf("Adjust() error = %v", err)
+	}
+	if got := numero1(t, mgr, "E34"); got != 100 {
+		t.Errorf("NUMERO_1 = %d después de Adjust(100)", got)
+	}
+	if _, num, _ := mgr.Peek("E34", "A"); num != 101 {
+		t.Errorf("Peek() = %d después de Adjust(100)", num)
+	}
+
+	// El 1 ya se emitió: no se puede volver a 0
+	if err := mgr.Adjust("E34", "A", 0); !errors.Is(err, dbf.ErrCounterRollback) {
+		t.Errorf("Adjust(0) error = %v, se esperaba ErrCounterRollback", err)
+	}
+	if err := mgr.Adjust("E34", "C", 5); !errors.Is(err, dbf.ErrInvalidCTA) {
+		t.Errorf("Adjust(CTA C) error = %v, se esperaba ErrInvalidCTA", err)
+	}
+	if _, _, err := mgr.Peek("E99", "A"); err == nil {
+		t.Error("Peek() aceptó un tipo inexistente")
+	}
+}
+
+func TestManager_AdjustRaisesMark(t *testing.T) {
+	path := copyFixture(t)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := mustManager(t, path)
+	if err := mgr.Adjust("E34", "A", 100); err != nil {
+		t.Fatalf("Adjust() error = %v", err)
+	}
+	mgr.Close()
+
+	// Restaurar la copia anterior al ajuste deja el contador por debajo
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mgr = mustManager(t, path)
+	defer mgr.Close()
+	rollbacks, err := mgr.Rollbacks()
+	if err != nil {
+		t.Fatalf("Rollbacks() error = %v", err)
+	}
+	if len(rollbacks) != 1 || rollbacks[0].Tipo != "E34" || rollbacks[0].Emitido != 100 {
+		t.Errorf("Rollbacks() = %+v, se esperaba E34 CTA A emitido hasta 100", rollbacks)
+	}
+}
@@ -0,0 +1,170 @@
+// internal/dbf/migrate.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxNumericWidth es el ancho máximo de un campo N en dBase/FoxPro
+const maxNumericWidth = 20
+
+// WidenNumericFields amplía a width dígitos los campos numéricos indicados
+// (normalmente NUMERO_1 y NUMERO_2) conservando todos los registros, su orden
+// y las marcas de borrado. Antes de reemplazar el archivo se verifica que cada
+// valor se lea igual que antes y se deja una copia del original; devuelve la
+// ruta de esa copia y los campos que se ampliaron. Los campos que ya tienen el
+// ancho pedido se dejan como están.
+//
+// El servicio tiene que estar detenido: el Manager lee los anchos al arrancar.
+// Como no se reordenan registros, el CDX sigue apuntando a los mismos números
+// de registro.
+func WidenNumericFields(path string, width int, names ...string) (backup string, widened []string, err error) {
+	if width < 1 || width > maxNumericWidth {
+		return "", nil, fmt.Errorf("ancho inválido: %d (máximo %d)", width, maxNumericWidth)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error leyendo DBF: %v", err)
+	}
+	h, err := parseHeader(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	newLen := make([]int, len(h.Fields))
+	for i, f := range h.Fields {
+		newLen[i] = f.Length
+	}
+	for _, name := range names {
+		i := fieldIndex(h, name)
+		if i < 0 {
+			return "", nil, fmt.Errorf("el campo %s no existe en el DBF", name)
+		}
+		f := h.Fields[i]
+		if f.Type != 'N' && f.Type != 'F' {
+			return "", nil, fmt.Errorf("el campo %s es de tipo %c, solo se amplían campos numéricos", name, f.Type)
+		}
+		if f.Length >= width {
+			continue
+		}
+		newLen[i] = width
+		widened = append(widened, name)
+	}
+	if len(widened) == 0 {
+		return "", nil, nil
+	}
+
+	end := h.HeaderLen + h.NumRecords*h.RecordLen
+	if len(data) < end {
+		return "", nil, fmt.Errorf("el DBF está truncado: %d registros declarados y %d bytes", h.NumRecords, len(data))
+	}
+
+	out := migrateBytes(data, h, newLen)
+	if err := verifyMigration(data, h, out); err != nil {
+		return "", nil, fmt.Errorf("verificación de la migración falló, no se modificó el DBF: %v", err)
+	}
+
+	// Copia del original y reemplazo atómico
+	backup = fmt.Sprintf("%s.bak-%s", path, time.Now().Format("20060102150405"))
+	if err := os.WriteFile(backup, data, 0644); err != nil {
+		return "", nil, fmt.Errorf("error creando copia de seguridad: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return backup, nil, fmt.Errorf("error creando archivo temporal: %v", err)
+	}
+	_, err = tmp.Write(out)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return backup, nil, fmt.Errorf("error escribiendo DBF migrado: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return backup, nil, fmt.Errorf("error reemplazando DBF: %v", err)
+	}
+	return backup, widened, nil
+}
+
+// migrateBytes arma el archivo con los nuevos anchos. Los valores numéricos
+// van alineados a la derecha, así que se rellenan con espacios a la izquierda.
+func migrateBytes(data []byte, h *dbfHeader, newLen []int) []byte {
+	header := append([]byte(nil), data[:h.HeaderLen]...)
+
+	// FoxPro guarda el desplazamiento de cada campo; dBase deja ceros
+	storesOffsets := false
+	for i := range h.Fields {
+		if binary.LittleEndian.Uint32(header[32+32*i+12:]) != 0 {
+			storesOffsets = true
+		}
+	}
+
+	offset := 1
+	for i := range h.Fields {
+		d := header[32+32*i : 32+32*i+32]
+		d[16] = byte(newLen[i])
+		if storesOffsets {
+			binary.LittleEndian.PutUint32(d[12:16], uint32(offset))
+		}
+		offset += newLen[i]
+	}
+	recordLen := offset
+	binary.LittleEndian.PutUint16(header[10:12], uint16(recordLen))
+	now := time.Now()
+	header[1], header[2], header[3] = byte(now.Year()-1900), byte(now.Month()), byte(now.Day())
+
+	var buf bytes.Buffer
+	buf.Grow(h.HeaderLen + h.NumRecords*recordLen + 1)
+	buf.Write(header)
+	for r := 0; r < h.NumRecords; r++ {
+		rec := data[h.HeaderLen+r*h.RecordLen : h.HeaderLen+(r+1)*h.RecordLen]
+		buf.WriteByte(rec[0])
+		for i, f := range h.Fields {
+			value := rec[f.Offset : f.Offset+f.Length]
+			buf.Write(bytes.Repeat([]byte{' '}, newLen[i]-f.Length))
+			buf.Write(value)
+		}
+	}
+	// Lo que venga después de los registros (marca de fin 0x1A) se conserva
+	buf.Write(data[h.HeaderLen+h.NumRecords*h.RecordLen:])
+	return buf.Bytes()
+}
+
+// verifyMigration compara registro por registro el archivo original con el
+// migrado: misma marca de borrado y mismo valor (sin espacios) en cada campo.
+func verifyMigration(orig []byte, oh *dbfHeader, migrated []byte) error {
+	nh, err := parseHeader(migrated)
+	if err != nil {
+		return err
+	}
+	if nh.NumRecords != oh.NumRecords || len(nh.Fields) != len(oh.Fields) {
+		return fmt.Errorf("la estructura migrada no coincide")
+	}
+	for r := 0; r < oh.NumRecords; r++ {
+		o := orig[oh.HeaderLen+r*oh.RecordLen:]
+		n := migrated[nh.HeaderLen+r*nh.RecordLen:]
+		if o[0] != n[0] {
+			return fmt.Errorf("registro %d: cambió la marca de borrado", r+1)
+		}
+		for i, of := range oh.Fields {
+			nf := nh.Fields[i]
+			ov := bytes.TrimSpace(o[of.Offset : of.Offset+of.Length])
+			nv := bytes.TrimSpace(n[nf.Offset : nf.Offset+nf.Length])
+			if !bytes.Equal(ov, nv) {
+				return fmt.Errorf("registro %d, campo %s: %q pasó a %q", r+1, of.Name, ov, nv)
+			}
+		}
+	}
+	return nil
+}
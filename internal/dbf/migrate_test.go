@@ -0,0 +1,132 @@
+package dbf_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// Estructura del DBF de prueba: encabezado de 353 bytes y registros de 116
+const (
+	fixtureHeaderLen = 353
+	fixtureRecordLen = 116
+)
+
+func TestWidenNumericFields(t *testing.T) {
+	path := copyFixture(t)
+
+	// Marcar el último registro como borrado para comprobar que se conserva
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[fixtureHeaderLen+8*fixtureRecordLen] = '*'
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := mustManager(t, path)
+	before, err := mgr.GetRecordTypes()
+	if err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	mgr.Close()
+
+	backup, widened, err := dbf.WidenNumericFields(path, 10, "NUMERO_1", "NUMERO_2")
+	if err != nil {
+		t.Fatalf("WidenNumericFields() error = %v", err)
+	}
+	if !reflect.DeepEqual(widened, []string{"NUMERO_1", "NUMERO_2"}) {
+		t.Errorf("campos ampliados = %v", widened)
+	}
+	if saved, _ := os.ReadFile(backup); !bytes.Equal(saved, data) {
+		t.Error("la copia de seguridad no coincide con el DBF original")
+	}
+
+	mgr = mustManager(t, path)
+	if w := mgr.FieldWidth("NUMERO_1"); w != 10 {
+		t.Errorf("FieldWidth(NUMERO_1) = %d, se esperaba 10", w)
+	}
+	after, err := mgr.GetRecordTypes()
+	if err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("los registros cambiaron:\nantes   %+v\ndespués %+v", before, after)
+	}
+
+	migrated, _ := os.ReadFile(path)
+	if migrated[fixtureHeaderLen+8*(fixtureRecordLen+4)] != '*' {
+		t.Error("se perdió la marca de borrado del último registro")
+	}
+
+	// Volver a correrla no cambia nada
+	if _, widened, err := dbf.WidenNumericFields(path, 10, "NUMERO_1", "NUMERO_2"); err != nil || len(widened) != 0 {
+		t.Errorf("segunda migración: ampliados %v, error %v", widened, err)
+	}
+
+	// El DBF migrado se sigue pudiendo usar para asignar
+	seq, num, err := mgr.GetSequence("E34", "A")
+	if err != nil || seq != "E340000000001" {
+		t.Errorf("GetSequence() = %s, %v", seq, err)
+	}
+	tipos, _ := mgr.GetRecordTypes()
+	for _, tipo := range tipos {
+		if tipo.NCFTipo == "E34" && tipo.Numero1 != num {
+			t.Errorf("NUMERO_1 de E34 = %d, se esperaba %d", tipo.Numero1, num)
+		}
+	}
+}
+
+func TestWidenNumericFields_Invalid(t *testing.T) {
+	path := copyFixture(t)
+	if _, _, err := dbf.WidenNumericFields(path, 10, "NOMBRE"); err == nil {
+		t.Error("se esperaba error al ampliar un campo de caracteres")
+	}
+	if _, _, err := dbf.WidenNumericFields(path, 10, "NO_EXISTE"); err == nil {
+		t.Error("se esperaba error con un campo inexistente")
+	}
+	if _, _, err := dbf.WidenNumericFields(path, 21, "NUMERO_1"); err == nil {
+		t.Error("se esperaba error con un ancho mayor a 20")
+	}
+}
+
+func TestManager_FieldOverflow(t *testing.T) {
+	path := copyFixture(t)
+
+	// NUMERO_1 es N(8): 100000000 ya no cabe
+	mgr, err := dbf.NewManager(path, dbf.WithPartitions([]dbf.Partition{
+		{Tipo: "E34", CTA: "A", Desde: 100000000, Hasta: 199999999},
+	}))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if w := mgr.FieldWidth("NUMERO_1"); w != 8 {
+		t.Fatalf("FieldWidth(NUMERO_1) = %d, se esperaba 8", w)
+	}
+
+	_, _, err = mgr.GetSequence("E34", "A")
+	if !errors.Is(err, dbf.ErrFieldOverflow) {
+		t.Fatalf("GetSequence() error = %v, se esperaba ErrFieldOverflow", err)
+	}
+
+	tipos, _ := mgr.GetRecordTypes()
+	for _, tipo := range tipos {
+		if tipo.NCFTipo == "E34" && tipo.Numero1 != 0 {
+			t.Errorf("el contador de E34 cambió a %d", tipo.Numero1)
+		}
+	}
+}
+
+func mustManager(t *testing.T, path string, opts ...dbf.Option) *dbf.Manager {
+	t.Helper()
+	mgr, err := dbf.NewManager(path, opts...)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	return mgr
+}
@@ -0,0 +1,190 @@
+// internal/dbf/partitions.go
+package dbf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Partition delimita el sub-rango de números que puede emitir una cuenta (CTA)
+// de un tipo de comprobante. Como el NCF no incluye la cuenta, A y B deben
+// trabajar sobre rangos que no se solapen para no emitir el mismo número.
+type Partition struct {
+	Tipo  string `json:"tipo"`
+	CTA   string `json:"cta"`
+	Desde int64  `json:"desde"`
+	Hasta int64  `json:"hasta"`
+}
+
+// Collision describe un tramo de números que ambas cuentas ya emitieron (o
+// que una cuenta emitió dentro de la partición de la otra).
+type Collision struct {
+	Tipo    string `json:"tipo"`
+	Desde   int64  `json:"desde"`
+	Hasta   int64  `json:"hasta"`
+	Detalle string `json:"detalle"`
+}
+
+// LoadPartitions lee un archivo JSON con la lista de particiones, por ejemplo:
+//
+//	[{"tipo":"E32","cta":"A","desde":1,"hasta":500000},
+//	 {"tipo":"E32","cta":"B","desde":500001,"hasta":1000000}]
+func LoadPartitions(path string) ([]Partition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo particiones: %v", err)
+	}
+	var parts []Partition
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return nil, fmt.Errorf("error interpretando particiones %s: %v", path, err)
+	}
+	return parts, nil
+}
+
+// ValidatePartitions revisa que cada partición esté bien formada y que dos
+// particiones del mismo tipo no se solapen.
+func ValidatePartitions(parts []Partition) error {
+	seen := make(map[string]bool)
+	byTipo := make(map[string][]Partition)
+	for _, p := range parts {
+		p.Tipo = strings.ToUpper(strings.TrimSpace(p.Tipo))
+		p.CTA = strings.ToUpper(strings.TrimSpace(p.CTA))
+		if p.CTA != "A" && p.CTA != "B" {
+			return fmt.Errorf("%w: partición %s/%s", ErrInvalidCTA, p.Tipo, p.CTA)
+		}
+		if p.Desde < 1 || p.Hasta < p.Desde {
+			return fmt.Errorf("partición %s/%s inválida: desde=%d hasta=%d", p.Tipo, p.CTA, p.Desde, p.Hasta)
+		}
+		key := p.Tipo + "/" + p.CTA
+		if seen[key] {
+			return fmt.Errorf("partición %s duplicada", key)
+		}
+		seen[key] = true
+		byTipo[p.Tipo] = append(byTipo[p.Tipo], p)
+	}
+
+	for tipo, list := range byTipo {
+		sort.Slice(list, func(i, j int) bool { return list[i].Desde < list[j].Desde })
+		for i := 1; i < len(list); i++ {
+			if list[i].Desde <= list[i-1].Hasta {
+				return fmt.Errorf("%w: %s CTA %s [%d-%d] y CTA %s [%d-%d]", ErrPartitionOverlap, tipo,
+					list[i-1].CTA, list[i-1].Desde, list[i-1].Hasta, list[i].CTA, list[i].Desde, list[i].Hasta)
+			}
+		}
+	}
+	return nil
+}
+
+// Partitions indexa las particiones por tipo y CTA ("TIPO/CTA")
+type Partitions map[string]Partition
+
+// NewPartitions valida parts (ver ValidatePartitions) y las indexa
+func NewPartitions(parts []Partition) (Partitions, error) {
+	if err := ValidatePartitions(parts); err != nil {
+		return nil, err
+	}
+	ps := make(Partitions)
+	for _, p := range parts {
+		p.Tipo = strings.ToUpper(strings.TrimSpace(p.Tipo))
+		p.CTA = strings.ToUpper(strings.TrimSpace(p.CTA))
+		ps[p.Tipo+"/"+p.CTA] = p
+	}
+	return ps, nil
+}
+
+// For devuelve la partición configurada para tipo/cta. Si el tipo no tiene
+// particiones, la cuenta A conserva el rango completo y la B queda
+// bloqueada, porque sin partición sus números chocarían con los de A.
+func (ps Partitions) For(tipo, cta string) (Partition, error) {
+	tipo = strings.ToUpper(tipo)
+	if p, ok := ps[tipo+"/"+cta]; ok {
+		return p, nil
+	}
+	if cta == "A" && !ps.has(tipo) {
+		return Partition{Tipo: tipo, CTA: cta, Desde: 1}, nil
+	}
+	return Partition{}, fmt.Errorf("%w: %s CTA %s", ErrCTANotPartitioned, tipo, cta)
+}
+
+func (ps Partitions) has(tipo string) bool {
+	_, a := ps[tipo+"/A"]
+	_, b := ps[tipo+"/B"]
+	return a || b
+}
+
+// partitionFor aplica Partitions.For con las particiones del Manager
+func (m *Manager) partitionFor(tipo, cta string) (Partition, error) {
+	return m.partitions.For(tipo, cta)
+}
+
+// CheckCollisions recorre los contadores actuales y reporta los números que ya
+// se emitieron por ambas cuentas. Un contador que todavía no llegó al inicio de
+// su partición se asume emitido desde 1, como se hacía antes de particionar.
+func (m *Manager) CheckCollisions() ([]Collision, error) {
+	tipos, err := m.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+	return m.partitions.Collisions(tipos), nil
+}
+
+// Collisions hace la revisión de CheckCollisions sobre los contadores de
+// tipos, para cualquier almacén que use estas particiones.
+func (ps Partitions) Collisions(tipos []ComprobanteTipo) []Collision {
+	var collisions []Collision
+	for _, t := range tipos {
+		if t.NCFTipo == "" {
+			continue
+		}
+		usedA := ps.usedRange(t.NCFTipo, "A", t.Numero1)
+		usedB := ps.usedRange(t.NCFTipo, "B", t.Numero2)
+
+		if c, ok := overlap(t.NCFTipo, usedA, usedB); ok {
+			c.Detalle = "números emitidos por CTA A y CTA B"
+			collisions = append(collisions, c)
+		}
+
+		// Números ya emitidos que caen dentro de la partición de la otra cuenta
+		for _, pair := range []struct {
+			cta   string
+			used  [2]int64
+			other string
+		}{{"A", usedA, "B"}, {"B", usedB, "A"}} {
+			p, ok := ps[t.NCFTipo+"/"+pair.other]
+			if !ok {
+				continue
+			}
+			if c, ok := overlap(t.NCFTipo, pair.used, [2]int64{p.Desde, p.Hasta}); ok {
+				c.Detalle = fmt.Sprintf("CTA %s ya emitió números de la partición de CTA %s", pair.cta, pair.other)
+				collisions = append(collisions, c)
+			}
+		}
+	}
+	return collisions
+}
+
+// usedRange estima el tramo [desde, hasta] ya emitido por una cuenta
+func (ps Partitions) usedRange(tipo, cta string, counter int64) [2]int64 {
+	if counter <= 0 {
+		return [2]int64{0, 0}
+	}
+	if p, ok := ps[tipo+"/"+cta]; ok && counter >= p.Desde {
+		return [2]int64{p.Desde, counter}
+	}
+	return [2]int64{1, counter}
+}
+
+func overlap(tipo string, a, b [2]int64) (Collision, bool) {
+	if a[1] == 0 || b[1] == 0 {
+		return Collision{}, false
+	}
+	desde := max(a[0], b[0])
+	hasta := min(a[1], b[1])
+	if desde > hasta {
+		return Collision{}, false
+	}
+	return Collision{Tipo: tipo, Desde: desde, Hasta: hasta}, true
+}
@@ -0,0 +1,165 @@
+package dbf_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// copyFixture copia el DBF de prueba a un directorio temporal para que el test
+// pueda modificar contadores sin afectar a los demás
+func copyFixture(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"FAC_PF_M.DBF", "FAC_PF_M.CDX"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Error leyendo %s de prueba: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Error copiando %s de prueba: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "FAC_PF_M.DBF")
+}
+
+func TestValidatePartitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   []dbf.Partition
+		wantErr error
+	}{
+		{
+			name: "particiones separadas",
+			parts: []dbf.Partition{
+				{Tipo: "E32", CTA: "A", Desde: 1, Hasta: 100},
+				{Tipo: "E32", CTA: "B", Desde: 101, Hasta: 200},
+			},
+		},
+		{
+			name: "particiones solapadas",
+			parts: []dbf.Partition{
+				{Tipo: "E32", CTA: "A", Desde: 1, Hasta: 100},
+				{Tipo: "E32", CTA: "B", Desde: 100, Hasta: 200},
+			},
+			wantErr: dbf.ErrPartitionOverlap,
+		},
+		{
+			name: "CTA inválida",
+			parts: []dbf.Partition{
+				{Tipo: "E32", CTA: "C", Desde: 1, Hasta: 100},
+			},
+			wantErr: dbf.ErrInvalidCTA,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dbf.ValidatePartitions(tt.parts)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("ValidatePartitions() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidatePartitions() error = %v, se esperaba %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// El Manager no debe arrancar con particiones solapadas
+	_, err := dbf.NewManager(copyFixture(t), dbf.WithPartitions(tests[1].parts))
+	if !errors.Is(err, dbf.ErrPartitionOverlap) {
+		t.Errorf("NewManager() error = %v, se esperaba %v", err, dbf.ErrPartitionOverlap)
+	}
+}
+
+func TestLoadPartitions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "particiones.json")
+	content := `[{"tipo":"E32","cta":"A","desde":1,"hasta":10},{"tipo":"E32","cta":"B","desde":11,"hasta":20}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := dbf.LoadPartitions(path)
+	if err != nil {
+		t.Fatalf("LoadPartitions() error = %v", err)
+	}
+	if len(parts) != 2 || parts[1].Desde != 11 || parts[1].CTA != "B" {
+		t.Errorf("LoadPartitions() = %+v", parts)
+	}
+}
+
+func TestManager_GetSequencePartitions(t *testing.T) {
+	mgr, err := dbf.NewManager(copyFixture(t), dbf.WithPartitions([]dbf.Partition{
+		{Tipo: "E34", CTA: "A", Desde: 1, Hasta: 2},
+		{Tipo: "E34", CTA: "B", Desde: 501, Hasta: 1000},
+	}))
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+
+	// CTA B arranca en el inicio de su partición, no en 1
+	seq, num, err := mgr.GetSequence("E34", "B")
+	if err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+	if num != 501 || seq != "E340000000501" {
+		t.Errorf("GetSequence() = %s (%d), se esperaba E340000000501", seq, num)
+	}
+
+	// CTA A se agota al final de su partición aunque quede rango autorizado
+	for i := 0; i < 2; i++ {
+		if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+			t.Fatalf("GetSequence() error = %v", err)
+		}
+	}
+	if _, _, err := mgr.GetSequence("E34", "A"); !errors.Is(err, dbf.ErrRangeExhausted) {
+		t.Errorf("GetSequence() error = %v, se esperaba %v", err, dbf.ErrRangeExhausted)
+	}
+
+	// Un tipo sin particiones no permite emitir por CTA B
+	if _, _, err := mgr.GetSequence("E32", "B"); !errors.Is(err, dbf.ErrCTANotPartitioned) {
+		t.Errorf("GetSequence() error = %v, se esperaba %v", err, dbf.ErrCTANotPartitioned)
+	}
+}
+
+func TestManager_CTABWithoutPartitionFile(t *testing.T) {
+	// Sin archivo de particiones CTA B no tiene rango propio: sus números
+	// repetirían los de A
+	mgr, err := dbf.NewManager(copyFixture(t))
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+	if _, _, err := mgr.GetSequence("E32", "B"); !errors.Is(err, dbf.ErrCTANotPartitioned) {
+		t.Errorf("GetSequence() error = %v, se esperaba %v", err, dbf.ErrCTANotPartitioned)
+	}
+	if _, _, err := mgr.GetSequence("E32", "A"); err != nil {
+		t.Errorf("GetSequence(A) error = %v", err)
+	}
+}
+
+func TestManager_CheckCollisions(t *testing.T) {
+	// En el DBF de prueba B03 tiene NUMERO_1=10 y NUMERO_2=2: ambas cuentas
+	// emitieron B0300000001 y B0300000002
+	mgr, err := dbf.NewManager(copyFixture(t))
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+
+	collisions, err := mgr.CheckCollisions()
+	if err != nil {
+		t.Fatalf("CheckCollisions() error = %v", err)
+	}
+
+	var found bool
+	for _, c := range collisions {
+		if c.Tipo == "B03" && c.Desde == 1 && c.Hasta == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("CheckCollisions() = %+v, se esperaba la colisión B03 [1-2]", collisions)
+	}
+}
@@ -0,0 +1,119 @@
+// internal/dbf/schema.go
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// fieldDesc es un descriptor de campo tal como está en el encabezado del DBF
+type fieldDesc struct {
+	Name     string
+	Type     byte
+	Offset   int // desplazamiento dentro del registro (incluye el byte de borrado)
+	Length   int
+	Decimals int
+}
+
+// dbfHeader es el encabezado del DBF leído directamente del archivo. godbf no
+// expone el ancho declarado de los campos ni permite cambiarlo, por eso se
+// interpreta a mano.
+type dbfHeader struct {
+	Version    byte
+	Updated    time.Time
+	NumRecords int
+	HeaderLen  int
+	RecordLen  int
+	Flags      byte // 0x01 = tiene CDX estructural
+	LangDriver byte
+	Fields     []fieldDesc
+}
+
+// field devuelve el descriptor del campo name
+func (h *dbfHeader) field(name string) (fieldDesc, bool) {
+	if i := fieldIndex(h, name); i >= 0 {
+		return h.Fields[i], true
+	}
+	return fieldDesc{}, false
+}
+
+func fieldIndex(h *dbfHeader, name string) int {
+	for i, f := range h.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseHeader interpreta el encabezado a partir de los primeros HeaderLen bytes
+func parseHeader(data []byte) (*dbfHeader, error) {
+	if len(data) < 32 {
+		return nil, fmt.Errorf("encabezado DBF incompleto")
+	}
+	h := &dbfHeader{
+		Version:    data[0],
+		Updated:    time.Date(1900+int(data[1]), time.Month(data[2]), int(data[3]), 0, 0, 0, 0, time.Local),
+		NumRecords: int(binary.LittleEndian.Uint32(data[4:8])),
+		HeaderLen:  int(binary.LittleEndian.Uint16(data[8:10])),
+		RecordLen:  int(binary.LittleEndian.Uint16(data[10:12])),
+		Flags:      data[28],
+		LangDriver: data[29],
+	}
+	if len(data) < h.HeaderLen {
+		return nil, fmt.Errorf("encabezado DBF incompleto: %d de %d bytes", len(data), h.HeaderLen)
+	}
+
+	offset := 1 // el primer byte de cada registro es la marca de borrado
+	for pos := 32; pos+32 <= h.HeaderLen && data[pos] != 0x0D; pos += 32 {
+		d := data[pos : pos+32]
+		f := fieldDesc{
+			Name:     strings.TrimRight(string(bytes.TrimRight(d[0:11], "\x00")), " "),
+			Type:     d[11],
+			Offset:   offset,
+			Length:   int(d[16]),
+			Decimals: int(d[17]),
+		}
+		h.Fields = append(h.Fields, f)
+		offset += f.Length
+	}
+	if offset != h.RecordLen {
+		return nil, fmt.Errorf("el largo de registro declarado (%d) no coincide con los campos (%d)", h.RecordLen, offset)
+	}
+	return h, nil
+}
+
+// readHeader lee y valida el encabezado del archivo en path
+func readHeader(path string) (*dbfHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DBF: %v", err)
+	}
+	defer f.Close()
+
+	fixed := make([]byte, 32)
+	if _, err := io.ReadFull(f, fixed); err != nil {
+		return nil, fmt.Errorf("error leyendo encabezado DBF: %v", err)
+	}
+	headerLen := int(binary.LittleEndian.Uint16(fixed[8:10]))
+	data := make([]byte, headerLen)
+	copy(data, fixed)
+	if _, err := io.ReadFull(f, data[32:]); err != nil {
+		return nil, fmt.Errorf("error leyendo encabezado DBF: %v", err)
+	}
+	return parseHeader(data)
+}
+
+// maxForWidth es el mayor entero que cabe en un campo numérico de width bytes
+func maxForWidth(width int) int64 {
+	n := int64(1)
+	for i := 0; i < width && i < 18; i++ {
+		n *= 10
+	}
+	return n - 1
+}
@@ -0,0 +1,386 @@
+// internal/dbf/snapshot.go
+package dbf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	godbf "github.com/LindsayBradford/go-dbf/godbf"
+)
+
+// snapshotTimeFormat va en el nombre de cada respaldo: FAC_PF_M-AAAAMMDD-HHMMSS.DBF
+const snapshotTimeFormat = "20060102-150405"
+
+// SnapshotPolicy define cada cuánto se respalda el DBF y cuánto se guardan
+// los respaldos. Dentro de Horarias se conservan todos; hasta Diarias, el
+// primero de cada día; los más viejos se borran.
+type SnapshotPolicy struct {
+	Intervalo time.Duration `json:"intervalo"` // se respalda antes de la primera escritura de cada intervalo
+	Horarias  time.Duration `json:"horarias"`
+	Diarias   time.Duration `json:"diarias"`
+}
+
+// DefaultSnapshotPolicy respalda cada hora, guarda todos los respaldos de los
+// últimos 2 días y uno por día de los últimos 60.
+var DefaultSnapshotPolicy = SnapshotPolicy{
+	Intervalo: time.Hour,
+	Horarias:  48 * time.Hour,
+	Diarias:   60 * 24 * time.Hour,
+}
+
+// Snapshot es una copia del DBF (y de su CDX, si tiene) tomada antes de
+// modificarlo
+type Snapshot struct {
+	Nombre string    `json:"nombre"`
+	Fecha  time.Time `json:"fecha"`
+	DBF    string    `json:"dbf"`
+	CDX    string    `json:"cdx,omitempty"`
+	Bytes  int64     `json:"bytes"`
+}
+
+// WithSnapshots respalda el DBF en dir antes de la primera escritura de cada
+// intervalo de policy y poda los respaldos viejos.
+func WithSnapshots(dir string, policy SnapshotPolicy) Option {
+	return func(m *Manager) error {
+		if strings.TrimSpace(dir) == "" {
+			return fmt.Errorf("directorio de respaldos vacío")
+		}
+		if policy.Intervalo <= 0 || policy.Horarias < 0 || policy.Diarias < policy.Horarias {
+			return fmt.Errorf("política de respaldos inválida: %+v", policy)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creando directorio de respaldos: %v", err)
+		}
+		m.snapDir, m.snapPolicy = dir, policy
+		return nil
+	}
+}
+
+// ListSnapshots devuelve los respaldos de dbfPath que hay en dir, del más
+// nuevo al más viejo
+func ListSnapshots(dir, dbfPath string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error leyendo respaldos: %v", err)
+	}
+	prefix := strings.TrimSuffix(filepath.Base(dbfPath), ".DBF") + "-"
+	var snaps []Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".DBF") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".DBF")
+		fecha, err := time.ParseInLocation(snapshotTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s := Snapshot{
+			Nombre: strings.TrimSuffix(name, ".DBF"),
+			Fecha:  fecha,
+			DBF:    filepath.Join(dir, name),
+			Bytes:  info.Size(),
+		}
+		if cdx := strings.TrimSuffix(s.DBF, ".DBF") + ".CDX"; fileExists(cdx) {
+			s.CDX = cdx
+		}
+		snaps = append(snaps, s)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Fecha.After(snaps[j].Fecha) })
+	return snaps, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// VerifySnapshot comprueba que el respaldo se pueda leer completo: encabezado,
+// todos los registros y, si tiene, el CDX.
+func VerifySnapshot(s Snapshot) error {
+	h, _, err := readTable(s.DBF)
+	if err != nil {
+		return err
+	}
+	encoding, _ := headerEncoding(h)
+	table, err := godbf.NewFromFile(s.DBF, encoding)
+	if err != nil {
+		return fmt.Errorf("error leyendo respaldo: %v", err)
+	}
+	if table.NumberOfRecords() != h.NumRecords {
+		return fmt.Errorf("el respaldo tiene %d registros y el encabezado declara %d", table.NumberOfRecords(), h.NumRecords)
+	}
+	if s.CDX != "" {
+		if _, err := ReadCDX(s.CDX); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSnapshots elige qué respaldos borrar según policy. snaps va del más
+// nuevo al más viejo.
+func pruneSnapshots(snaps []Snapshot, policy SnapshotPolicy, now time.Time) []Snapshot {
+	var drop []Snapshot
+	firstOfDay := make(map[string]Snapshot)
+	for _, s := range snaps {
+		age := now.Sub(s.Fecha)
+		switch {
+		case age <= policy.Horarias:
+		case age <= policy.Diarias:
+			// Al recorrer de nuevo a viejo, el último que se ve de cada día
+			// es el primero que se tomó ese día
+			day := s.Fecha.Format("20060102")
+			if prev, ok := firstOfDay[day]; ok {
+				drop = append(drop, prev)
+			}
+			firstOfDay[day] = s
+		default:
+			drop = append(drop, s)
+		}
+	}
+	return drop
+}
+
+// Snapshots devuelve los respaldos del DBF, del más nuevo al más viejo
+func (m *Manager) Snapshots() ([]Snapshot, error) {
+	if m.snapDir == "" {
+		return nil, fmt.Errorf("los respaldos automáticos no están habilitados")
+	}
+	return ListSnapshots(m.snapDir, m.dbfPath)
+}
+
+// maybeSnapshot respalda el DBF si todavía no se hizo en este intervalo. Un
+// respaldo fallido se advierte y no impide la escritura. Se llama con m.mu
+// tomado, antes de modificar el DBF.
+func (m *Manager) maybeSnapshot() {
+	if m.snapDir == "" {
+		return
+	}
+	now := time.Now()
+	if !m.lastSnapshot.IsZero() && now.Truncate(m.snapPolicy.Intervalo).Equal(m.lastSnapshot.Truncate(m.snapPolicy.Intervalo)) {
+		return
+	}
+	if _, err := m.takeSnapshot(now); err != nil {
+		m.Log(fmt.Sprintf("ADVERTENCIA: no se pudo respaldar el DBF: %v", err))
+	}
+}
+
+// takeSnapshot copia el DBF y el CDX al directorio de respaldos, verifica la
+// copia y poda los respaldos viejos. Se llama con m.mu tomado.
+func (m *Manager) takeSnapshot(now time.Time) (Snapshot, error) {
+	// Dos respaldos en el mismo segundo (p.ej. el previo a restaurar uno
+	// recién tomado) no pueden pisarse: se corre la fecha al siguiente libre
+	prefix := strings.TrimSuffix(filepath.Base(m.dbfPath), ".DBF") + "-"
+	for fileExists(filepath.Join(m.snapDir, prefix+now.Format(snapshotTimeFormat)+".DBF")) {
+		now = now.Add(time.Second)
+	}
+	base := prefix + now.Format(snapshotTimeFormat)
+	s := Snapshot{Nombre: base, Fecha: now, DBF: filepath.Join(m.snapDir, base+".DBF")}
+
+	data, err := os.ReadFile(m.dbfPath)
+	if err != nil {
+		return s, fmt.Errorf("error leyendo DBF: %v", err)
+	}
+	s.Bytes = int64(len(data))
+	if err := os.WriteFile(s.DBF, data, 0644); err != nil {
+		return s, fmt.Errorf("error escribiendo respaldo: %v", err)
+	}
+	if cdx, err := os.ReadFile(m.cdxPath); err == nil {
+		s.CDX = filepath.Join(m.snapDir, base+".CDX")
+		if err := os.WriteFile(s.CDX, cdx, 0644); err != nil {
+			os.Remove(s.DBF)
+			return s, fmt.Errorf("error escribiendo respaldo del CDX: %v", err)
+		}
+	}
+	if err := VerifySnapshot(s); err != nil {
+		os.Remove(s.DBF)
+		if s.CDX != "" {
+			os.Remove(s.CDX)
+		}
+		return s, fmt.Errorf("el respaldo %s no se pudo verificar: %v", base, err)
+	}
+	m.lastSnapshot = now
+
+	snaps, err := ListSnapshots(m.snapDir, m.dbfPath)
+	if err != nil {
+		return s, err
+	}
+	for _, old := range pruneSnapshots(snaps, m.snapPolicy, now) {
+		os.Remove(old.DBF)
+		if old.CDX != "" {
+			os.Remove(old.CDX)
+		}
+	}
+	return s, nil
+}
+
+// loadSnapshots toma la fecha del último respaldo para no repetirlo si el
+// servicio se reinicia dentro del mismo intervalo
+func (m *Manager) loadSnapshots() error {
+	if m.snapDir == "" {
+		return nil
+	}
+	snaps, err := ListSnapshots(m.snapDir, m.dbfPath)
+	if err != nil {
+		return err
+	}
+	if len(snaps) > 0 {
+		m.lastSnapshot = snaps[0].Fecha
+	}
+	return nil
+}
+
+// RestoreSnapshot reemplaza el DBF (y el CDX) por el respaldo nombre. Antes
+// se respalda el estado actual. Como el respaldo es anterior a números que ya
+// se entregaron, cada contador que quede por debajo de su marca de emisión se
+// adelanta hasta ella: la restauración nunca hace repetir un NCF. Las marcas
+// solo conocen lo que entregó este servicio, así que antes de pisar el DBF se
+// suben a los contadores que tiene en ese momento, que incluyen lo emitido
+// por el ERP. Se niega si algún contador adelantado no cabe en el campo del
+// respaldo. Devuelve los contadores adelantados.
+func (m *Manager) RestoreSnapshot(nombre string) ([]Rollback, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapDir == "" {
+		return nil, fmt.Errorf("los respaldos automáticos no están habilitados")
+	}
+	if m.suspended {
+		return nil, ErrSuspended
+	}
+	if m.journal == nil {
+		return nil, fmt.Errorf("el journal %s lo tiene otro proceso; restaure desde el servicio o deténgalo", m.journalPath)
+	}
+
+	snaps, err := ListSnapshots(m.snapDir, m.dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	var snap *Snapshot
+	for i := range snaps {
+		if snaps[i].Nombre == nombre {
+			snap = &snaps[i]
+		}
+	}
+	if snap == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, nombre)
+	}
+	if err := VerifySnapshot(*snap); err != nil {
+		return nil, fmt.Errorf("el respaldo %s está dañado: %v", nombre, err)
+	}
+	h, err := readHeader(snap.DBF)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.takeSnapshot(time.Now()); err != nil {
+		return nil, fmt.Errorf("no se pudo respaldar el DBF actual antes de restaurar: %v", err)
+	}
+
+	// Se escribe sobre los mismos archivos, no con un rename, porque en
+	// Windows no se puede reemplazar un archivo que FoxPro tiene abierto
+	f, err := os.OpenFile(m.dbfPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo DBF para bloquear: %v", err)
+	}
+	l := &dbfLock{file: f}
+	if err := l.acquire(headerLockOffset, m.lockTimeout, m.lockRetry); err != nil {
+		l.release()
+		return nil, fmt.Errorf("%w: encabezado de %s", err, m.dbfPath)
+	}
+	if err := m.raiseMarksFromDisk(h); err != nil {
+		l.release()
+		return nil, err
+	}
+	err = overwriteFile(m.dbfPath, snap.DBF)
+	if err == nil && snap.CDX != "" {
+		err = overwriteFile(m.cdxPath, snap.CDX)
+	}
+	l.release()
+	m.invalidate()
+	if err != nil {
+		return nil, fmt.Errorf("restauración incompleta, hay un respaldo del estado anterior en %s: %v", m.snapDir, err)
+	}
+	m.Log(fmt.Sprintf("DBF restaurado desde el respaldo %s", nombre))
+
+	// La tabla se relee sin checkRollbacks: estos retrocesos son esperados y
+	// se corrigen ahora, no hace falta alertar
+	stamp, err := statDBF(m.dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	table, err := m.reloadTable(stamp)
+	if err != nil {
+		return nil, err
+	}
+	rollbacks := m.findRollbacks(table)
+	for _, rb := range rollbacks {
+		if err := m.fastForward(rb.Tipo, counterField(rb.CTA), rb.Emitido); err != nil {
+			return nil, fmt.Errorf("adelantando %s CTA %s: %w", rb.Tipo, rb.CTA, err)
+		}
+		m.Log(fmt.Sprintf("%s CTA %s adelantado de %d a %d después de restaurar", rb.Tipo, rb.CTA, rb.Contador, rb.Emitido))
+	}
+	if table, err = m.cachedTable(); err == nil {
+		m.checkRollbacks(table)
+	}
+	return rollbacks, nil
+}
+
+// raiseMarksFromDisk sube las marcas a los contadores que tiene ahora el DBF,
+// las guarda (si el servicio se corta a mitad de la restauración, al volver
+// tiene que detectar el retroceso) y verifica que todas quepan en los campos
+// del respaldo de encabezado h. Se llama con el encabezado bloqueado.
+func (m *Manager) raiseMarksFromDisk(h *dbfHeader) error {
+	current, err := ReadRecordTypes(m.dbfPath, m.tableEncoding(m.header))
+	if err != nil {
+		return fmt.Errorf("error leyendo los contadores actuales antes de restaurar: %v", err)
+	}
+	for _, t := range current {
+		if t.NCFTipo != "" {
+			m.raiseMark(t.NCFTipo, "A", t.Numero1)
+			m.raiseMark(t.NCFTipo, "B", t.Numero2)
+		}
+	}
+	for key, emitido := range m.marks {
+		_, cta, _ := strings.Cut(key, "/")
+		campo := counterField(cta)
+		if f, ok := h.field(campo); ok && emitido > maxForWidth(f.Length) {
+			return fmt.Errorf("%w: %s ya emitió hasta %d y el respaldo tiene %s N(%d)",
+				ErrFieldOverflow, key, emitido, campo, f.Length)
+		}
+	}
+	return m.saveHighWater()
+}
+
+// overwriteFile reemplaza el contenido de dst por el de src escribiendo sobre
+// el mismo archivo
+func overwriteFile(dst, src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(len(data))); err != nil {
+		return err
+	}
+	return f.Sync()
+}
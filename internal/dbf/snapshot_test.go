@@ -0,0 +1,173 @@
+package dbf_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestManager_Snapshots(t *testing.T) {
+	path := copyFixture(t)
+	dir := filepath.Join(t.TempDir(), "respaldos")
+	mgr := mustManager(t, path, dbf.WithSnapshots(dir, dbf.DefaultSnapshotPolicy))
+	defer mgr.Close()
+
+	// Solo la primera asignación de la hora respalda, y antes de escribir
+	for i := 0; i < 3; i++ {
+		if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+			t.Fatalf("GetSequence() error = %v", err)
+		}
+	}
+	snaps, err := mgr.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	if len(snaps) != 1 {
+		t.Fatalf("Snapshots() = %+v, se esperaba un respaldo", snaps)
+	}
+	if snaps[0].CDX == "" {
+		t.Error("el respaldo no incluye el CDX")
+	}
+	if err := dbf.VerifySnapshot(snaps[0]); err != nil {
+		t.Errorf("VerifySnapshot() error = %v", err)
+	}
+	tipos, err := dbf.ReadRecordTypes(snaps[0].DBF, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ct := range tipos {
+		if ct.NCFTipo == "E34" && ct.Numero1 != 0 {
+			t.Errorf("el respaldo tiene E34 en %d, se esperaba el valor anterior a asignar", ct.Numero1)
+		}
+	}
+}
+
+func TestManager_SnapshotRetention(t *testing.T) {
+	path := copyFixture(t)
+	dir := t.TempDir()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day()-5, 8, 0, 0, 0, time.Local)
+	old := map[string]time.Time{
+		"reciente":      now.Add(-time.Hour),
+		"dia-primero":   day,
+		"dia-siguiente": day.Add(time.Hour),
+		"vencido":       now.AddDate(0, 0, -90),
+	}
+	names := make(map[string]string)
+	for k, fecha := range old {
+		names[k] = "FAC_PF_M-" + fecha.Format("20060102-150405")
+		if err := os.WriteFile(filepath.Join(dir, names[k]+".DBF"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mgr := mustManager(t, path, dbf.WithSnapshots(dir, dbf.DefaultSnapshotPolicy))
+	defer mgr.Close()
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+
+	snaps, err := mgr.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	got := make(map[string]bool)
+	for _, s := range snaps {
+		got[s.Nombre] = true
+	}
+	if len(snaps) != 3 || !got[names["reciente"]] || !got[names["dia-primero"]] {
+		t.Errorf("quedaron %+v; se esperaban el nuevo, %s y %s", got, names["reciente"], names["dia-primero"])
+	}
+	for _, k := range []string{"dia-siguiente", "vencido"} {
+		if got[names[k]] {
+			t.Errorf("no se podó %s", names[k])
+		}
+	}
+}
+
+func TestManager_RestoreSnapshot(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path, dbf.WithSnapshots(t.TempDir(), dbf.DefaultSnapshotPolicy))
+	defer mgr.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+			t.Fatalf("GetSequence() error = %v", err)
+		}
+	}
+	snaps, err := mgr.Snapshots()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("Snapshots() = %+v, %v", snaps, err)
+	}
+
+	if _, err := mgr.RestoreSnapshot("FAC_PF_M-19990101-000000"); !errors.Is(err, dbf.ErrSnapshotNotFound) {
+		t.Errorf("RestoreSnapshot() de un respaldo que no existe = %v", err)
+	}
+
+	// El respaldo es de antes de emitir E34 1 y 2: se adelanta a 2
+	advanced, err := mgr.RestoreSnapshot(snaps[0].Nombre)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	want := []dbf.Rollback{{Tipo: "E34", CTA: "A", Contador: 0, Emitido: 2}}
+	if !reflect.DeepEqual(advanced, want) {
+		t.Errorf("RestoreSnapshot() = %+v, se esperaba %+v", advanced, want)
+	}
+	if rollbacks, err := mgr.Rollbacks(); err != nil || len(rollbacks) != 0 {
+		t.Errorf("Rollbacks() = %+v, %v después de restaurar", rollbacks, err)
+	}
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000003" {
+		t.Errorf("GetSequence() = %q, %v; se repitió o se saltó un número", seq, err)
+	}
+
+	// Antes de restaurar se respaldó el estado que se reemplazó
+	if snaps, _ := mgr.Snapshots(); len(snaps) < 2 {
+		t.Errorf("Snapshots() = %+v, falta el respaldo previo a restaurar", snaps)
+	}
+}
+
+func TestManager_RestoreSnapshotKeepsERPCounters(t *testing.T) {
+	path := copyFixture(t)
+	mgr := mustManager(t, path, dbf.WithSnapshots(t.TempDir(), dbf.DefaultSnapshotPolicy))
+	defer mgr.Close()
+
+	// El respaldo se toma antes de la primera asignación del servicio
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+	snaps, err := mgr.Snapshots()
+	if err != nil || len(snaps) != 1 {
+		t.Fatalf("Snapshots() = %+v, %v", snaps, err)
+	}
+
+	// El ERP emite 2 y 3 sobre el mismo DBF; las marcas del servicio siguen en 1
+	tmp := t.TempDir()
+	erp := mustManager(t, path, dbf.WithJournal(filepath.Join(tmp, "erp.wal")), dbf.WithHighWaterFile(filepath.Join(tmp, "erp.hwm")))
+	for i := 0; i < 2; i++ {
+		if _, _, err := erp.GetSequence("E34", "A"); err != nil {
+			t.Fatalf("GetSequence() del ERP error = %v", err)
+		}
+	}
+	erp.Close()
+
+	advanced, err := mgr.RestoreSnapshot(snaps[0].Nombre)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	want := []dbf.Rollback{{Tipo: "E34", CTA: "A", Contador: 0, Emitido: 3}}
+	if !reflect.DeepEqual(advanced, want) {
+		t.Errorf("RestoreSnapshot() = %+v, se esperaba %+v", advanced, want)
+	}
+	if seq, _, err := mgr.GetSequence("E34", "A"); err != nil || seq != "E340000000004" {
+		t.Errorf("GetSequence() = %q, %v; se repitió un número del ERP", seq, err)
+	}
+}
@@ -0,0 +1,76 @@
+// internal/dbf/stock.go
+package dbf
+
+// StockLevel resume cuántos números le quedan a una cuenta (CTA) de un tipo de
+// comprobante antes de agotar su rango.
+type StockLevel struct {
+	Tipo      string `json:"tipo"`
+	CTA       string `json:"cta"`
+	Actual    int64  `json:"actual"`
+	Hasta     int64  `json:"hasta"`
+	Restantes int64  `json:"restantes"`
+	Minimo    int64  `json:"minimo"`
+}
+
+// WithStockObserver registra una función que recibe el stock de la cuenta
+// después de cada asignación. Se invoca con el lock del Manager tomado, así
+// que no debe bloquear.
+func WithStockObserver(fn func(StockLevel)) Option {
+	return func(m *Manager) error {
+		m.stockObserver = fn
+		return nil
+	}
+}
+
+// StockLevels calcula el stock de cada cuenta que tenga un límite conocido,
+// ya sea por su partición o por CANTSECUEN.
+func (m *Manager) StockLevels() ([]StockLevel, error) {
+	tipos, err := m.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	var levels []StockLevel
+	for _, t := range tipos {
+		if t.NCFTipo == "" {
+			continue
+		}
+		counters := map[string]int64{"A": t.Numero1, "B": t.Numero2}
+		for _, cta := range []string{"A", "B"} {
+			part, err := m.partitionFor(t.NCFTipo, cta)
+			if err != nil {
+				continue
+			}
+			if level, ok := StockLevelFor(part, t.CantSecuen, t.Minimo, counters[cta]); ok {
+				levels = append(levels, level)
+			}
+		}
+	}
+	return levels, nil
+}
+
+// StockLevelFor calcula el stock de una cuenta cuyo contador está en actual.
+// El límite es el fin de la partición, acotado por CANTSECUEN. Devuelve false
+// si la cuenta no tiene límite.
+func StockLevelFor(part Partition, cantSecuen, minimo, actual int64) (StockLevel, bool) {
+	hasta := part.Hasta
+	if cantSecuen > 0 && (hasta == 0 || cantSecuen < hasta) {
+		hasta = cantSecuen
+	}
+	if hasta == 0 {
+		return StockLevel{}, false
+	}
+
+	// Una cuenta que aún no entra en su partición tiene la partición completa
+	if actual < part.Desde-1 {
+		actual = part.Desde - 1
+	}
+	return StockLevel{
+		Tipo:      part.Tipo,
+		CTA:       part.CTA,
+		Actual:    actual,
+		Hasta:     hasta,
+		Restantes: max(hasta-actual, 0),
+		Minimo:    minimo,
+	}, true
+}
@@ -0,0 +1,49 @@
+package dbf_test
+
+import (
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+func TestManager_StockLevels(t *testing.T) {
+	var observed []dbf.StockLevel
+	mgr, err := dbf.NewManager(copyFixture(t),
+		dbf.WithPartitions([]dbf.Partition{
+			{Tipo: "E34", CTA: "A", Desde: 1, Hasta: 400},
+			{Tipo: "E34", CTA: "B", Desde: 401, Hasta: 1000},
+		}),
+		dbf.WithStockObserver(func(level dbf.StockLevel) { observed = append(observed, level) }),
+	)
+	if err != nil {
+		t.Fatalf("Error creando Manager: %v", err)
+	}
+
+	levels, err := mgr.StockLevels()
+	if err != nil {
+		t.Fatalf("StockLevels() error = %v", err)
+	}
+	byKey := make(map[string]dbf.StockLevel)
+	for _, l := range levels {
+		byKey[l.Tipo+"/"+l.CTA] = l
+	}
+
+	// E31 ya pasó CANTSECUEN, E34 B tiene su partición completa disponible
+	if l := byKey["E31/A"]; l.Restantes != 0 || l.Minimo != 5 {
+		t.Errorf("E31/A = %+v, se esperaba Restantes=0 Minimo=5", l)
+	}
+	if l := byKey["E34/B"]; l.Restantes != 600 || l.Hasta != 1000 {
+		t.Errorf("E34/B = %+v, se esperaba Restantes=600 Hasta=1000", l)
+	}
+	// Los tipos sin CANTSECUEN no tienen límite y no se reportan
+	if _, ok := byKey["B03/A"]; ok {
+		t.Error("B03 no tiene límite y no debería tener nivel de stock")
+	}
+
+	if _, _, err := mgr.GetSequence("E34", "B"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+	if len(observed) != 1 || observed[0].Restantes != 599 || observed[0].Actual != 401 {
+		t.Errorf("El observador recibió %+v, se esperaba Actual=401 Restantes=599", observed)
+	}
+}
@@ -0,0 +1,85 @@
+// internal/dbf/writer.go
+package dbf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeField escribe value en el campo name del registro row (base 0) con
+// escrituras posicionadas: solo los bytes del campo y la fecha de última
+// actualización del encabezado. El resto del archivo, incluidas las filas que
+// el ERP esté editando, no se toca. Los campos de caracteres se codifican en
+// encoding, la página de códigos del archivo. Vuelve después de sincronizar a
+// disco.
+func writeField(path string, h *dbfHeader, encoding string, row int, name string, value string) error {
+	f, ok := h.field(name)
+	if !ok {
+		return fmt.Errorf("el campo %s no existe en el DBF", name)
+	}
+	if row < 0 || row >= h.NumRecords {
+		return fmt.Errorf("registro %d fuera de rango (%d registros)", row+1, h.NumRecords)
+	}
+	data, err := encodeField(f, encoding, value)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("error abriendo DBF para escritura: %v", err)
+	}
+	defer file.Close()
+
+	pos := int64(h.HeaderLen) + int64(row)*int64(h.RecordLen) + int64(f.Offset)
+	if _, err := file.WriteAt(data, pos); err != nil {
+		return fmt.Errorf("error escribiendo %s del registro %d: %v", name, row+1, err)
+	}
+	now := time.Now()
+	date := []byte{byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())}
+	if _, err := file.WriteAt(date, 1); err != nil {
+		return fmt.Errorf("error actualizando fecha del encabezado: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error sincronizando DBF: %v", err)
+	}
+	return nil
+}
+
+// encodeField arma los bytes del campo: los numéricos alineados a la derecha
+// y los de caracteres y fechas a la izquierda, rellenos con espacios.
+func encodeField(f fieldDesc, encoding, value string) ([]byte, error) {
+	switch f.Type {
+	case 'N', 'F':
+		value = strings.TrimSpace(value)
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("valor no numérico para %s: %q", f.Name, value)
+		}
+		if len(value) > f.Length {
+			return nil, fmt.Errorf("%w: %s no cabe en %s N(%d)", ErrFieldOverflow, value, f.Name, f.Length)
+		}
+		return []byte(strings.Repeat(" ", f.Length-len(value)) + value), nil
+	case 'C':
+		text, err := encodeText(encoding, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if len(text) > f.Length {
+			return nil, fmt.Errorf("%w: %q no cabe en %s C(%d)", ErrFieldOverflow, value, f.Name, f.Length)
+		}
+		return append(text, bytes.Repeat([]byte{' '}, f.Length-len(text))...), nil
+	case 'D':
+		// AAAAMMDD; vacía queda en blanco como una fecha sin cargar
+		value = strings.TrimSpace(value)
+		if _, ok := parseFecha(value); value != "" && !ok {
+			return nil, fmt.Errorf("fecha inválida para %s: %q (se espera AAAAMMDD)", f.Name, value)
+		}
+		return []byte(value + strings.Repeat(" ", f.Length-len(value))), nil
+	default:
+		return nil, fmt.Errorf("escritura de campos tipo %c no soportada (%s)", f.Type, f.Name)
+	}
+}
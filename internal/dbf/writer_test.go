@@ -0,0 +1,72 @@
+package dbf_test
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Posición de NUMERO_1 dentro del registro del DBF de prueba
+const fixtureNumero1Offset = 0x48
+
+func TestManager_GetSequenceWritesInPlace(t *testing.T) {
+	path := copyFixture(t)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := mustManager(t, path)
+	tipos, err := mgr.GetRecordTypes()
+	if err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	row := -1
+	for i, tipo := range tipos {
+		if tipo.NCFTipo == "E34" {
+			row = i
+		}
+	}
+	if row < 0 {
+		t.Fatal("E34 no está en el DBF de prueba")
+	}
+
+	// Una edición del ERP en otra fila tiene que sobrevivir a la asignación
+	nombre := fixtureHeaderLen + 0*fixtureRecordLen + 7
+	edited := append([]byte(nil), before...)
+	copy(edited[nombre:], "EDITADO POR EL ERP")
+	if err := os.WriteFile(path, edited, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mgr.GetRecordTypes()
+
+	if _, _, err := mgr.GetSequence("E34", "A"); err != nil {
+		t.Fatalf("GetSequence() error = %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(edited) {
+		t.Fatalf("el tamaño del DBF cambió de %d a %d", len(edited), len(after))
+	}
+
+	// Solo pueden cambiar la fecha del encabezado y NUMERO_1 de E34
+	field := fixtureHeaderLen + row*fixtureRecordLen + fixtureNumero1Offset
+	for i := range after {
+		if after[i] == edited[i] {
+			continue
+		}
+		if (i >= 1 && i <= 3) || (i >= field && i < field+8) {
+			continue
+		}
+		t.Errorf("cambió el byte %d (%q -> %q)", i, edited[i], after[i])
+	}
+	if got := string(after[field : field+8]); got != "       1" {
+		t.Errorf("NUMERO_1 de E34 = %q, se esperaba %q", got, "       1")
+	}
+	now := time.Now()
+	if after[1] != byte(now.Year()-1900) || after[2] != byte(now.Month()) || after[3] != byte(now.Day()) {
+		t.Errorf("la fecha del encabezado no se actualizó: %v", after[1:4])
+	}
+}
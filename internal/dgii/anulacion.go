@@ -0,0 +1,27 @@
+// internal/dgii/anulacion.go
+package dgii
+
+// TiposAnulacion son los códigos de tipo de anulación que acepta la DGII para
+// los comprobantes reportados en el formato 608.
+var TiposAnulacion = map[string]string{
+	"01": "Deterioro de factura pre-imprenta",
+	"02": "Errores de impresión (factura pre-imprenta)",
+	"03": "Impresión defectuosa",
+	"04": "Corrección de la información",
+	"05": "Cambio de productos",
+	"06": "Devolución de productos",
+	"07": "Omisión de productos",
+	"08": "Errores en secuencia de NCF",
+	"09": "Por cese de operaciones",
+	"10": "Pérdida o hurto de talonarios",
+}
+
+// AnulacionPorVencimiento es el tipo que se registra cuando una reserva no se
+// confirma a tiempo y el número se anula automáticamente.
+const AnulacionPorVencimiento = "08"
+
+// ValidTipoAnulacion indica si el código existe en el catálogo de la DGII
+func ValidTipoAnulacion(code string) bool {
+	_, ok := TiposAnulacion[code]
+	return ok
+}
@@ -0,0 +1,133 @@
+// internal/dgii/reporte608.go
+package dgii
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"ecf-sequence-server/internal/ledger"
+)
+
+var (
+	// ErrRNCInvalido indica un RNC (9 dígitos) o cédula (11 dígitos) mal formado.
+	ErrRNCInvalido = errors.New("RNC inválido")
+
+	// ErrPeriodoInvalido indica un período que no tiene la forma AAAAMM.
+	ErrPeriodoInvalido = errors.New("período inválido")
+
+	// ErrAnuladoNoEmitido indica que el ledger tiene anulaciones de números que
+	// este servidor nunca emitió, por lo que el 608 no se puede generar.
+	ErrAnuladoNoEmitido = errors.New("NCF anulado sin registro de emisión en el ledger")
+)
+
+// Anulado es una línea de detalle del formato 608
+type Anulado struct {
+	NCF              string
+	FechaComprobante time.Time
+	TipoAnulacion    string
+}
+
+// ValidRNC acepta un RNC de 9 dígitos o una cédula de 11
+func ValidRNC(rnc string) bool {
+	if len(rnc) != 9 && len(rnc) != 11 {
+		return false
+	}
+	for _, c := range rnc {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePeriodo interpreta un período AAAAMM y devuelve el primer día del mes
+// en hora local.
+func ParsePeriodo(periodo string) (time.Time, error) {
+	t, err := time.ParseInLocation("200601", periodo, time.Local)
+	if err != nil || len(periodo) != 6 {
+		return time.Time{}, fmt.Errorf("%w: %q (se espera AAAAMM)", ErrPeriodoInvalido, periodo)
+	}
+	return t, nil
+}
+
+// Anulados608 recorre el ledger y devuelve los NCF anulados dentro del mes de
+// periodo, ordenados por NCF. Cada anulación tiene que corresponder a un NCF
+// que el ledger registró como emitido antes; si no, devuelve
+// ErrAnuladoNoEmitido con la lista de números en falta.
+//
+// scan es ledger.Ledger.Scan o un envoltorio de ledger.ScanDir.
+func Anulados608(scan func(func(ledger.Record) error) error, periodo time.Time) ([]Anulado, error) {
+	desde := time.Date(periodo.Year(), periodo.Month(), 1, 0, 0, 0, 0, time.Local)
+	hasta := desde.AddDate(0, 1, 0)
+
+	emitidos := make(map[string]time.Time)
+	anulados := make(map[string]Anulado)
+	var noEmitidos []string
+
+	err := scan(func(r ledger.Record) error {
+		switch r.Evento {
+		case ledger.EventIssued:
+			if _, ok := emitidos[r.NCF]; !ok {
+				emitidos[r.NCF] = r.Fecha
+			}
+		case ledger.EventVoided:
+			if r.Fecha.Before(desde) || !r.Fecha.Before(hasta) {
+				return nil
+			}
+			emitido, ok := emitidos[r.NCF]
+			if !ok {
+				noEmitidos = append(noEmitidos, r.NCF)
+				return nil
+			}
+			if _, ok := anulados[r.NCF]; ok {
+				return nil
+			}
+			if !ValidTipoAnulacion(r.Motivo) {
+				return fmt.Errorf("%s tiene un tipo de anulación inválido: %q", r.NCF, r.Motivo)
+			}
+			anulados[r.NCF] = Anulado{NCF: r.NCF, FechaComprobante: emitido, TipoAnulacion: r.Motivo}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(noEmitidos) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrAnuladoNoEmitido, strings.Join(noEmitidos, ", "))
+	}
+
+	list := make([]Anulado, 0, len(anulados))
+	for _, a := range anulados {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].NCF < list[j].NCF })
+	return list, nil
+}
+
+// Write608 escribe el 608 en el formato TXT de la DGII:
+//
+//	608|RNC|AAAAMM|CantidadRegistros
+//	NCF|FechaComprobante(AAAAMMDD)|TipoAnulacion
+//
+// Las líneas terminan en CRLF, como las genera la herramienta de la DGII.
+func Write608(w io.Writer, rnc string, periodo time.Time, anulados []Anulado) error {
+	if !ValidRNC(rnc) {
+		return fmt.Errorf("%w: %q", ErrRNCInvalido, rnc)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "608|%s|%s|%d\r\n", rnc, periodo.Format("200601"), len(anulados))
+	for _, a := range anulados {
+		fmt.Fprintf(bw, "%s|%s|%s\r\n", a.NCF, a.FechaComprobante.Format("20060102"), a.TipoAnulacion)
+	}
+	return bw.Flush()
+}
+
+// FileName608 es el nombre de archivo que espera la Oficina Virtual
+func FileName608(rnc string, periodo time.Time) string {
+	return fmt.Sprintf("DGII_F_608_%s_%s.TXT", rnc, periodo.Format("200601"))
+}
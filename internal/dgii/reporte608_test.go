@@ -0,0 +1,89 @@
+package dgii
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/ledger"
+)
+
+// scanOf simula ledger.Scan sobre una lista fija de registros
+func scanOf(records ...ledger.Record) func(func(ledger.Record) error) error {
+	return func(fn func(ledger.Record) error) error {
+		for _, r := range records {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestAnulados608(t *testing.T) {
+	periodo, err := ParsePeriodo("202501")
+	if err != nil {
+		t.Fatalf("ParsePeriodo() error = %v", err)
+	}
+	dia := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 10, 0, 0, 0, time.Local) }
+
+	scan := scanOf(
+		ledger.Record{Evento: ledger.EventIssued, NCF: "E320000000002", Fecha: dia(1, 3)},
+		ledger.Record{Evento: ledger.EventIssued, NCF: "E320000000001", Fecha: dia(1, 2)},
+		ledger.Record{Evento: ledger.EventIssued, NCF: "E320000000003", Fecha: dia(1, 30)},
+		ledger.Record{Evento: ledger.EventVoided, NCF: "E320000000002", Fecha: dia(1, 3), Motivo: "04"},
+		ledger.Record{Evento: ledger.EventVoided, NCF: "E320000000001", Fecha: dia(1, 2), Motivo: "08"},
+		// Anulado en febrero: va en el 608 del mes siguiente
+		ledger.Record{Evento: ledger.EventVoided, NCF: "E320000000003", Fecha: dia(2, 1), Motivo: "04"},
+	)
+
+	anulados, err := Anulados608(scan, periodo)
+	if err != nil {
+		t.Fatalf("Anulados608() error = %v", err)
+	}
+	if len(anulados) != 2 || anulados[0].NCF != "E320000000001" || anulados[1].NCF != "E320000000002" {
+		t.Fatalf("Anulados608() = %+v", anulados)
+	}
+
+	var buf bytes.Buffer
+	if err := Write608(&buf, "101010101", periodo, anulados); err != nil {
+		t.Fatalf("Write608() error = %v", err)
+	}
+	want := "608|101010101|202501|2\r\n" +
+		"E320000000001|20250102|08\r\n" +
+		"E320000000002|20250103|04\r\n"
+	if buf.String() != want {
+		t.Errorf("Write608() =\n%q\nse esperaba\n%q", buf.String(), want)
+	}
+	if name := FileName608("101010101", periodo); name != "DGII_F_608_101010101_202501.TXT" {
+		t.Errorf("FileName608() = %s", name)
+	}
+}
+
+func TestAnulados608_NoEmitido(t *testing.T) {
+	periodo, _ := ParsePeriodo("202501")
+	scan := scanOf(
+		ledger.Record{Evento: ledger.EventVoided, NCF: "E320000000009", Motivo: "04",
+			Fecha: time.Date(2025, 1, 5, 0, 0, 0, 0, time.Local)},
+	)
+	if _, err := Anulados608(scan, periodo); !errors.Is(err, ErrAnuladoNoEmitido) {
+		t.Errorf("Anulados608() error = %v, se esperaba ErrAnuladoNoEmitido", err)
+	}
+}
+
+func TestValidaciones608(t *testing.T) {
+	for _, p := range []string{"2025", "202513", "2025-01", "abcdef"} {
+		if _, err := ParsePeriodo(p); !errors.Is(err, ErrPeriodoInvalido) {
+			t.Errorf("ParsePeriodo(%q) error = %v", p, err)
+		}
+	}
+	for rnc, ok := range map[string]bool{"101010101": true, "00112345678": true, "1010": false, "10101010X": false} {
+		if ValidRNC(rnc) != ok {
+			t.Errorf("ValidRNC(%q) = %v", rnc, !ok)
+		}
+	}
+	if err := Write608(&bytes.Buffer{}, "123", time.Now(), nil); !errors.Is(err, ErrRNCInvalido) {
+		t.Errorf("Write608() con RNC inválido error = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+// internal/idempotency/store.go
+package idempotency
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry es el resultado guardado para una clave de idempotencia
+type Entry struct {
+	Scope    string    `json:"scope"`
+	Key      string    `json:"key"`
+	Sequence string    `json:"sequence"`
+	Number   int64     `json:"number"`
+	CreadoEn time.Time `json:"creado"`
+}
+
+// Store recuerda qué secuencia se entregó para cada clave durante la ventana
+// de retención. Se persiste en un archivo JSON Lines que se compacta al abrir,
+// así un reintento después de reiniciar el servicio recibe el mismo NCF.
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	retention time.Duration
+	entries   map[string]Entry
+	inFlight  map[string]*keyLock
+	now       func() time.Time
+}
+
+// keyLock serializa las solicitudes concurrentes que traen la misma clave
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Open carga el archivo, descarta las entradas vencidas y lo reescribe solo
+// con las vigentes.
+func Open(path string, retention time.Duration) (*Store, error) {
+	s := &Store{
+		path:      path,
+		retention: retention,
+		entries:   make(map[string]Entry),
+		inFlight:  make(map[string]*keyLock),
+		now:       time.Now,
+	}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				continue
+			}
+			if s.expired(e) {
+				continue
+			}
+			s.entries[mapKey(e.Scope, e.Key)] = e
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error leyendo claves de idempotencia: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error abriendo claves de idempotencia: %v", err)
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo claves de idempotencia: %v", err)
+	}
+	s.file = file
+	return s, nil
+}
+
+// Close cierra el archivo
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Do devuelve el resultado guardado para scope/key o, si no existe, ejecuta
+// allocate, lo persiste y lo devuelve. replayed indica si la respuesta salió
+// del registro. Los errores de allocate no se guardan: el cliente puede
+// reintentar con la misma clave.
+func (s *Store) Do(scope, key string, allocate func() (string, int64, error)) (e Entry, replayed bool, err error) {
+	k := mapKey(scope, key)
+	lock := s.acquire(k)
+	defer s.release(k, lock)
+
+	if e, ok := s.lookup(k); ok {
+		return e, true, nil
+	}
+
+	sequence, number, err := allocate()
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	e = Entry{Scope: scope, Key: key, Sequence: sequence, Number: number, CreadoEn: s.now()}
+	if err := s.save(k, e); err != nil {
+		return e, false, err
+	}
+	return e, false, nil
+}
+
+func (s *Store) lookup(k string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[k]
+	if !ok {
+		return Entry{}, false
+	}
+	if s.expired(e) {
+		delete(s.entries, k)
+		return Entry{}, false
+	}
+	return e, true
+}
+
+func (s *Store) save(k string, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error guardando clave de idempotencia: %v", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("error sincronizando claves de idempotencia: %v", err)
+	}
+	s.entries[k] = e
+	return nil
+}
+
+func (s *Store) acquire(k string) *keyLock {
+	s.mu.Lock()
+	lock, ok := s.inFlight[k]
+	if !ok {
+		lock = &keyLock{}
+		s.inFlight[k] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	lock.mu.Lock()
+	return lock
+}
+
+func (s *Store) release(k string, lock *keyLock) {
+	lock.mu.Unlock()
+
+	s.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(s.inFlight, k)
+	}
+	s.mu.Unlock()
+}
+
+// compact reescribe el archivo solo con las entradas vigentes
+func (s *Store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error compactando claves de idempotencia: %v", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range s.entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error compactando claves de idempotencia: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error compactando claves de idempotencia: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) expired(e Entry) bool {
+	return s.now().Sub(e.CreadoEn) > s.retention
+}
+
+func mapKey(scope, key string) string {
+	return scope + "\x00" + key
+}
@@ -0,0 +1,82 @@
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStoreDo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotencia.jsonl")
+	s, err := Open(path, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	var calls int64
+	allocate := func() (string, int64, error) {
+		n := atomic.AddInt64(&calls, 1)
+		return fmt.Sprintf("E32%010d", n), n, nil
+	}
+
+	// Reintentos concurrentes con la misma clave asignan una sola vez
+	var wg sync.WaitGroup
+	results := make(chan Entry, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, _, err := s.Do("scope|E32", "pos-1", allocate)
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+			results <- e
+		}()
+	}
+	wg.Wait()
+	close(results)
+	for e := range results {
+		if e.Sequence != "E320000000001" {
+			t.Errorf("Do() = %s, se esperaba E320000000001", e.Sequence)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("allocate se llamó %d veces, se esperaba 1", calls)
+	}
+
+	// Otra clave u otro scope asignan un número nuevo
+	if e, replayed, _ := s.Do("scope|E31", "pos-1", allocate); replayed || e.Number != 2 {
+		t.Errorf("Do() con otro scope = %+v (replayed=%v)", e, replayed)
+	}
+
+	// Los errores no se recuerdan
+	failing := func() (string, int64, error) { return "", 0, errors.New("rango agotado") }
+	if _, _, err := s.Do("scope|E32", "pos-2", failing); err == nil {
+		t.Fatal("Do() debería propagar el error")
+	}
+	if e, replayed, _ := s.Do("scope|E32", "pos-2", allocate); replayed || e.Number != 3 {
+		t.Errorf("Do() después de un error = %+v (replayed=%v)", e, replayed)
+	}
+	s.Close()
+
+	// Después de reiniciar se devuelve el mismo resultado
+	s, err = Open(path, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	e, replayed, err := s.Do("scope|E32", "pos-1", allocate)
+	if err != nil || !replayed || e.Sequence != "E320000000001" {
+		t.Errorf("Do() tras reinicio = %+v (replayed=%v, err=%v)", e, replayed, err)
+	}
+
+	// Pasada la retención, la clave se olvida
+	s.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if _, replayed, _ := s.Do("scope|E32", "pos-1", allocate); replayed {
+		t.Error("Do() no debería repetir una clave vencida")
+	}
+	s.Close()
+}
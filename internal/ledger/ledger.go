@@ -0,0 +1,460 @@
+// internal/ledger/ledger.go
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Eventos que se registran en el ledger
+const (
+	EventIssued    = "emitido"
+	EventConfirmed = "confirmado"
+	EventVoided    = "anulado"
+)
+
+// DefaultSegmentSize es el tamaño a partir del cual se rota el segmento activo
+const DefaultSegmentSize = 16 << 20
+
+// Record es una entrada del ledger. Cada asignación genera un registro
+// "emitido"; las confirmaciones y anulaciones de reservas agregan registros
+// nuevos con el mismo NCF en lugar de modificar el original.
+type Record struct {
+	Seq       uint64    `json:"seq"`
+	Evento    string    `json:"evento"`
+	NCF       string    `json:"ncf"`
+	Tipo      string    `json:"tipo"`
+	CTA       string    `json:"cta"`
+	Numero    int64     `json:"numero"`
+	Fecha     time.Time `json:"fecha"`
+	APIKey    string    `json:"api_key,omitempty"` // identidad de la API Key (hash)
+	Cliente   string    `json:"cliente,omitempty"` // cliente dueño de la API Key, p.ej. "caja-03"
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Factura   string    `json:"factura,omitempty"`
+	Motivo    string    `json:"motivo,omitempty"`
+}
+
+// location ubica un registro dentro de un segmento
+type location struct {
+	Segment int   `json:"s"`
+	Offset  int64 `json:"o"`
+}
+
+// Ledger es un registro de solo anexado repartido en segmentos JSON Lines
+// (ledger-000001.jsonl, ...). Cada Append se sincroniza a disco antes de
+// volver. Al rotar, el segmento cerrado deja un índice .idx con la posición de
+// cada NCF para no tener que recorrerlo en cada arranque.
+type Ledger struct {
+	mu          sync.Mutex
+	dir         string
+	maxSize     int64
+	active      *os.File
+	activeNum   int
+	activeSize  int64
+	lastSeq     uint64
+	index       map[string][]location
+	segmentsNum []int
+	dirty       bool // quedaron bytes de un Append fallido después de activeSize
+
+	// Logf recibe los errores que no hacen fallar un Append (p.ej. una
+	// rotación que no se pudo hacer); por defecto usa log.Print.
+	Logf func(string)
+}
+
+// Open abre el ledger en dir, cargando los índices de los segmentos cerrados y
+// recorriendo el segmento activo. Una última línea incompleta (corte de luz a
+// mitad de escritura) se trunca.
+func Open(dir string, maxSize int64) (*Ledger, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creando directorio del ledger: %v", err)
+	}
+
+	l := &Ledger{
+		dir:     dir,
+		maxSize: maxSize,
+		index:   make(map[string][]location),
+	}
+
+	nums, err := l.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		nums = []int{1}
+	}
+	l.segmentsNum = nums
+
+	for _, n := range nums[:len(nums)-1] {
+		if err := l.loadSealed(n); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.openActive(nums[len(nums)-1]); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close cierra el segmento activo
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active.Close()
+}
+
+// Append agrega los registros en orden, les asigna Seq y sincroniza a disco
+// una sola vez. Si falla, ninguno de los registros queda escrito ni indexado:
+// el segmento se trunca al último registro bueno (si eso también falla, se
+// vuelve a intentar antes de escribir el próximo), así que reintentar el
+// mismo Append no los duplica. Una vez sincronizados, los registros están en
+// el ledger aunque después falle la rotación: ese error va a Logf y se
+// reintenta en el próximo Append.
+func (l *Ledger) Append(records ...Record) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.dirty {
+		if err := l.active.Truncate(l.activeSize); err != nil {
+			return nil, fmt.Errorf("error descartando una escritura incompleta del ledger: %v", err)
+		}
+		l.dirty = false
+	}
+
+	var buf bytes.Buffer
+	offsets := make([]int64, len(records))
+	out := make([]Record, len(records))
+	seq := l.lastSeq
+	for i, r := range records {
+		seq++
+		r.Seq = seq
+		if r.Fecha.IsZero() {
+			r.Fecha = time.Now()
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		offsets[i] = l.activeSize + int64(buf.Len())
+		buf.Write(line)
+		buf.WriteByte('\n')
+		out[i] = r
+	}
+
+	if _, err := l.active.Write(buf.Bytes()); err != nil {
+		// Dejar el archivo como estaba para no indexar basura
+		l.dirty = l.active.Truncate(l.activeSize) != nil
+		return nil, fmt.Errorf("error escribiendo ledger: %v", err)
+	}
+	if err := l.active.Sync(); err != nil {
+		// Sin Sync no hay garantía de que estén en disco: se quitan para que
+		// quien llama pueda reintentar sin duplicarlos
+		l.dirty = l.active.Truncate(l.activeSize) != nil
+		return nil, fmt.Errorf("error sincronizando ledger: %v", err)
+	}
+
+	l.activeSize += int64(buf.Len())
+	l.lastSeq = seq
+	for i, r := range out {
+		l.index[r.NCF] = append(l.index[r.NCF], location{Segment: l.activeNum, Offset: offsets[i]})
+	}
+
+	if l.activeSize >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.logf(fmt.Sprintf("Error rotando ledger (se reintenta en la próxima escritura): %v", err))
+		}
+	}
+	return out, nil
+}
+
+// Lookup devuelve todos los registros de un NCF en orden de escritura
+func (l *Ledger) Lookup(ncf string) ([]Record, error) {
+	l.mu.Lock()
+	locs := append([]location(nil), l.index[ncf]...)
+	l.mu.Unlock()
+
+	records := make([]Record, 0, len(locs))
+	for _, loc := range locs {
+		r, err := l.readAt(loc)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Scan recorre todos los registros del ledger en orden. Si fn devuelve error
+// el recorrido se detiene y se devuelve ese error.
+func (l *Ledger) Scan(fn func(Record) error) error {
+	l.mu.Lock()
+	nums := append([]int(nil), l.segmentsNum...)
+	activeNum, activeSize := l.activeNum, l.activeSize
+	l.mu.Unlock()
+
+	for _, n := range nums {
+		limit := int64(-1)
+		if n == activeNum {
+			// No leer registros que se estén escribiendo en este momento
+			limit = activeSize
+		}
+		if err := scanFile(l.segmentPath(n), limit, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanDir recorre en orden los registros de un ledger sin abrirlo para
+// escritura, de modo que se puede usar mientras el servicio está corriendo.
+// Una última línea incompleta (escritura en curso) se ignora. Un directorio
+// que todavía no existe (el servicio nunca asignó) es un ledger vacío.
+func ScanDir(dir string, fn func(Record) error) error {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	l := &Ledger{dir: dir}
+	nums, err := l.listSegments()
+	if err != nil {
+		return err
+	}
+	for _, n := range nums {
+		if err := scanFile(l.segmentPath(n), -1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFile lee hasta limit bytes de un segmento (-1 = todo el archivo)
+func scanFile(path string, limit int64, fn func(Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error abriendo segmento del ledger: %v", err)
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if limit >= 0 {
+		reader = io.LimitReader(f, limit)
+	}
+	br := bufio.NewReader(reader)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("registro corrupto en %s: %v", path, err)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *Ledger) logf(msg string) {
+	if l.Logf != nil {
+		l.Logf(msg)
+		return
+	}
+	log.Print(msg)
+}
+
+// LastSeq devuelve el número del último registro escrito
+func (l *Ledger) LastSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastSeq
+}
+
+func (l *Ledger) segmentPath(n int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("ledger-%06d.jsonl", n))
+}
+
+func (l *Ledger) indexPath(n int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("ledger-%06d.idx", n))
+}
+
+func (l *Ledger) listSegments() ([]int, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo directorio del ledger: %v", err)
+	}
+	var nums []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "ledger-") || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "ledger-"), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
+
+// sealedIndex es el contenido de un archivo .idx
+type sealedIndex struct {
+	LastSeq uint64             `json:"last_seq"`
+	NCFs    map[string][]int64 `json:"ncfs"`
+}
+
+// loadSealed carga el índice de un segmento cerrado, o lo reconstruye si falta
+func (l *Ledger) loadSealed(n int) error {
+	var idx sealedIndex
+	data, err := os.ReadFile(l.indexPath(n))
+	if err == nil && json.Unmarshal(data, &idx) == nil {
+		for ncf, offsets := range idx.NCFs {
+			for _, off := range offsets {
+				l.index[ncf] = append(l.index[ncf], location{Segment: n, Offset: off})
+			}
+		}
+		l.lastSeq = max(l.lastSeq, idx.LastSeq)
+		return nil
+	}
+
+	idx, _, err = l.scanSegment(n, false)
+	if err != nil {
+		return err
+	}
+	return l.writeIndex(n, idx)
+}
+
+func (l *Ledger) openActive(n int) error {
+	_, size, err := l.scanSegment(n, true)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.segmentPath(n), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo segmento del ledger: %v", err)
+	}
+	l.active = f
+	l.activeNum = n
+	l.activeSize = size
+	return nil
+}
+
+// scanSegment recorre un segmento, agrega sus NCF al índice en memoria y
+// devuelve el índice del segmento y el tamaño válido. Con truncate, una cola
+// incompleta se corta; sin él, se considera corrupción.
+func (l *Ledger) scanSegment(n int, truncate bool) (sealedIndex, int64, error) {
+	idx := sealedIndex{NCFs: make(map[string][]int64)}
+	data, err := os.ReadFile(l.segmentPath(n))
+	if os.IsNotExist(err) {
+		return idx, 0, nil
+	}
+	if err != nil {
+		return idx, 0, fmt.Errorf("error leyendo segmento del ledger: %v", err)
+	}
+
+	var offset int64
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		var r Record
+		if nl < 0 || json.Unmarshal(data[:nl], &r) != nil {
+			if !truncate {
+				return idx, 0, fmt.Errorf("registro corrupto en %s, offset %d", l.segmentPath(n), offset)
+			}
+			if err := os.Truncate(l.segmentPath(n), offset); err != nil {
+				return idx, 0, fmt.Errorf("error truncando segmento del ledger: %v", err)
+			}
+			break
+		}
+		idx.NCFs[r.NCF] = append(idx.NCFs[r.NCF], offset)
+		l.index[r.NCF] = append(l.index[r.NCF], location{Segment: n, Offset: offset})
+		idx.LastSeq = r.Seq
+		l.lastSeq = max(l.lastSeq, r.Seq)
+		offset += int64(nl) + 1
+		data = data[nl+1:]
+	}
+	return idx, offset, nil
+}
+
+func (l *Ledger) writeIndex(n int, idx sealedIndex) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := l.indexPath(n) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo índice del ledger: %v", err)
+	}
+	return os.Rename(tmp, l.indexPath(n))
+}
+
+// rotate cierra el segmento activo, escribe su índice y abre el siguiente. Si
+// algo falla el segmento activo sigue abierto y se puede seguir escribiendo.
+func (l *Ledger) rotate() error {
+	idx := sealedIndex{LastSeq: l.lastSeq, NCFs: make(map[string][]int64)}
+	for ncf, locs := range l.index {
+		for _, loc := range locs {
+			if loc.Segment == l.activeNum {
+				idx.NCFs[ncf] = append(idx.NCFs[ncf], loc.Offset)
+			}
+		}
+	}
+	if err := l.writeIndex(l.activeNum, idx); err != nil {
+		return err
+	}
+
+	next := l.activeNum + 1
+	f, err := os.OpenFile(l.segmentPath(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo segmento del ledger: %v", err)
+	}
+	if err := l.active.Close(); err != nil {
+		// Ya está sincronizado; el segmento nuevo se usa igual
+		l.logf(fmt.Sprintf("Error cerrando segmento %d del ledger: %v", l.activeNum, err))
+	}
+	l.active = f
+	l.activeNum = next
+	l.activeSize = 0
+	l.segmentsNum = append(l.segmentsNum, next)
+	return nil
+}
+
+func (l *Ledger) readAt(loc location) (Record, error) {
+	f, err := os.Open(l.segmentPath(loc.Segment))
+	if err != nil {
+		return Record{}, fmt.Errorf("error abriendo segmento del ledger: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(loc.Offset, io.SeekStart); err != nil {
+		return Record{}, err
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Record{}, err
+	}
+	var r Record
+	if err := json.Unmarshal(line, &r); err != nil {
+		return Record{}, fmt.Errorf("registro corrupto en %s, offset %d: %v", l.segmentPath(loc.Segment), loc.Offset, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,172 @@
+package ledger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func issued(ncf string, numero int64) Record {
+	return Record{Evento: EventIssued, NCF: ncf, Tipo: "E32", CTA: "A", Numero: numero}
+}
+
+func TestLedger_AppendLookup(t *testing.T) {
+	l, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	out, err := l.Append(issued("E320000000001", 1), issued("E320000000002", 2))
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if out[0].Seq != 1 || out[1].Seq != 2 || out[0].Fecha.IsZero() {
+		t.Errorf("Append() no asignó Seq/Fecha: %+v", out)
+	}
+	if _, err := l.Append(Record{Evento: EventVoided, NCF: "E320000000001", Motivo: "04"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	got, err := l.Lookup("E320000000001")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Evento != EventIssued || got[1].Evento != EventVoided {
+		t.Errorf("Lookup() = %+v", got)
+	}
+	if got, _ := l.Lookup("E329999999999"); len(got) != 0 {
+		t.Errorf("Lookup() de un NCF inexistente = %+v", got)
+	}
+}
+
+func TestLedger_RotationAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	// Segmentos diminutos para forzar una rotación por registro
+	l, err := Open(dir, 64)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for i := int64(1); i <= 5; i++ {
+		if _, err := l.Append(issued(fmt.Sprintf("E32%010d", i), i)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	l.Close()
+
+	idx, _ := filepath.Glob(filepath.Join(dir, "ledger-*.idx"))
+	if len(idx) != 5 {
+		t.Errorf("se esperaban 5 índices de segmentos cerrados, hay %d", len(idx))
+	}
+
+	l, err = Open(dir, 64)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	if l.LastSeq() != 5 {
+		t.Errorf("LastSeq() = %d, se esperaba 5", l.LastSeq())
+	}
+	got, err := l.Lookup("E320000000003")
+	if err != nil || len(got) != 1 || got[0].Numero != 3 {
+		t.Errorf("Lookup() tras reabrir = %+v, %v", got, err)
+	}
+
+	var seqs []uint64
+	l.Scan(func(r Record) error {
+		seqs = append(seqs, r.Seq)
+		return nil
+	})
+	if len(seqs) != 5 || seqs[0] != 1 || seqs[4] != 5 {
+		t.Errorf("Scan() recorrió %v", seqs)
+	}
+
+	// La numeración sigue después de reabrir
+	out, _ := l.Append(issued("E320000000006", 6))
+	if out[0].Seq != 6 {
+		t.Errorf("Seq tras reabrir = %d, se esperaba 6", out[0].Seq)
+	}
+}
+
+func TestLedger_RotationFailureKeepsRecord(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 64)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+	var logged []string
+	l.Logf = func(msg string) { logged = append(logged, msg) }
+
+	// Un directorio con el nombre del segmento siguiente impide rotar
+	next := filepath.Join(dir, "ledger-000002.jsonl")
+	if err := os.Mkdir(next, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append(issued("E320000000001", 1)); err != nil {
+		t.Fatalf("Append() con la rotación fallando error = %v; el registro ya estaba escrito", err)
+	}
+	if len(logged) != 1 {
+		t.Errorf("Logf recibió %q, se esperaba el error de rotación", logged)
+	}
+	if got, _ := l.Lookup("E320000000001"); len(got) != 1 {
+		t.Errorf("Lookup() = %+v", got)
+	}
+
+	// Se sigue escribiendo en el mismo segmento y la rotación se reintenta
+	os.Remove(next)
+	if _, err := l.Append(issued("E320000000002", 2)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ledger-000001.idx")); err != nil {
+		t.Errorf("no se rotó al reintentar: %v", err)
+	}
+	var n int
+	l.Scan(func(Record) error { n++; return nil })
+	if n != 2 {
+		t.Errorf("Scan() recorrió %d registros, se esperaban 2", n)
+	}
+}
+
+func TestLedger_TruncatesPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	l.Append(issued("E320000000001", 1))
+	l.Close()
+
+	// Simular un corte de luz a mitad de una escritura
+	f, _ := os.OpenFile(filepath.Join(dir, "ledger-000001.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"seq":2,"evento":"emit`)
+	f.Close()
+
+	l, err = Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer l.Close()
+
+	out, err := l.Append(issued("E320000000002", 2))
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if out[0].Seq != 2 {
+		t.Errorf("Seq = %d, se esperaba 2", out[0].Seq)
+	}
+	got, err := l.Lookup("E320000000002")
+	if err != nil || len(got) != 1 {
+		t.Errorf("Lookup() tras truncar = %+v, %v", got, err)
+	}
+}
+
+func TestScanDir_Missing(t *testing.T) {
+	var n int
+	err := ScanDir(filepath.Join(t.TempDir(), "ledger"), func(Record) error { n++; return nil })
+	if err != nil || n != 0 {
+		t.Errorf("ScanDir() de un ledger que no existe = %d registros, %v", n, err)
+	}
+}
@@ -0,0 +1,114 @@
+// internal/ncf/catalog.go
+package ncf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownType indica un tipo de comprobante que no está en el catálogo de
+// la DGII.
+var ErrUnknownType = errors.New("tipo de comprobante desconocido")
+
+// Serie define el formato de los NCF de una serie: la letra inicial, el largo
+// total del NCF y cuántos dígitos tiene la parte secuencial.
+type Serie struct {
+	Prefijo  string
+	Longitud int
+	Digitos  int
+}
+
+var (
+	// SerieB son los NCF tradicionales: B + tipo (2) + secuencia (8) = 11
+	SerieB = Serie{Prefijo: "B", Longitud: 11, Digitos: 8}
+
+	// SerieE son los e-NCF: E + tipo (2) + secuencia (10) = 13
+	SerieE = Serie{Prefijo: "E", Longitud: 13, Digitos: 10}
+)
+
+// MaxNumero es el mayor secuencial que cabe en la serie
+func (s Serie) MaxNumero() int64 {
+	n := int64(1)
+	for i := 0; i < s.Digitos; i++ {
+		n *= 10
+	}
+	return n - 1
+}
+
+// Tipo es un tipo de comprobante del catálogo de la DGII
+type Tipo struct {
+	Codigo      string `json:"codigo"`
+	Descripcion string `json:"descripcion"`
+	Serie       Serie  `json:"-"`
+}
+
+// Catalogo contiene los tipos de comprobante vigentes de la DGII
+var Catalogo = map[string]Tipo{
+	"B01": {"B01", "Factura de Crédito Fiscal", SerieB},
+	"B02": {"B02", "Factura de Consumo", SerieB},
+	"B03": {"B03", "Nota de Débito", SerieB},
+	"B04": {"B04", "Nota de Crédito", SerieB},
+	"B11": {"B11", "Comprobante de Compras", SerieB},
+	"B12": {"B12", "Registro Único de Ingresos", SerieB},
+	"B13": {"B13", "Comprobante para Gastos Menores", SerieB},
+	"B14": {"B14", "Comprobante para Regímenes Especiales", SerieB},
+	"B15": {"B15", "Comprobante Gubernamental", SerieB},
+	"B16": {"B16", "Comprobante para Exportaciones", SerieB},
+	"B17": {"B17", "Comprobante para Pagos al Exterior", SerieB},
+
+	"E31": {"E31", "Factura de Crédito Fiscal Electrónica", SerieE},
+	"E32": {"E32", "Factura de Consumo Electrónica", SerieE},
+	"E33": {"E33", "Nota de Débito Electrónica", SerieE},
+	"E34": {"E34", "Nota de Crédito Electrónica", SerieE},
+	"E41": {"E41", "Compras Electrónico", SerieE},
+	"E43": {"E43", "Gastos Menores Electrónico", SerieE},
+	"E44": {"E44", "Regímenes Especiales Electrónico", SerieE},
+	"E45": {"E45", "Gubernamental Electrónico", SerieE},
+	"E46": {"E46", "Comprobante de Exportaciones Electrónico", SerieE},
+	"E47": {"E47", "Comprobante para Pagos al Exterior Electrónico", SerieE},
+}
+
+// Lookup devuelve el tipo del catálogo o ErrUnknownType
+func Lookup(codigo string) (Tipo, error) {
+	t, ok := Catalogo[codigo]
+	if !ok {
+		return Tipo{}, fmt.Errorf("%w: %q", ErrUnknownType, codigo)
+	}
+	return t, nil
+}
+
+// Format arma el NCF de codigo con el relleno que corresponde a su serie, por
+// ejemplo B0100000001 o E310000000001.
+func Format(codigo string, numero int64) (string, error) {
+	t, err := Lookup(codigo)
+	if err != nil {
+		return "", err
+	}
+	if numero < 1 || numero > t.Serie.MaxNumero() {
+		return "", fmt.Errorf("el número %d no cabe en un NCF %s de %d dígitos", numero, codigo, t.Serie.Digitos)
+	}
+	return t.Format(numero), nil
+}
+
+// Format arma el NCF sin validar el rango; el llamador ya comprobó que numero
+// esté entre 1 y Serie.MaxNumero.
+func (t Tipo) Format(numero int64) string {
+	return fmt.Sprintf("%s%0*d", t.Codigo, t.Serie.Digitos, numero)
+}
+
+// Valid indica si s es un NCF bien formado de un tipo del catálogo
+func Valid(s string) bool {
+	if len(s) < 3 {
+		return false
+	}
+	t, ok := Catalogo[s[:3]]
+	if !ok || len(s) != t.Serie.Longitud {
+		return false
+	}
+	for _, c := range s[3:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
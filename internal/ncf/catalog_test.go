@@ -0,0 +1,65 @@
+package ncf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		codigo string
+		numero int64
+		want   string
+	}{
+		{"B01", 1, "B0100000001"},
+		{"B03", 12345678, "B0312345678"},
+		{"E31", 1, "E310000000001"},
+		{"E47", 9999999999, "E479999999999"},
+	}
+	for _, tt := range tests {
+		got, err := Format(tt.codigo, tt.numero)
+		if err != nil {
+			t.Errorf("Format(%s, %d) error = %v", tt.codigo, tt.numero, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Format(%s, %d) = %s, se esperaba %s", tt.codigo, tt.numero, got, tt.want)
+		}
+		if !Valid(got) {
+			t.Errorf("Valid(%s) = false", got)
+		}
+	}
+}
+
+func TestFormat_Errores(t *testing.T) {
+	if _, err := Format("XXX", 1); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Format(XXX) error = %v, se esperaba ErrUnknownType", err)
+	}
+	// B05 y E42 no existen en el catálogo de la DGII
+	for _, codigo := range []string{"B05", "E42", "e31"} {
+		if _, err := Lookup(codigo); !errors.Is(err, ErrUnknownType) {
+			t.Errorf("Lookup(%s) error = %v, se esperaba ErrUnknownType", codigo, err)
+		}
+	}
+	if _, err := Format("B01", 100000000); err == nil {
+		t.Error("Format() debe rechazar un número de 9 dígitos en la serie B")
+	}
+	if _, err := Format("E31", 0); err == nil {
+		t.Error("Format() debe rechazar el número 0")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for s, want := range map[string]bool{
+		"B0100000001":   true,
+		"E310000000001": true,
+		"B010000000001": false, // B con relleno de e-NCF
+		"E3100000001":   false,
+		"E31000000000A": false,
+		"X010000000":    false,
+	} {
+		if got := Valid(s); got != want {
+			t.Errorf("Valid(%s) = %v, se esperaba %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// internal/reservation/store.go
+package reservation
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"ecf-sequence-server/internal/dgii"
+)
+
+// Status es el estado de una reserva dentro de su ciclo de vida
+type Status string
+
+const (
+	StatusReserved  Status = "reservada"
+	StatusConfirmed Status = "confirmada"
+	StatusVoided    Status = "anulada"
+)
+
+var (
+	// ErrNotFound indica que el token no corresponde a ninguna reserva.
+	ErrNotFound = errors.New("reserva no encontrada")
+
+	// ErrNotPending indica que la reserva ya fue confirmada o anulada.
+	ErrNotPending = errors.New("la reserva ya no está pendiente")
+
+	// ErrInvalidReason indica un tipo de anulación fuera del catálogo DGII.
+	ErrInvalidReason = errors.New("tipo de anulación inválido")
+
+	// ErrExpired indica que la reserva pasó su TTL; la anula el barrido de
+	// vencidas aunque todavía no haya pasado.
+	ErrExpired = errors.New("la reserva venció")
+)
+
+// Reservation es un NCF entregado a un cliente que todavía debe confirmarlo
+// con su número de factura o anularlo.
+type Reservation struct {
+	Token     string    `json:"token"`
+	NCF       string    `json:"ncf"`
+	Tipo      string    `json:"tipo"`
+	CTA       string    `json:"cta"`
+	Numero    int64     `json:"numero"`
+	Estado    Status    `json:"estado"`
+	Factura   string    `json:"factura,omitempty"`
+	Motivo    string    `json:"motivo,omitempty"` // tipo de anulación DGII
+	CreadaEn  time.Time `json:"creada"`
+	ExpiraEn  time.Time `json:"expira"`
+	CerradaEn time.Time `json:"cerrada"`
+}
+
+// Store guarda las reservas en un archivo JSON Lines de solo anexado: cada
+// cambio de estado agrega una línea y se sincroniza a disco antes de responder.
+// Al abrirlo se reproduce el archivo y la última línea de cada token gana.
+type Store struct {
+	mu      sync.Mutex
+	file    *os.File
+	ttl     time.Duration
+	byToken map[string]*Reservation
+	now     func() time.Time
+}
+
+// Open abre (o crea) el archivo de reservas y reconstruye el estado en memoria.
+func Open(path string, ttl time.Duration) (*Store, error) {
+	s := &Store{
+		ttl:     ttl,
+		byToken: make(map[string]*Reservation),
+		now:     time.Now,
+	}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r Reservation
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				// Una última línea cortada por un corte de luz se descarta
+				continue
+			}
+			s.byToken[r.Token] = &r
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error leyendo reservas: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error abriendo reservas: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo reservas: %v", err)
+	}
+	s.file = file
+	return s, nil
+}
+
+// Close cierra el archivo de reservas
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Reserve registra un NCF recién asignado como pendiente de confirmación.
+// Si record no es nil recibe la reserva (ya con su token) antes de guardarla;
+// si falla, la reserva no se guarda. Así el servicio la anota primero en el
+// ledger y nunca queda una reserva que el ledger no conozca.
+func (s *Store) Reserve(ncf, tipo, cta string, numero int64, record func(Reservation) error) (Reservation, error) {
+	token, err := newToken()
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	r := &Reservation{
+		Token:    token,
+		NCF:      ncf,
+		Tipo:     tipo,
+		CTA:      cta,
+		Numero:   numero,
+		Estado:   StatusReserved,
+		CreadaEn: now,
+		ExpiraEn: now.Add(s.ttl),
+	}
+	if record != nil {
+		if err := record(*r); err != nil {
+			return Reservation{}, err
+		}
+	}
+	if err := s.append(r); err != nil {
+		return Reservation{}, err
+	}
+	s.byToken[token] = r
+	return *r, nil
+}
+
+// Confirm marca la reserva como usada por la factura indicada. record, si no
+// es nil, recibe el estado nuevo antes de guardarlo (ver Reserve).
+func (s *Store) Confirm(token, factura string, record func(Reservation) error) (Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.pending(token)
+	if err != nil {
+		return Reservation{}, err
+	}
+	next := *r
+	next.Estado = StatusConfirmed
+	next.Factura = factura
+	next.CerradaEn = s.now()
+	return s.commit(&next, record)
+}
+
+// Void anula la reserva con un tipo de anulación del catálogo DGII. record
+// como en Confirm.
+func (s *Store) Void(token, motivo string, record func(Reservation) error) (Reservation, error) {
+	if !dgii.ValidTipoAnulacion(motivo) {
+		return Reservation{}, fmt.Errorf("%w: %q", ErrInvalidReason, motivo)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.pending(token)
+	if err != nil {
+		return Reservation{}, err
+	}
+	return s.void(r, motivo, record)
+}
+
+// ExpireDue anula las reservas cuyo TTL venció y devuelve las afectadas.
+// record como en Confirm; una reserva que no se pudo anular sigue pendiente
+// para el próximo barrido y su error se devuelve junto con los demás.
+func (s *Store) ExpireDue(record func(Reservation) error) ([]Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var expired []Reservation
+	var errs []error
+	for _, r := range s.byToken {
+		if r.Estado != StatusReserved || now.Before(r.ExpiraEn) {
+			continue
+		}
+		voided, err := s.void(r, dgii.AnulacionPorVencimiento, record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.NCF, err))
+			continue
+		}
+		expired = append(expired, voided)
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Numero < expired[j].Numero })
+	return expired, errors.Join(errs...)
+}
+
+// Get devuelve la reserva asociada al token
+func (s *Store) Get(token string) (Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.byToken[token]
+	if !ok {
+		return Reservation{}, ErrNotFound
+	}
+	return *r, nil
+}
+
+func (s *Store) pending(token string) (*Reservation, error) {
+	r, ok := s.byToken[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if r.Estado != StatusReserved {
+		return nil, fmt.Errorf("%w: %s está %s", ErrNotPending, r.NCF, r.Estado)
+	}
+	if !s.now().Before(r.ExpiraEn) {
+		return nil, fmt.Errorf("%w: %s venció el %s", ErrExpired, r.NCF, r.ExpiraEn.Format(time.RFC3339))
+	}
+	return r, nil
+}
+
+func (s *Store) void(r *Reservation, motivo string, record func(Reservation) error) (Reservation, error) {
+	next := *r
+	next.Estado = StatusVoided
+	next.Motivo = motivo
+	next.CerradaEn = s.now()
+	return s.commit(&next, record)
+}
+
+// commit pasa el nuevo estado por record, lo persiste y recién entonces lo
+// publica en memoria. Si record falla no cambia nada.
+func (s *Store) commit(r *Reservation, record func(Reservation) error) (Reservation, error) {
+	if record != nil {
+		if err := record(*r); err != nil {
+			return Reservation{}, err
+		}
+	}
+	if err := s.append(r); err != nil {
+		return Reservation{}, err
+	}
+	s.byToken[r.Token] = r
+	return *r, nil
+}
+
+func (s *Store) append(r *Reservation) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error escribiendo reserva: %v", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("error sincronizando reservas: %v", err)
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generando token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,108 @@
+package reservation
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/dgii"
+)
+
+func TestStoreLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reservas.jsonl")
+	s, err := Open(path, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	a, err := s.Reserve("E320000000001", "E32", "A", 1, nil)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	b, _ := s.Reserve("E320000000002", "E32", "A", 2, nil)
+	c, _ := s.Reserve("E320000000003", "E32", "A", 3, nil)
+
+	if _, err := s.Confirm(a.Token, "FAC-001", nil); err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if _, err := s.Confirm(a.Token, "FAC-002", nil); !errors.Is(err, ErrNotPending) {
+		t.Errorf("Confirm() repetido error = %v, se esperaba %v", err, ErrNotPending)
+	}
+	if _, err := s.Void(b.Token, "99", nil); !errors.Is(err, ErrInvalidReason) {
+		t.Errorf("Void() con motivo inválido error = %v, se esperaba %v", err, ErrInvalidReason)
+	}
+	if _, err := s.Void(b.Token, "04", nil); err != nil {
+		t.Fatalf("Void() error = %v", err)
+	}
+	if _, err := s.Confirm("no-existe", "FAC-003", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Confirm() token inexistente error = %v, se esperaba %v", err, ErrNotFound)
+	}
+
+	// Al pasar el TTL solo la reserva pendiente se anula
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+	expired, err := s.ExpireDue(nil)
+	if err != nil {
+		t.Fatalf("ExpireDue() error = %v", err)
+	}
+	if len(expired) != 1 || expired[0].Token != c.Token || expired[0].Motivo != dgii.AnulacionPorVencimiento {
+		t.Errorf("ExpireDue() = %+v, se esperaba solo %s anulada por vencimiento", expired, c.NCF)
+	}
+	s.Close()
+
+	// El estado debe sobrevivir a un reinicio
+	s, err = Open(path, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close()
+
+	want := map[string]Status{a.Token: StatusConfirmed, b.Token: StatusVoided, c.Token: StatusVoided}
+	for token, estado := range want {
+		r, err := s.Get(token)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if r.Estado != estado {
+			t.Errorf("%s quedó %s, se esperaba %s", r.NCF, r.Estado, estado)
+		}
+	}
+	if r, _ := s.Get(a.Token); r.Factura != "FAC-001" {
+		t.Errorf("Factura = %q, se esperaba FAC-001", r.Factura)
+	}
+}
+
+func TestStoreRecordFailureAndExpiry(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "reservas.jsonl"), 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer s.Close()
+	failing := func(Reservation) error { return errors.New("ledger caído") }
+
+	// Si record falla no se guarda nada: ni la reserva ni su cierre
+	if _, err := s.Reserve("E320000000001", "E32", "A", 1, failing); err == nil {
+		t.Error("Reserve() con record fallando no devolvió error")
+	}
+	r, _ := s.Reserve("E320000000002", "E32", "A", 2, nil)
+	if _, err := s.Confirm(r.Token, "FAC-001", failing); err == nil {
+		t.Error("Confirm() con record fallando no devolvió error")
+	}
+	if got, _ := s.Get(r.Token); got.Estado != StatusReserved {
+		t.Errorf("la reserva quedó %s tras un Confirm fallido", got.Estado)
+	}
+
+	// Vencida no se puede confirmar aunque el barrido todavía no haya pasado
+	s.now = func() time.Time { return r.ExpiraEn }
+	if _, err := s.Confirm(r.Token, "FAC-001", nil); !errors.Is(err, ErrExpired) {
+		t.Errorf("Confirm() vencida error = %v, se esperaba %v", err, ErrExpired)
+	}
+
+	// Un barrido que no puede anotar la anulación la deja para el siguiente
+	if expired, err := s.ExpireDue(failing); err == nil || len(expired) != 0 {
+		t.Errorf("ExpireDue() = %+v, %v, se esperaba el error de record", expired, err)
+	}
+	if expired, err := s.ExpireDue(nil); err != nil || len(expired) != 1 {
+		t.Errorf("ExpireDue() = %+v, %v, se esperaba la reserva pendiente", expired, err)
+	}
+}
@@ -0,0 +1,429 @@
+// internal/store/bolt.go
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/ncf"
+)
+
+// bucketTipos guarda un dbf.ComprobanteTipo en JSON por cada tipo ("E31")
+var bucketTipos = []byte("tipos")
+
+// Bolt guarda los tipos de comprobante y sus contadores en un solo archivo
+// bbolt. Cada asignación es una transacción que llega a disco antes de
+// devolver los números, así que no hacen falta journal ni bloqueos por
+// registro como con el DBF. El archivo lo abre un solo proceso a la vez.
+type Bolt struct {
+	mu            sync.Mutex
+	db            *bbolt.DB
+	logPath       string
+	logFile       *os.File
+	partitions    dbf.Partitions
+	stockObserver func(dbf.StockLevel)
+	marks         map[string]int64 // mayor número emitido; clave: "TIPO/CTA"
+}
+
+// BoltOption configura parámetros opcionales de Bolt
+type BoltOption func(*Bolt) error
+
+// WithPartitions asigna a cada CTA su sub-rango de números, con las mismas
+// reglas que dbf.WithPartitions.
+func WithPartitions(parts []dbf.Partition) BoltOption {
+	return func(b *Bolt) error {
+		ps, err := dbf.NewPartitions(parts)
+		if err != nil {
+			return err
+		}
+		b.partitions = ps
+		return nil
+	}
+}
+
+// WithStockObserver registra una función que recibe el stock de la cuenta
+// después de cada asignación.
+func WithStockObserver(fn func(dbf.StockLevel)) BoltOption {
+	return func(b *Bolt) error {
+		b.stockObserver = fn
+		return nil
+	}
+}
+
+// WithHighWater agrega las marcas de emisión del ledger. Si alguien restaura
+// una copia vieja del archivo, los contadores que queden por debajo se
+// reportan en Rollbacks y no se asigna de ellos.
+func WithHighWater(marks []dbf.HighWater) BoltOption {
+	return func(b *Bolt) error {
+		for _, hw := range marks {
+			b.raiseMark(strings.ToUpper(hw.Tipo), strings.ToUpper(hw.CTA), hw.Numero)
+		}
+		return nil
+	}
+}
+
+// WithLogFile cambia el archivo de log (por defecto sequence.log en el
+// directorio actual).
+func WithLogFile(path string) BoltOption {
+	return func(b *Bolt) error {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("ruta de log vacía")
+		}
+		b.logPath = path
+		return nil
+	}
+}
+
+// OpenBolt abre el almacén de path, creándolo vacío si no existe. Falla si
+// otro proceso lo tiene abierto.
+func OpenBolt(path string, opts ...BoltOption) (*Bolt, error) {
+	b := &Bolt{logPath: "sequence.log", partitions: make(dbf.Partitions), marks: make(map[string]int64)}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+
+	logFile, err := os.OpenFile(b.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log file: %v", err)
+	}
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: time.Second})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		logFile.Close()
+		return nil, fmt.Errorf("el almacén %s lo tiene abierto otro proceso", path)
+	}
+	if err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("error abriendo almacén %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketTipos)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		logFile.Close()
+		return nil, fmt.Errorf("error inicializando almacén %s: %v", path, err)
+	}
+	b.db, b.logFile = db, logFile
+	return b, nil
+}
+
+// Close cierra el archivo del almacén
+func (b *Bolt) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.db.Close()
+	b.logFile.Close()
+	return err
+}
+
+// Log graba en el log local y en el archivo de log (sequence.log)
+func (b *Bolt) Log(message string) {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	fullMsg := fmt.Sprintf("%s: %s\n", timestamp, message)
+
+	log.Print(fullMsg)
+	_, _ = b.logFile.WriteString(fullMsg)
+}
+
+// PutTipo crea o reemplaza un tipo de comprobante completo, contadores
+// incluidos. El tipo se toma de NCFTipo o de los tres primeros caracteres de
+// Numero, como en el DBF.
+func (b *Bolt) PutTipo(t dbf.ComprobanteTipo) error {
+	if t.NCFTipo == "" && len(t.Numero) >= 3 {
+		t.NCFTipo = t.Numero[:3]
+	}
+	if t.NCFTipo == "" {
+		return fmt.Errorf("el tipo de comprobante no tiene código (NUMERO %q)", t.Numero)
+	}
+	t.BajoMinimo = false
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return putTipo(tx.Bucket(bucketTipos), t)
+	})
+}
+
+// GetRecordTypes lista los tipos ordenados por código
+func (b *Bolt) GetRecordTypes() ([]dbf.ComprobanteTipo, error) {
+	var tipos []dbf.ComprobanteTipo
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketTipos).ForEach(func(k, v []byte) error {
+			var t dbf.ComprobanteTipo
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("tipo %s dañado en el almacén: %v", k, err)
+			}
+			tipos = append(tipos, t)
+			return nil
+		})
+	})
+	return tipos, err
+}
+
+// GetSequence asigna el siguiente número de tipo/cta y devuelve el NCF junto
+// con el valor numérico que quedó en el contador.
+func (b *Bolt) GetSequence(tipo string, cta string) (string, int64, error) {
+	sequences, first, err := b.GetSequences(tipo, cta, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return sequences[0], first, nil
+}
+
+// GetSequences reserva count números contiguos de tipo/cta en una sola
+// transacción, con las mismas validaciones que el Manager del DBF.
+func (b *Bolt) GetSequences(tipo string, cta string, count int) ([]string, int64, error) {
+	if count < 1 {
+		return nil, 0, fmt.Errorf("cantidad inválida: %d", count)
+	}
+	ncfTipo, err := ncf.Lookup(tipo)
+	if err != nil {
+		return nil, 0, err
+	}
+	cta = strings.ToUpper(cta)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var firstVal, lastVal int64
+	var t dbf.ComprobanteTipo
+	var part dbf.Partition
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucketTipos)
+		var err error
+		if t, err = getTipo(bkt, tipo); err != nil {
+			return err
+		}
+		if firstVal, lastVal, part, err = b.nextRange(t, ncfTipo, cta, count); err != nil {
+			return err
+		}
+		setCounter(&t, cta, lastVal)
+		return putTipo(bkt, t)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	b.raiseMark(tipo, cta, lastVal)
+
+	sequences := make([]string, 0, count)
+	for n := firstVal; n <= lastVal; n++ {
+		sequences = append(sequences, ncfTipo.Format(n))
+	}
+	if count == 1 {
+		b.Log(fmt.Sprintf("Generated sequence: %s", sequences[0]))
+	} else {
+		b.Log(fmt.Sprintf("Generated sequences: %s - %s (%d)", sequences[0], sequences[count-1], count))
+	}
+
+	if b.stockObserver != nil {
+		if level, ok := dbf.StockLevelFor(part, t.CantSecuen, t.Minimo, lastVal); ok {
+			b.stockObserver(level)
+		}
+	}
+	return sequences, firstVal, nil
+}
+
+// Peek devuelve el NCF y el número que entregaría la próxima asignación de
+// tipo/cta, sin asignarlo.
+func (b *Bolt) Peek(tipo string, cta string) (string, int64, error) {
+	ncfTipo, err := ncf.Lookup(tipo)
+	if err != nil {
+		return "", 0, err
+	}
+	cta = strings.ToUpper(cta)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var first int64
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		t, err := getTipo(tx.Bucket(bucketTipos), tipo)
+		if err != nil {
+			return err
+		}
+		first, _, _, err = b.nextRange(t, ncfTipo, cta, 1)
+		return err
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return ncfTipo.Format(first), first, nil
+}
+
+// Adjust deja el contador de tipo/cta en numero, el último número emitido.
+// No se permite bajarlo de lo que ya se emitió, y numero pasa a ser la marca
+// de emisión.
+func (b *Bolt) Adjust(tipo string, cta string, numero int64) error {
+	cta = strings.ToUpper(cta)
+	if err := checkCTA(cta); err != nil {
+		return err
+	}
+	if numero < 0 {
+		return fmt.Errorf("número inválido: %d", numero)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if emitido := b.marks[tipo+"/"+cta]; numero < emitido {
+		return fmt.Errorf("%w: %s CTA %s no puede quedar en %d porque ya se emitió hasta %d",
+			dbf.ErrCounterRollback, tipo, cta, numero, emitido)
+	}
+	var actual int64
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucketTipos)
+		t, err := getTipo(bkt, tipo)
+		if err != nil {
+			return err
+		}
+		actual = counter(t, cta)
+		setCounter(&t, cta, numero)
+		return putTipo(bkt, t)
+	})
+	if err != nil {
+		return err
+	}
+	// Como en dbf.Manager.Adjust: una copia vieja del archivo no puede
+	// volver a un valor anterior sin que se note
+	b.raiseMark(tipo, cta, numero)
+	b.Log(fmt.Sprintf("%s CTA %s ajustado de %d a %d", tipo, cta, actual, numero))
+	return nil
+}
+
+// StockLevels calcula el stock de cada cuenta que tenga un límite conocido
+func (b *Bolt) StockLevels() ([]dbf.StockLevel, error) {
+	tipos, err := b.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+	var levels []dbf.StockLevel
+	for _, t := range tipos {
+		for _, cta := range []string{"A", "B"} {
+			part, err := b.partitions.For(t.NCFTipo, cta)
+			if err != nil {
+				continue
+			}
+			if level, ok := dbf.StockLevelFor(part, t.CantSecuen, t.Minimo, counter(t, cta)); ok {
+				levels = append(levels, level)
+			}
+		}
+	}
+	return levels, nil
+}
+
+// CheckCollisions reporta los números ya emitidos por ambas cuentas, igual
+// que dbf.Manager.CheckCollisions
+func (b *Bolt) CheckCollisions() ([]dbf.Collision, error) {
+	tipos, err := b.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+	return b.partitions.Collisions(tipos), nil
+}
+
+// Rollbacks devuelve los contadores que quedaron por debajo de las marcas de
+// emisión, normalmente porque se restauró una copia vieja del archivo.
+func (b *Bolt) Rollbacks() ([]dbf.Rollback, error) {
+	tipos, err := b.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var rollbacks []dbf.Rollback
+	for _, t := range tipos {
+		for _, cta := range []string{"A", "B"} {
+			if emitido := b.marks[t.NCFTipo+"/"+cta]; counter(t, cta) < emitido {
+				rollbacks = append(rollbacks, dbf.Rollback{Tipo: t.NCFTipo, CTA: cta, Contador: counter(t, cta), Emitido: emitido})
+			}
+		}
+	}
+	return rollbacks, nil
+}
+
+// nextRange calcula los count números que siguen en la cuenta cta de t y
+// aplica todas las validaciones. Se llama con b.mu tomado.
+func (b *Bolt) nextRange(t dbf.ComprobanteTipo, ncfTipo ncf.Tipo, cta string, count int) (int64, int64, dbf.Partition, error) {
+	if err := checkCTA(cta); err != nil {
+		return 0, 0, dbf.Partition{}, err
+	}
+	part, err := b.partitions.For(ncfTipo.Codigo, cta)
+	if err != nil {
+		return 0, 0, dbf.Partition{}, err
+	}
+	actual := counter(t, cta)
+	if emitido := b.marks[ncfTipo.Codigo+"/"+cta]; actual < emitido {
+		return 0, 0, dbf.Partition{}, fmt.Errorf("%w: %s CTA %s está en %d y ya se emitió hasta %d",
+			dbf.ErrCounterRollback, ncfTipo.Codigo, cta, actual, emitido)
+	}
+	first, last, err := dbf.PlanRange(ncfTipo, part, actual, count)
+	if err != nil {
+		return 0, 0, dbf.Partition{}, err
+	}
+	if err := dbf.CheckAuthorization(ncfTipo.Codigo, t.FechaDoc, t.CantSecuen, last); err != nil {
+		return 0, 0, dbf.Partition{}, err
+	}
+	return first, last, part, nil
+}
+
+// raiseMark sube la marca de tipo/cta a n si es mayor que la actual
+func (b *Bolt) raiseMark(tipo, cta string, n int64) {
+	key := tipo + "/" + cta
+	if n > b.marks[key] {
+		b.marks[key] = n
+	}
+}
+
+func checkCTA(cta string) error {
+	if cta != "A" && cta != "B" {
+		return fmt.Errorf("%w: %s", dbf.ErrInvalidCTA, cta)
+	}
+	return nil
+}
+
+// counter y setCounter acceden al contador de la cuenta: Numero1 para A y
+// Numero2 para B, como NUMERO_1 y NUMERO_2 en el DBF
+func counter(t dbf.ComprobanteTipo, cta string) int64 {
+	if cta == "B" {
+		return t.Numero2
+	}
+	return t.Numero1
+}
+
+func setCounter(t *dbf.ComprobanteTipo, cta string, n int64) {
+	if cta == "B" {
+		t.Numero2 = n
+	} else {
+		t.Numero1 = n
+	}
+}
+
+func getTipo(bkt *bbolt.Bucket, tipo string) (dbf.ComprobanteTipo, error) {
+	var t dbf.ComprobanteTipo
+	data := bkt.Get([]byte(tipo))
+	if data == nil {
+		return t, fmt.Errorf("%w: %s", dbf.ErrTypeNotFound, tipo)
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("tipo %s dañado en el almacén: %v", tipo, err)
+	}
+	return t, nil
+}
+
+func putTipo(bkt *bbolt.Bucket, t dbf.ComprobanteTipo) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(t.NCFTipo), data)
+}
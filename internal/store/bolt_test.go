@@ -0,0 +1,184 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/store"
+)
+
+// openSeeded abre un almacén nuevo con E31 (agotado en 150) y E34 en cero
+func openSeeded(t *testing.T, path string, opts ...store.BoltOption) *store.Bolt {
+	t.Helper()
+	b, err := store.OpenBolt(path, opts...)
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	for _, ct := range []dbf.ComprobanteTipo{
+		{Numero: "E31", Nombre: "CREDITO FISCAL", Numero1: 150, CantSecuen: 150, FechaDoc: "20991231"},
+		{Numero: "E34", Nombre: "NOTA DE CREDITO", CantSecuen: 1000, Minimo: 100, FechaDoc: "20991231"},
+	} {
+		if err := b.PutTipo(ct); err != nil {
+			t.Fatalf("PutTipo(%s) error = %v", ct.Numero, err)
+		}
+	}
+	return b
+}
+
+func TestBolt_GetSequences(t *testing.T) {
+	var levels []dbf.StockLevel
+	b := openSeeded(t, filepath.Join(t.TempDir(), "secuencias.db"),
+		store.WithStockObserver(func(l dbf.StockLevel) { levels = append(levels, l) }))
+	defer b.Close()
+
+	if seq, num, err := b.GetSequence("E34", "a"); err != nil || seq != "E340000000001" || num != 1 {
+		t.Fatalf("GetSequence() = %q, %d, %v", seq, num, err)
+	}
+	sequences, first, err := b.GetSequences("E34", "A", 998)
+	if err != nil || first != 2 || sequences[len(sequences)-1] != "E340000000999" {
+		t.Fatalf("GetSequences() = %d..%v, %v", first, sequences[len(sequences)-1:], err)
+	}
+	if _, _, err := b.GetSequences("E34", "A", 2); !errors.Is(err, dbf.ErrRangeExhausted) {
+		t.Errorf("GetSequences() error = %v, se esperaba ErrRangeExhausted", err)
+	}
+	if _, _, err := b.GetSequence("E31", "A"); !errors.Is(err, dbf.ErrRangeExhausted) {
+		t.Errorf("GetSequence(E31) error = %v, se esperaba ErrRangeExhausted", err)
+	}
+	if _, _, err := b.GetSequence("E32", "A"); !errors.Is(err, dbf.ErrTypeNotFound) {
+		t.Errorf("GetSequence(E32) error = %v, se esperaba ErrTypeNotFound", err)
+	}
+	if _, _, err := b.GetSequence("E34", "C"); !errors.Is(err, dbf.ErrInvalidCTA) {
+		t.Errorf("GetSequence(CTA C) error = %v, se esperaba ErrInvalidCTA", err)
+	}
+
+	if len(levels) != 2 || levels[1].Restantes != 1 {
+		t.Errorf("el observador recibió %+v", levels)
+	}
+}
+
+func TestBolt_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secuencias.db")
+	b := openSeeded(t, path)
+	if _, _, err := b.GetSequences("E34", "A", 5); err != nil {
+		t.Fatalf("GetSequences() error = %v", err)
+	}
+
+	// Mientras está abierto, nadie más puede usarlo
+	if _, err := store.OpenBolt(path); err == nil {
+		t.Error("OpenBolt() abrió un almacén que ya estaba en uso")
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := store.OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	defer b.Close()
+	tipos, err := b.GetRecordTypes()
+	if err != nil {
+		t.Fatalf("GetRecordTypes() error = %v", err)
+	}
+	if len(tipos) != 2 || tipos[1].NCFTipo != "E34" || tipos[1].Numero1 != 5 || tipos[1].Nombre != "NOTA DE CREDITO" {
+		t.Errorf("GetRecordTypes() = %+v", tipos)
+	}
+	if seq, _, err := b.GetSequence("E34", "A"); err != nil || seq != "E340000000006" {
+		t.Errorf("GetSequence() = %q, %v después de reabrir", seq, err)
+	}
+}
+
+func TestBolt_Partitions(t *testing.T) {
+	b := openSeeded(t, filepath.Join(t.TempDir(), "secuencias.db"), store.WithPartitions([]dbf.Partition{
+		{Tipo: "E34", CTA: "A", Desde: 1, Hasta: 500},
+		{Tipo: "E34", CTA: "B", Desde: 501, Hasta: 1000},
+	}))
+	defer b.Close()
+
+	if seq, _, err := b.GetSequence("E34", "B"); err != nil || seq != "E340000000501" {
+		t.Errorf("GetSequence(B) = %q, %v, se esperaba el inicio de la partición", seq, err)
+	}
+	if _, _, err := b.GetSequences("E34", "A", 501); !errors.Is(err, dbf.ErrRangeExhausted) {
+		t.Errorf("GetSequences(A, 501) error = %v, se esperaba ErrRangeExhausted", err)
+	}
+	if _, _, err := b.GetSequence("E31", "B"); !errors.Is(err, dbf.ErrCTANotPartitioned) {
+		t.Errorf("GetSequence(E31, B) error = %v, se esperaba ErrCTANotPartitioned", err)
+	}
+
+	levels, err := b.StockLevels()
+	if err != nil {
+		t.Fatalf("StockLevels() error = %v", err)
+	}
+	for _, l := range levels {
+		if l.Tipo == "E34" && l.CTA == "B" && l.Restantes != 499 {
+			t.Errorf("stock de E34/B = %+v", l)
+		}
+	}
+
+	// Las particiones no se pisan; un E31 emitido por ambas cuentas sí
+	if c, err := b.CheckCollisions(); err != nil || len(c) != 0 {
+		t.Errorf("CheckCollisions() = %+v, %v, no se esperaban colisiones", c, err)
+	}
+	b.PutTipo(dbf.ComprobanteTipo{Numero: "E31", Numero1: 150, Numero2: 3, CantSecuen: 150, FechaDoc: "20991231"})
+	if c, err := b.CheckCollisions(); err != nil || len(c) != 1 || c[0].Tipo != "E31" || c[0].Hasta != 3 {
+		t.Errorf("CheckCollisions() = %+v, %v, se esperaba E31 1-3", c, err)
+	}
+}
+
+func TestBolt_PeekAdjustAndRollback(t *testing.T) {
+	b := openSeeded(t, filepath.Join(t.TempDir(), "secuencias.db"),
+		store.WithPartitions([]dbf.Partition{
+			{Tipo: "E34", CTA: "A", Desde: 1, Hasta: 500},
+			{Tipo: "E34", CTA: "B", Desde: 501, Hasta: 1000},
+		}),
+		store.WithHighWater([]dbf.HighWater{{Tipo: "E34", CTA: "B", Numero: 520}}))
+	defer b.Close()
+
+	if seq, num, err := b.Peek("E34", "A"); err != nil || seq != "E340000000001" || num != 1 {
+		t.Fatalf("Peek() = %q, %d, %v", seq, num, err)
+	}
+	if seq, _, _ := b.GetSequence("E34", "A"); seq != "E340000000001" {
+		t.Errorf("GetSequence() = %q, Peek() no tocó el contador", seq)
+	}
+	if err := b.Adjust("E34", "A", 300); err != nil {
+		t.Fatalf("Adjust() error = %v", err)
+	}
+	if _, num, _ := b.Peek("E34", "A"); num != 301 {
+		t.Errorf("Peek() = %d después de Adjust(300)", num)
+	}
+	// El ajuste queda como marca: no se puede volver por debajo de él
+	if err := b.Adjust("E34", "A", 200); !errors.Is(err, dbf.ErrCounterRollback) {
+		t.Errorf("Adjust(200) error = %v, se esperaba ErrCounterRollback", err)
+	}
+
+	// El ledger dice que B ya emitió hasta 520 y el almacén está en 0
+	rollbacks, err := b.Rollbacks()
+	if err != nil || len(rollbacks) != 1 || rollbacks[0].Emitido != 520 {
+		t.Fatalf("Rollbacks() = %+v, %v", rollbacks, err)
+	}
+	if _, _, err := b.GetSequence("E34", "B"); !errors.Is(err, dbf.ErrCounterRollback) {
+		t.Errorf("GetSequence(B) error = %v, se esperaba ErrCounterRollback", err)
+	}
+	if err := b.Adjust("E34", "B", 520); err != nil {
+		t.Fatalf("Adjust(B, 520) error = %v", err)
+	}
+	if rollbacks, _ := b.Rollbacks(); len(rollbacks) != 0 {
+		t.Errorf("Rollbacks() = %+v después de adelantar", rollbacks)
+	}
+	if seq, _, err := b.GetSequence("E34", "B"); err != nil || seq != "E340000000521" {
+		t.Errorf("GetSequence(B) = %q, %v", seq, err)
+	}
+}
+
+func TestKind(t *testing.T) {
+	for in, want := range map[string]string{"": store.KindDBF, "DBF": store.KindDBF, " bolt ": store.KindBolt} {
+		if got, err := store.Kind(in); err != nil || got != want {
+			t.Errorf("Kind(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := store.Kind("sqlite"); err == nil {
+		t.Error("Kind() aceptó un almacén desconocido")
+	}
+}
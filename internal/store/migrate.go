@@ -0,0 +1,252 @@
+// internal/store/migrate.go
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// bucketMeta guarda los bytes del DBF y del CDX tal como estaban al migrar,
+// para poder volver a armar la tabla con el mismo esquema
+var bucketMeta = []byte("meta")
+
+const (
+	metaDBF = "dbf-original"
+	metaCDX = "cdx-original"
+)
+
+// Difference es un campo de un tipo que no quedó igual en el destino
+type Difference struct {
+	Tipo    string `json:"tipo"`
+	Campo   string `json:"campo"`
+	Origen  string `json:"origen"`
+	Destino string `json:"destino"`
+}
+
+// MigrationReport resume una migración entre el DBF y el almacén
+type MigrationReport struct {
+	Operacion   string       `json:"operacion"` // "importar" o "exportar"
+	Origen      string       `json:"origen"`
+	Destino     string       `json:"destino"`
+	Fecha       time.Time    `json:"fecha"`
+	Tipos       []string     `json:"tipos"`
+	Respaldo    string       `json:"respaldo,omitempty"` // copia del DBF reemplazado
+	Diferencias []Difference `json:"diferencias,omitempty"`
+}
+
+// OK indica si el destino quedó igual al origen en todos los campos
+func (r *MigrationReport) OK() bool {
+	return len(r.Diferencias) == 0
+}
+
+// Write guarda el reporte en path como JSON
+func (r *MigrationReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ImportDBF copia todos los tipos del DBF de mgr al almacén b, que tiene que
+// estar vacío, en una sola transacción. Guarda además el DBF y su CDX
+// originales para ExportDBF. Después relee el almacén y compara campo por
+// campo; las diferencias quedan en el reporte.
+//
+// mgr tiene que ser dueño del journal: si el servicio está usando el DBF la
+// migración no corre, y mientras mgr siga abierto el servicio no puede asignar.
+func ImportDBF(mgr *dbf.Manager, dbfPath string, b *Bolt) (*MigrationReport, error) {
+	if !mgr.Exclusive() {
+		return nil, fmt.Errorf("el DBF %s lo está usando otro proceso; detenga el servicio antes de migrar", dbfPath)
+	}
+	rollbacks, err := mgr.Rollbacks()
+	if err != nil {
+		return nil, err
+	}
+	if len(rollbacks) > 0 {
+		return nil, fmt.Errorf("%w: %d contador(es) por debajo de lo ya emitido; corra adelantar-contadores antes de migrar",
+			dbf.ErrCounterRollback, len(rollbacks))
+	}
+
+	tipos, err := mgr.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, t := range tipos {
+		if t.NCFTipo == "" {
+			return nil, fmt.Errorf("hay un registro sin tipo de comprobante (NUMERO %q, COD_PF_F %d)", t.Numero, t.CodPFF)
+		}
+		if seen[t.NCFTipo] {
+			return nil, fmt.Errorf("el tipo %s aparece más de una vez en el DBF", t.NCFTipo)
+		}
+		seen[t.NCFTipo] = true
+	}
+
+	dbfData, err := os.ReadFile(dbfPath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo DBF: %v", err)
+	}
+	cdxPath := strings.TrimSuffix(dbfPath, ".DBF") + ".CDX"
+	cdxData, err := os.ReadFile(cdxPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error leyendo CDX: %v", err)
+	}
+
+	b.mu.Lock()
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucketTipos)
+		if n := bkt.Stats().KeyN; n > 0 {
+			return fmt.Errorf("el almacén ya tiene %d tipo(s); use un archivo nuevo", n)
+		}
+		for _, t := range tipos {
+			t.BajoMinimo = false
+			if err := putTipo(bkt, t); err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put([]byte(metaDBF), dbfData); err != nil {
+			return err
+		}
+		if cdxData != nil {
+			return meta.Put([]byte(metaCDX), cdxData)
+		}
+		return nil
+	})
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	got, err := b.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+	report := &MigrationReport{Operacion: "importar", Origen: dbfPath, Destino: b.db.Path(), Fecha: time.Now()}
+	for _, t := range tipos {
+		report.Tipos = append(report.Tipos, t.NCFTipo)
+	}
+	report.Diferencias = CompareTipos(tipos, got)
+	b.Log(fmt.Sprintf("Importados %d tipos desde %s", len(tipos), dbfPath))
+	return report, nil
+}
+
+// ExportDBF vuelve a armar el DBF en dbfPath con el esquema que tenía al
+// importarse y los contadores actuales del almacén (ver dbf.ExportTable). Si
+// dbfPath existe, primero se deja una copia. encoding vacío usa la página de
+// códigos del DBF original. Después relee el DBF y compara campo por campo.
+func ExportDBF(b *Bolt, dbfPath string, encoding string) (*MigrationReport, error) {
+	dbfData, cdxData, err := b.dbfTemplate()
+	if err != nil {
+		return nil, err
+	}
+	tipos, err := b.GetRecordTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{Operacion: "exportar", Origen: b.db.Path(), Destino: dbfPath, Fecha: time.Now()}
+	if current, err := os.ReadFile(dbfPath); err == nil {
+		report.Respaldo = fmt.Sprintf("%s.bak-%s", dbfPath, report.Fecha.Format("20060102150405"))
+		if err := os.WriteFile(report.Respaldo, current, 0644); err != nil {
+			return nil, fmt.Errorf("error creando copia de seguridad: %v", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error leyendo %s: %v", dbfPath, err)
+	}
+
+	if err := dbf.ExportTable(dbfPath, dbfData, cdxData, tipos, encoding); err != nil {
+		return nil, err
+	}
+	written, err := dbf.ReadRecordTypes(dbfPath, encoding)
+	if err != nil {
+		return nil, err
+	}
+	// El DBF puede tener registros sin tipo que el almacén no conoce
+	var got []dbf.ComprobanteTipo
+	for _, t := range written {
+		if t.NCFTipo != "" {
+			got = append(got, t)
+		}
+	}
+	for _, t := range tipos {
+		report.Tipos = append(report.Tipos, t.NCFTipo)
+	}
+	report.Diferencias = CompareTipos(tipos, got)
+	b.Log(fmt.Sprintf("Exportados %d tipos a %s", len(tipos), dbfPath))
+	return report, nil
+}
+
+// dbfTemplate devuelve el DBF y el CDX guardados por ImportDBF
+func (b *Bolt) dbfTemplate() (dbfData, cdxData []byte, err error) {
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		if meta == nil || meta.Get([]byte(metaDBF)) == nil {
+			return fmt.Errorf("el almacén no se creó desde un DBF; no hay esquema para exportar")
+		}
+		dbfData = append([]byte(nil), meta.Get([]byte(metaDBF))...)
+		if cdx := meta.Get([]byte(metaCDX)); cdx != nil {
+			cdxData = append([]byte(nil), cdx...)
+		}
+		return nil
+	})
+	return dbfData, cdxData, err
+}
+
+// CompareTipos compara want con got campo por campo, emparejando por tipo.
+// Un tipo que falta de un lado se reporta con el campo "tipo".
+func CompareTipos(want, got []dbf.ComprobanteTipo) []Difference {
+	index := func(tipos []dbf.ComprobanteTipo) map[string]dbf.ComprobanteTipo {
+		m := make(map[string]dbf.ComprobanteTipo, len(tipos))
+		for _, t := range tipos {
+			m[t.NCFTipo] = t
+		}
+		return m
+	}
+	w, g := index(want), index(got)
+
+	var keys []string
+	for k := range w {
+		keys = append(keys, k)
+	}
+	for k := range g {
+		if _, ok := w[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diffs []Difference
+	for _, k := range keys {
+		a, inW := w[k]
+		b, inG := g[k]
+		switch {
+		case !inG:
+			diffs = append(diffs, Difference{Tipo: k, Campo: "tipo", Origen: k, Destino: "(no está)"})
+			continue
+		case !inW:
+			diffs = append(diffs, Difference{Tipo: k, Campo: "tipo", Origen: "(no está)", Destino: k})
+			continue
+		}
+		fa, fb := a.Fields(), b.Fields()
+		for i := range fa {
+			if fa[i][1] != fb[i][1] {
+				diffs = append(diffs, Difference{Tipo: k, Campo: fa[i][0], Origen: fa[i][1], Destino: fb[i][1]})
+			}
+		}
+	}
+	return diffs
+}
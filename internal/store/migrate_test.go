@@ -0,0 +1,144 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ecf-sequence-server/internal/dbf"
+	"ecf-sequence-server/internal/store"
+)
+
+// copyDBF copia el DBF y el CDX de prueba de internal/dbf a un directorio
+// temporal
+func copyDBF(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"FAC_PF_M.DBF", "FAC_PF_M.CDX"} {
+		data, err := os.ReadFile(filepath.Join("..", "dbf", name))
+		if err != nil {
+			t.Fatalf("Error leyendo %s de prueba: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "FAC_PF_M.DBF")
+}
+
+func TestImportExportDBF(t *testing.T) {
+	path := copyDBF(t)
+	original, err := dbf.ReadRecordTypes(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr, err := dbf.NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	b, err := store.OpenBolt(filepath.Join(t.TempDir(), "secuencias.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	defer b.Close()
+	report, err := store.ImportDBF(mgr, path, b)
+	if err != nil {
+		t.Fatalf("ImportDBF() error = %v", err)
+	}
+	if !report.OK() || len(report.Tipos) != len(original) {
+		t.Fatalf("ImportDBF() = %+v", report)
+	}
+	// Un almacén que ya tiene tipos no se pisa
+	if _, err := store.ImportDBF(mgr, path, b); err == nil {
+		t.Error("ImportDBF() importó sobre un almacén con datos")
+	}
+	mgr.Close()
+
+	// El almacén sigue asignando y la exportación lleva el contador al DBF
+	if seq, _, err := b.GetSequence("E34", "A"); err != nil || seq != "E340000000001" {
+		t.Fatalf("GetSequence() = %q, %v", seq, err)
+	}
+	report, err = store.ExportDBF(b, path, "")
+	if err != nil {
+		t.Fatalf("ExportDBF() error = %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("ExportDBF() diferencias = %+v", report.Diferencias)
+	}
+	if _, err := os.Stat(report.Respaldo); err != nil {
+		t.Errorf("no quedó copia del DBF reemplazado: %v", err)
+	}
+	got, err := dbf.ReadRecordTypes(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ct := range got {
+		want := original[i]
+		if ct.NCFTipo == "E34" {
+			want.Numero1 = 1
+		}
+		if ct != want {
+			t.Errorf("%s = %+v, se esperaba %+v", ct.NCFTipo, ct, want)
+		}
+	}
+	if index, err := dbf.VerifyIndex(path); err != nil || len(index.Problemas) != 0 {
+		t.Errorf("VerifyIndex() = %+v, %v", index, err)
+	}
+
+	out := filepath.Join(t.TempDir(), "reporte.json")
+	if err := report.Write(out); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if data, _ := os.ReadFile(out); !strings.Contains(string(data), `"operacion": "exportar"`) {
+		t.Errorf("reporte = %s", data)
+	}
+}
+
+func TestImportDBF_ServiceRunning(t *testing.T) {
+	path := copyDBF(t)
+	service, err := dbf.NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer service.Close()
+
+	// El journal es del "servicio": este Manager solo puede leer
+	mgr, err := dbf.NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer mgr.Close()
+	b, err := store.OpenBolt(filepath.Join(t.TempDir(), "secuencias.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := store.ImportDBF(mgr, path, b); err == nil {
+		t.Error("ImportDBF() migró un DBF en uso por el servicio")
+	}
+	if tipos, _ := b.GetRecordTypes(); len(tipos) != 0 {
+		t.Errorf("el almacén quedó con %d tipos", len(tipos))
+	}
+}
+
+func TestExportDBF_WithoutTemplate(t *testing.T) {
+	b := openSeeded(t, filepath.Join(t.TempDir(), "secuencias.db"))
+	defer b.Close()
+	if _, err := store.ExportDBF(b, filepath.Join(t.TempDir(), "FAC_PF_M.DBF"), ""); err == nil {
+		t.Error("ExportDBF() exportó sin el esquema del DBF original")
+	}
+}
+
+func TestCompareTipos(t *testing.T) {
+	want := []dbf.ComprobanteTipo{{NCFTipo: "E31", Numero1: 5}, {NCFTipo: "E32"}}
+	got := []dbf.ComprobanteTipo{{NCFTipo: "E31", Numero1: 6}, {NCFTipo: "E34"}}
+	diffs := store.CompareTipos(want, got)
+	if len(diffs) != 3 {
+		t.Fatalf("CompareTipos() = %+v", diffs)
+	}
+	if d := diffs[0]; d.Tipo != "E31" || d.Campo != "NUMERO_1" || d.Origen != "5" || d.Destino != "6" {
+		t.Errorf("diferencia de E31 = %+v", d)
+	}
+}
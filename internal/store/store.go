@@ -0,0 +1,97 @@
+// internal/store/store.go
+
+// Package store define lo que el servicio necesita de un almacén de
+// secuencias. Lo implementan el Manager del DBF del ERP y Bolt, un archivo
+// propio para las sucursales que ya no usan FoxPro.
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"ecf-sequence-server/internal/dbf"
+)
+
+// SequenceStore lista los tipos de comprobante y asigna sus números. Los
+// errores de asignación son los mismos de dbf (dbf.ErrRangeExhausted,
+// dbf.ErrTypeNotFound, ...) sea cual sea el almacén.
+type SequenceStore interface {
+	// GetRecordTypes lista los tipos con sus contadores y autorizaciones
+	GetRecordTypes() ([]dbf.ComprobanteTipo, error)
+
+	// GetSequence asigna el siguiente número de tipo/cta
+	GetSequence(tipo string, cta string) (string, int64, error)
+
+	// GetSequences asigna count números contiguos (todo o nada) y devuelve
+	// los NCF y el primer número
+	GetSequences(tipo string, cta string, count int) ([]string, int64, error)
+
+	// Peek devuelve lo que entregaría la próxima asignación sin hacerla
+	Peek(tipo string, cta string) (string, int64, error)
+
+	// Adjust deja el contador de tipo/cta en numero (el último emitido)
+	Adjust(tipo string, cta string, numero int64) error
+
+	// StockLevels calcula cuántos números le quedan a cada cuenta
+	StockLevels() ([]dbf.StockLevel, error)
+
+	// Rollbacks devuelve los contadores que quedaron por debajo de lo ya
+	// emitido; mientras haya alguno el servicio no está sano
+	Rollbacks() ([]dbf.Rollback, error)
+
+	// CheckCollisions reporta los números que ya emitieron las dos cuentas
+	// (ver dbf.Partitions.Collisions); el servicio no arranca si hay alguno
+	CheckCollisions() ([]dbf.Collision, error)
+
+	// Log graba un mensaje en el log del almacén
+	Log(message string)
+
+	// Close libera los archivos del almacén
+	Close() error
+}
+
+// Snapshotter lo implementan los almacenes que guardan respaldos de sus
+// archivos (el DBF). El servicio solo ofrece respaldos si el almacén lo
+// implementa.
+type Snapshotter interface {
+	// Snapshots lista los respaldos, del más nuevo al más viejo
+	Snapshots() ([]dbf.Snapshot, error)
+
+	// RestoreSnapshot vuelve al respaldo nombre sin bajar ningún contador
+	// de lo ya emitido; devuelve los contadores que hubo que adelantar
+	RestoreSnapshot(nombre string) ([]dbf.Rollback, error)
+}
+
+// Suspender lo implementan los almacenes que, en pausa, sueltan sus archivos
+// para que otro proceso (el ERP o una herramienta de administración) pueda
+// usarlos. El servicio deja de asignar en pausa aunque el almacén no lo
+// implemente.
+type Suspender interface {
+	Suspend() error
+	Resume() error
+}
+
+var (
+	_ SequenceStore = (*dbf.Manager)(nil)
+	_ SequenceStore = (*Bolt)(nil)
+	_ Snapshotter   = (*dbf.Manager)(nil)
+	_ Suspender     = (*dbf.Manager)(nil)
+)
+
+// Tipos de almacén que acepta Kind
+const (
+	KindDBF  = "dbf"
+	KindBolt = "bolt"
+)
+
+// Kind normaliza el nombre del almacén configurado; vacío equivale a dbf
+func Kind(name string) (string, error) {
+	switch k := strings.ToLower(strings.TrimSpace(name)); k {
+	case "", KindDBF:
+		return KindDBF, nil
+	case KindBolt:
+		return KindBolt, nil
+	default:
+		return "", fmt.Errorf("almacén desconocido %q (use %s o %s)", name, KindDBF, KindBolt)
+	}
+}
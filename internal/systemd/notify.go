@@ -0,0 +1,61 @@
+// Package systemd implementa lo mínimo del protocolo sd_notify para correr
+// como servicio Type=notify: avisar que el servicio está listo, que está
+// recargando su configuración, que se está deteniendo y mantener vivo el
+// watchdog. Fuera de systemd (NOTIFY_SOCKET
+// vacío) no hace nada.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Estados que entiende systemd (ver sd_notify(3))
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+)
+
+// Notify envía state al socket de NOTIFY_SOCKET. Si el proceso no lo lanzó
+// systemd devuelve nil sin hacer nada.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Un nombre que empieza con "@" es un socket abstracto; net lo traduce
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("error conectando a NOTIFY_SOCKET: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("error avisando a systemd: %v", err)
+	}
+	return nil
+}
+
+// Status arma el estado STATUS= que systemctl status muestra del servicio
+func Status(msg string) string {
+	return "STATUS=" + msg
+}
+
+// WatchdogInterval devuelve el WatchdogSec configurado para este proceso, o
+// false si no hay watchdog. Hay que avisar con Watchdog antes de que venza;
+// lo habitual es hacerlo a la mitad del intervalo.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	// Si está WATCHDOG_PID, el watchdog es de ese proceso y no de sus hijos
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
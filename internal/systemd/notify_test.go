@@ -0,0 +1,58 @@
+package systemd_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"ecf-sequence-server/internal/systemd"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("sin sockets unixgram: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := systemd.Notify(systemd.Ready); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Errorf("systemd recibió %q, %v", buf[:n], err)
+	}
+}
+
+func TestNotify_WithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := systemd.Notify(systemd.Ready); err != nil {
+		t.Errorf("Notify() fuera de systemd = %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if _, ok := systemd.WatchdogInterval(); ok {
+		t.Error("WatchdogInterval() sin WATCHDOG_USEC")
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if d, ok := systemd.WatchdogInterval(); !ok || d != 30*time.Second {
+		t.Errorf("WatchdogInterval() = %v, %v", d, ok)
+	}
+
+	// El watchdog de otro proceso no es nuestro
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if _, ok := systemd.WatchdogInterval(); ok {
+		t.Error("WatchdogInterval() con WATCHDOG_PID de otro proceso")
+	}
+}